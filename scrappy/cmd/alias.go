@@ -0,0 +1,70 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// aliasCmd represents the alias command
+var aliasCmd = &cobra.Command{
+	Use:   "alias [index name]",
+	Short: "Show or change the index the companies alias points to",
+	Long: `Without arguments, show the index the companies alias points to.
+
+Given an index name, atomically point the companies alias to it,
+e.g. to roll back to a previous index version.`,
+	SilenceUsage: true,
+	Args:         cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		indexName := ""
+		if len(args) > 0 {
+			indexName = args[0]
+		}
+
+		return aliasAction(indexName)
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(aliasCmd)
+}
+
+func aliasAction(indexName string) error {
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if indexName != "" {
+		err = client.SetCompanyAlias(ctx, indexName)
+		if err != nil {
+			return err
+		}
+	}
+
+	current, err := client.CurrentCompanyIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Companies alias points to %q\n", current)
+	return nil
+}
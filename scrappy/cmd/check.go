@@ -22,6 +22,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // checkCmd represents the check command
@@ -34,12 +35,90 @@ func init() {
 	rootCmd.AddCommand(checkCmd)
 }
 
+// Config key holding extra CSV header aliases for each company field, e.g.
+//
+//	csv_aliases:
+//	  domain: [homepage, site]
+//	  commercial_name: [brand]
+const csvAliasesKey = "csv_aliases"
+
+// csvSchema returns the default CSV schema, extended with the configured header aliases.
+func csvSchema() (*csv.Schema, error) {
+	schema := csv.DefaultSchema()
+
+	for field, aliases := range viper.GetStringMapStringSlice(csvAliasesKey) {
+		err := schema.AddAliases(field, aliases...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+// Path of the file to which invalid CSV lines are written
+const rejectsFlagKey = "rejects"
+
+// addRejectsFlag adds the rejects flag to commands loading CSV files.
+func addRejectsFlag(cmd *cobra.Command) {
+	cmd.Flags().String(rejectsFlagKey, "",
+		"write every invalid CSV line to this file (JSON if it ends in .json, CSV otherwise)")
+}
+
 func printExtraErrInfo(err error) {
-	switch value := errors.Unwrap(err).(type) {
-	case csv.ErrInvalidCSVLines:
-		for _, invalidLine := range value {
-			fmt.Fprintf(os.Stderr, "Invalid line %d %q: %s\n",
-				invalidLine.Index, invalidLine.Line, invalidLine.Err)
+	var invalidLines csv.ErrInvalidCSVLines
+	if !errors.As(err, &invalidLines) {
+		return
+	}
+
+	// Only show the first MaxInvalidCSVLines, the rest are counted
+	for index, invalidLine := range invalidLines {
+		if index >= csv.MaxInvalidCSVLines {
+			fmt.Fprintf(os.Stderr, "... and %d more invalid line(s)\n",
+				len(invalidLines)-csv.MaxInvalidCSVLines)
+			break
 		}
+
+		fmt.Fprintf(os.Stderr, "Invalid line %d %q: %s\n",
+			invalidLine.LineNumber, invalidLine.Line, invalidLine.Err)
+	}
+
+	fmt.Fprintln(os.Stderr, "\nInvalid lines by error type:")
+	for _, count := range invalidLines.CountByCategory() {
+		fmt.Fprintf(os.Stderr, "    %s: %d\n", count.Category, count.Count)
+	}
+}
+
+// saveRejects writes the invalid CSV lines in err to rejectsPath.
+//
+// Nothing is done if rejectsPath is empty. If err holds no invalid lines,
+// an empty rejects file is written, so stale reports don't linger around.
+func saveRejects(rejectsPath string, err error) error {
+	if rejectsPath == "" {
+		return nil
+	}
+
+	var invalidLines csv.ErrInvalidCSVLines
+	errors.As(err, &invalidLines)
+
+	saveErr := csv.SaveRejectsToFile(rejectsPath, invalidLines)
+	if saveErr != nil {
+		return fmt.Errorf("failed to write rejects: %w", saveErr)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %d rejected line(s) to %s\n", len(invalidLines), rejectsPath)
+	return nil
+}
+
+// printDuplicates reports the CSV lines collapsed into an earlier line with the same domain.
+func printDuplicates(duplicates []csv.DuplicateCSVLine) {
+	if len(duplicates) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%d duplicate line(s) collapsed\n", len(duplicates))
+	for _, duplicate := range duplicates {
+		fmt.Fprintf(os.Stderr, "Duplicate line %d %q: same domain as line %d\n",
+			duplicate.Index, duplicate.Domain, duplicate.FirstIndex)
 	}
 }
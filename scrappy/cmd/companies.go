@@ -18,6 +18,7 @@ package cmd
 import (
 	"examples/scrappy/internal/csv"
 	"fmt"
+	"sort"
 
 	"github.com/spf13/cobra"
 )
@@ -30,25 +31,42 @@ var companiesCmd = &cobra.Command{
 	SilenceUsage: true,
 	Args:         cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return companiesAction(args[0])
+		rejectsPath, err := cmd.Flags().GetString(rejectsFlagKey)
+		if err != nil {
+			return err
+		}
+
+		return companiesAction(args[0], rejectsPath)
 	},
 }
 
 func init() {
 	checkCmd.AddCommand(companiesCmd)
+	addRejectsFlag(companiesCmd)
 }
 
-func companiesAction(csvPath string) error {
+func companiesAction(csvPath string, rejectsPath string) error {
 	if csvPath == "" {
 		return fmt.Errorf("missing csv file argument")
 	}
 
-	companies, err := csv.LoadCompaniesFromFile(csvPath)
+	schema, err := csvSchema()
+	if err != nil {
+		return err
+	}
+
+	companies, err := schema.LoadCompaniesFromFile(csvPath)
+	if saveErr := saveRejects(rejectsPath, err); saveErr != nil {
+		return saveErr
+	}
 	if err != nil {
 		printExtraErrInfo(err)
 		return err
 	}
 
+	companies, duplicates := csv.DedupCompanies(companies)
+	printDuplicates(duplicates)
+
 	printCompaniesInfo(companies)
 	return nil
 }
@@ -65,6 +83,7 @@ func printCompanyInfo(company *csv.Company) {
 	printField("Commercial name:", company.CommercialName)
 	printField("Legal name:", company.LegalName)
 	printCompanyAvailableNames(company.AllAvailableNames)
+	printCompanyAttributes(company.Attributes)
 }
 
 func printCompanyAvailableNames(names []string) {
@@ -77,6 +96,24 @@ func printCompanyAvailableNames(names []string) {
 	}
 }
 
+func printCompanyAttributes(attributes map[string]string) {
+	if len(attributes) == 0 {
+		return
+	}
+
+	// Sort attribute names, so they are always shown in the same order
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Attributes:")
+	for _, name := range names {
+		fmt.Printf("    %s: %s\n", name, attributes[name])
+	}
+}
+
 func printField(label string, value string) {
 	if value != "" {
 		fmt.Println(label, value)
@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"context"
-	"examples/scrappy/internal/es"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -25,12 +24,16 @@ import (
 
 // createCmd represents the create command
 var createCmd = &cobra.Command{
-	Use:          "create <index name>",
-	Short:        "Create the given Elastic Search index",
+	Use:   "create",
+	Short: "Create the first version of the companies index, and the companies alias pointing to it",
+	Long: `Create the first version of the companies index (companies_v1),
+and the companies alias pointing to it.
+
+Once the alias exists, mapping changes are applied using "scrappy es index reindex".`,
 	SilenceUsage: true,
-	Args:         cobra.ExactArgs(1),
+	Args:         cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return createIndexAction(args[0])
+		return createIndexAction()
 	},
 }
 
@@ -38,22 +41,15 @@ func init() {
 	indexCmd.AddCommand(createCmd)
 }
 
-func createIndexAction(indexName string) error {
-	// Get ElasticSearch config
-	config, err := esConfig()
-	if err != nil {
-		return err
-	}
-
-	// Initialize a new ES client
-	client, err := es.NewClient(config)
+func createIndexAction() error {
+	client, err := esClient()
 	if err != nil {
 		return err
 	}
 
 	// Create ES index
 	ctx := context.Background()
-	err = client.CreateCompanyIndex(ctx, indexName)
+	indexName, err := client.CreateCompanyIndex(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:          "delete <index name>",
+	Short:        "Delete an old companies index version",
+	Long:         `Delete a companies index version. The index the companies alias points to can't be deleted.`,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return deleteIndexAction(args[0])
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(deleteCmd)
+}
+
+func deleteIndexAction(indexName string) error {
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	err = client.DeleteCompanyIndex(ctx, indexName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Index %q deleted successfully\n", indexName)
+	return nil
+}
@@ -42,7 +42,18 @@ var domainsCmd = &cobra.Command{
 			return err
 		}
 
-		return domainAction(csvPath, numWorkers)
+		rejectsPath, err := cmd.Flags().GetString(rejectsFlagKey)
+		if err != nil {
+			return err
+		}
+
+		stopMetrics, err := startCommandMetrics(cmd, "scrappy_check_domains")
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+
+		return domainAction(csvPath, numWorkers, rejectsPath)
 	},
 }
 
@@ -51,11 +62,13 @@ func init() {
 
 	domainsCmd.Flags().Int("workers", runtime.NumCPU()*20,
 		"number of concurrent workers (defaults to 20 * NumCPUs)")
+	addRejectsFlag(domainsCmd)
+	addMetricsFlags(domainsCmd)
 }
 
-func domainAction(csvPath string, numWorkers int) error {
+func domainAction(csvPath string, numWorkers int, rejectsPath string) error {
 	// Load website URLs from CSV file
-	urls, err := loadDomainUrls(csvPath)
+	urls, err := loadDomainUrls(csvPath, rejectsPath)
 	if err != nil {
 		return err
 	}
@@ -68,19 +81,33 @@ func domainAction(csvPath string, numWorkers int) error {
 	return nil
 }
 
-// loadDomainUrls loads the URLs from the CSV file
-func loadDomainUrls(csvPath string) (urls []string, err error) {
+// loadDomainUrls loads the URLs from the CSV file.
+//
+// Invalid CSV lines are written to rejectsPath, if it is set.
+func loadDomainUrls(csvPath string, rejectsPath string) (urls []string, err error) {
 	if csvPath == "" {
 		return nil, fmt.Errorf("missing csv file argument")
 	}
 
+	schema, err := csvSchema()
+	if err != nil {
+		return nil, err
+	}
+
 	// Load website domains from CSV file
-	websites, err := csv.LoadDomainsFromFile(csvPath)
+	websites, err := schema.LoadDomainsFromFile(csvPath)
+	if saveErr := saveRejects(rejectsPath, err); saveErr != nil {
+		return nil, saveErr
+	}
 	if err != nil {
 		printExtraErrInfo(err)
 		return nil, err
 	}
 
+	// Collapse websites sharing the same registrable domain
+	websites, duplicates := csv.DedupWebsites(websites)
+	printDuplicates(duplicates)
+
 	// Collect urls
 	urls = make([]string, 0, len(websites))
 	for _, website := range websites {
@@ -20,6 +20,7 @@ import (
 	"examples/scrappy/internal/es"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -28,21 +29,32 @@ import (
 // Elasticsearch cluster configuration
 const usernameFlagKey = "es_username"
 const passwordFlagKey = "es_password"
+const passwordFileFlagKey = "es_password_file"
+const apiKeyFlagKey = "es_api_key"
+const bearerTokenFlagKey = "es_bearer_token"
 const esURLFlagKey = "es_url"
 const caCertFlagKey = "es_cacert"
+const caFingerprintFlagKey = "es_ca_fingerprint"
+const clientCertFlagKey = "es_client_cert"
+const clientKeyFlagKey = "es_client_key"
+const insecureFlagKey = "insecure"
 const defaultCaCertPath = "./elasticsearch_ca.crt"
 
-var esFlags = []string{usernameFlagKey, passwordFlagKey, esURLFlagKey, caCertFlagKey}
-
 var (
 	ErrMissingConfig = errors.New("missing ES config value")
 	ErrMissingCACert = errors.New("failed to load CA certificate")
+	ErrInvalidConfig = errors.New("invalid ES config value")
 )
 
 // esCmd represents the es command
 var esCmd = &cobra.Command{
 	Use:   "es",
 	Short: "Elastic Search commands",
+	Long: `Elastic Search commands.
+
+Connection options are read from flags, the config file, or SCRAPPY_ prefixed
+environment variables (e.g. SCRAPPY_ES_PASSWORD). Secrets can also be read
+from files, using es_password_file, so they aren't stored in the config file.`,
 }
 
 func init() {
@@ -55,42 +67,138 @@ func init() {
 	}{
 		{key: caCertFlagKey,
 			defaultValue: defaultCaCertPath,
-			usage:        "Elasticsearch cluster CA certificate"},
+			usage:        "Elasticsearch cluster CA certificate, optional if the cluster certificate is publicly trusted"},
+		{key: caFingerprintFlagKey, usage: "SHA256 fingerprint of the Elasticsearch cluster CA certificate, instead of es_cacert"},
 		{key: usernameFlagKey, usage: "Elasticsearch username"},
 		{key: passwordFlagKey, usage: "Elasticsearch password"},
-		{key: esURLFlagKey, usage: "Elasticsearch URL"},
+		{key: passwordFileFlagKey, usage: "file holding the Elasticsearch password, instead of es_password"},
+		{key: apiKeyFlagKey, usage: "Elasticsearch base64 encoded API key, instead of username and password"},
+		{key: bearerTokenFlagKey, usage: "Elasticsearch bearer token, instead of username and password"},
+		{key: clientCertFlagKey, usage: "client certificate, for clusters requiring TLS client authentication"},
+		{key: clientKeyFlagKey, usage: "client certificate key"},
+		{key: esURLFlagKey, usage: "Elasticsearch URL, several nodes can be separated by commas"},
 	}
 
 	for _, flag := range flags {
 		esCmd.PersistentFlags().String(flag.key, flag.defaultValue, flag.usage)
 		viper.BindPFlag(flag.key, esCmd.PersistentFlags().Lookup(flag.key))
 	}
+
+	esCmd.PersistentFlags().Bool(insecureFlagKey, false,
+		"skip verifying the Elasticsearch cluster certificate, only for local clusters")
+	viper.BindPFlag(insecureFlagKey, esCmd.PersistentFlags().Lookup(insecureFlagKey))
+}
+
+// esClient initializes a new ES client using the ElasticSearch config.
+func esClient() (*es.Client, error) {
+	config, err := esConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return es.NewClient(config)
 }
 
 func esConfig() (*es.Config, error) {
-	// Get config values from Viper
-	values := map[string]string{}
+	addresses := esAddresses()
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingConfig, esURLFlagKey)
+	}
 
-	for _, flag := range esFlags {
-		value := viper.GetString(flag)
-		if value == "" {
-			return nil, fmt.Errorf("%w: %s", ErrMissingConfig, flag)
-		}
-		values[flag] = value
+	password, err := esPassword()
+	if err != nil {
+		return nil, err
 	}
 
-	// Load CA certificate from path
-	caCert, err := os.ReadFile(values[caCertFlagKey])
+	caCert, err := esCACert()
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", ErrMissingCACert, err)
+		return nil, err
 	}
 
 	config := es.Config{
-		Username:  values[usernameFlagKey],
-		Password:  values[passwordFlagKey],
-		CACert:    caCert,
-		Addresses: []string{values[esURLFlagKey]},
+		Username:               viper.GetString(usernameFlagKey),
+		Password:               password,
+		APIKey:                 viper.GetString(apiKeyFlagKey),
+		BearerToken:            viper.GetString(bearerTokenFlagKey),
+		CACert:                 caCert,
+		CertificateFingerprint: viper.GetString(caFingerprintFlagKey),
+		Insecure:               viper.GetBool(insecureFlagKey),
+		Addresses:              addresses,
+		Observer:               esObserver,
+	}
+
+	// Client certificate and key, read from PEM files
+	for _, file := range []struct {
+		key   string
+		value *[]byte
+	}{
+		{key: clientCertFlagKey, value: &config.ClientCert},
+		{key: clientKeyFlagKey, value: &config.ClientKey},
+	} {
+		path := viper.GetString(file.key)
+		if path == "" {
+			continue
+		}
+
+		*file.value, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidConfig, file.key, err)
+		}
 	}
 
 	return &config, nil
 }
+
+// esAddresses returns the cluster addresses, either a YAML list in the config file,
+// or comma separated.
+func esAddresses() []string {
+	var addresses []string
+	for _, value := range viper.GetStringSlice(esURLFlagKey) {
+		for _, address := range strings.Split(value, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+
+	return addresses
+}
+
+// esPassword returns the password, read from es_password_file if set.
+func esPassword() (string, error) {
+	path := viper.GetString(passwordFileFlagKey)
+	if path == "" {
+		return viper.GetString(passwordFlagKey), nil
+	}
+
+	if viper.GetString(passwordFlagKey) != "" {
+		return "", fmt.Errorf("%w: set either %s or %s", ErrInvalidConfig, passwordFlagKey, passwordFileFlagKey)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %s", ErrInvalidConfig, passwordFileFlagKey, err)
+	}
+
+	// Files usually end with a newline, which isn't part of the password
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// esCACert loads the CA certificate, which is optional unless its path was changed from the default,
+// the default one is ignored when a fingerprint is set.
+func esCACert() ([]byte, error) {
+	path := viper.GetString(caCertFlagKey)
+	if path == "" || (path == defaultCaCertPath && viper.GetString(caFingerprintFlagKey) != "") {
+		return nil, nil
+	}
+
+	caCert, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && path == defaultCaCertPath {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMissingCACert, err)
+	}
+
+	return caCert, nil
+}
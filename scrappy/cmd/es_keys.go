@@ -0,0 +1,134 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// esKeysCmd represents the es keys command
+var esKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Commands for managing server API keys stored in ES",
+	Long: `Commands for managing server API keys stored in ES,
+used by servers started with --auth elastic.`,
+}
+
+// esKeysCreateCmd represents the es keys create command
+var esKeysCreateCmd = &cobra.Command{
+	Use:          "create <name>",
+	Short:        "Create an API key, storing its digest in ES",
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, apiKey, err := newAPIKey(cmd, args[0])
+		if err != nil {
+			return err
+		}
+
+		client, err := esClient()
+		if err != nil {
+			return err
+		}
+
+		record, err := client.CreateAPIKey(context.Background(), apiKey)
+		if err != nil {
+			return err
+		}
+
+		printAPIKey(key)
+		fmt.Printf("Created API key %q with scopes %s\n", record.Name, joinScopes(record.Scopes))
+		return nil
+	},
+}
+
+// esKeysListCmd represents the es keys list command
+var esKeysListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the API keys stored in ES",
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := esClient()
+		if err != nil {
+			return err
+		}
+
+		records, err := client.ListAPIKeys(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if len(records) == 0 {
+			fmt.Println("No API keys stored")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPES\tRATE LIMIT\tBURST\tCREATED AT")
+		for _, record := range records {
+			rateLimit, burst := "default", "default"
+			if record.RateLimit > 0 {
+				rateLimit = fmt.Sprintf("%g/s", record.RateLimit)
+			}
+			if record.Burst > 0 {
+				burst = fmt.Sprint(record.Burst)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", record.Name, joinScopes(record.Scopes),
+				rateLimit, burst, record.CreatedAt.Format(historyTimeFormat))
+		}
+		return w.Flush()
+	},
+}
+
+// esKeysDeleteCmd represents the es keys delete command
+var esKeysDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Revoke an API key stored in ES",
+	Long: `Revoke an API key stored in ES.
+
+Running servers cache keys for a minute, and accept the key until then.`,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := esClient()
+		if err != nil {
+			return err
+		}
+
+		err = client.DeleteAPIKey(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deleted API key %q\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	esCmd.AddCommand(esKeysCmd)
+	esKeysCmd.AddCommand(esKeysCreateCmd)
+	esKeysCmd.AddCommand(esKeysListCmd)
+	esKeysCmd.AddCommand(esKeysDeleteCmd)
+	addAPIKeyFlags(esKeysCreateCmd)
+}
@@ -0,0 +1,325 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	encodingcsv "encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"examples/scrappy/internal/es"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputFlagKey = "output"
+	formatFlagKey = "format"
+	fieldsFlagKey = "fields"
+	hasFlagKey    = "has"
+	queryFlagKey  = "query"
+)
+
+// Supported export formats
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// Separator used to join multi-value fields in CSV exports,
+// the same one used when importing company names.
+const multiValueSeparator = "|"
+
+// Prefix of company attribute fields, e.g. "attributes.country"
+const attributesFieldPrefix = "attributes."
+
+var defaultExportFields = []string{
+	"domain",
+	"commercial_name",
+	"legal_name",
+	"all_available_names",
+	"phone_numbers",
+}
+
+var ErrUnknownField = errors.New("unknown field")
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:          "export",
+	Short:        "Export companies from ElasticSearch to CSV or JSON Lines",
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+
+		outputPath, err := flags.GetString(outputFlagKey)
+		if err != nil {
+			return err
+		}
+
+		format, err := flags.GetString(formatFlagKey)
+		if err != nil {
+			return err
+		}
+
+		fields, err := flags.GetStringSlice(fieldsFlagKey)
+		if err != nil {
+			return err
+		}
+
+		hasFields, err := flags.GetStringSlice(hasFlagKey)
+		if err != nil {
+			return err
+		}
+
+		query, err := flags.GetString(queryFlagKey)
+		if err != nil {
+			return err
+		}
+
+		options := es.ExportOptions{HasFields: hasFields, Query: query}
+		return exportCompaniesAction(outputPath, format, fields, &options)
+	},
+}
+
+func init() {
+	esCmd.AddCommand(exportCmd)
+
+	flags := exportCmd.Flags()
+	flags.StringP(outputFlagKey, "o", "", "file to write companies to (defaults to stdout)")
+	flags.String(formatFlagKey, "",
+		"export format, csv or jsonl (defaults to jsonl for .jsonl output files, csv otherwise)")
+	flags.StringSlice(fieldsFlagKey, defaultExportFields,
+		"fields to export, company attributes can be selected using attributes.<name>")
+	flags.StringSlice(hasFlagKey, nil,
+		"only export companies having these fields, e.g. --has phone_numbers")
+	flags.String(queryFlagKey, "",
+		"only export companies matching this query string, e.g. 'attributes.country:US'")
+}
+
+func exportCompaniesAction(outputPath string, format string, fields []string, options *es.ExportOptions) error {
+	format, err := exportFormat(format, outputPath)
+	if err != nil {
+		return err
+	}
+
+	err = checkExportFields(fields)
+	if err != nil {
+		return err
+	}
+
+	// Get ElasticSearch config
+	config, err := esConfig()
+	if err != nil {
+		return err
+	}
+
+	// Initialize a new ES client
+	client, err := es.NewClient(config)
+	if err != nil {
+		return err
+	}
+
+	// Write to stdout, unless an output file is provided
+	if outputPath == "" {
+		return exportCompanies(client, os.Stdout, format, fields, options)
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = exportCompanies(client, file, format, fields, options)
+	if err != nil {
+		return err
+	}
+
+	// Buffered writes may only fail once the file is closed
+	return file.Close()
+}
+
+// exportCompanies writes the companies matching the options to out.
+func exportCompanies(client *es.Client, out io.Writer, format string, fields []string, options *es.ExportOptions) error {
+	writer := newExportWriter(out, format, fields)
+
+	err := writer.writeHeader()
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	ctx := context.Background()
+	err = client.ExportCompanies(ctx, options, func(company *es.Company) error {
+		count++
+		return writer.write(company)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writer.flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d companies\n", count)
+	return nil
+}
+
+// exportFormat validates the format, inferring it from the output path if it is empty.
+func exportFormat(format string, outputPath string) (string, error) {
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(outputPath), ".jsonl") {
+			return formatJSONL, nil
+		}
+		return formatCSV, nil
+	}
+
+	format = strings.ToLower(format)
+	if format != formatCSV && format != formatJSONL {
+		return "", fmt.Errorf("unsupported export format %q, expected csv or jsonl", format)
+	}
+
+	return format, nil
+}
+
+func checkExportFields(fields []string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: no fields selected", ErrUnknownField)
+	}
+
+	var company es.Company
+	for _, field := range fields {
+		_, err := exportFieldValues(&company, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportFieldValues returns the values of a company field.
+func exportFieldValues(company *es.Company, field string) ([]string, error) {
+	switch field {
+	case "id":
+		return nonEmpty(company.ID), nil
+	case "domain":
+		if company.Domain.URL == nil {
+			return nil, nil
+		}
+		return nonEmpty(company.Domain.String()), nil
+	case "commercial_name":
+		return nonEmpty(company.CommercialName), nil
+	case "legal_name":
+		return nonEmpty(company.LegalName), nil
+	case "all_available_names":
+		return company.AllAvailableNames, nil
+	case "phone_numbers":
+		return company.PhoneNumbers, nil
+	}
+
+	if strings.HasPrefix(field, attributesFieldPrefix) {
+		name := strings.TrimPrefix(field, attributesFieldPrefix)
+		return nonEmpty(company.Attributes[name]), nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownField, field)
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// exportWriter writes exported companies in CSV or JSON Lines format.
+type exportWriter struct {
+	fields     []string
+	csvWriter  *encodingcsv.Writer
+	jsonWriter *json.Encoder
+}
+
+func newExportWriter(out io.Writer, format string, fields []string) *exportWriter {
+	writer := exportWriter{fields: fields}
+
+	if format == formatJSONL {
+		writer.jsonWriter = json.NewEncoder(out)
+	} else {
+		writer.csvWriter = encodingcsv.NewWriter(out)
+	}
+
+	return &writer
+}
+
+// writeHeader writes the CSV header line, JSON Lines have no header.
+func (w *exportWriter) writeHeader() error {
+	if w.csvWriter == nil {
+		return nil
+	}
+
+	return w.csvWriter.Write(w.fields)
+}
+
+func (w *exportWriter) write(company *es.Company) error {
+	if w.csvWriter != nil {
+		record := make([]string, 0, len(w.fields))
+		for _, field := range w.fields {
+			values, _ := exportFieldValues(company, field)
+			record = append(record, strings.Join(values, multiValueSeparator))
+		}
+
+		return w.csvWriter.Write(record)
+	}
+
+	// Single value fields are encoded as strings, multi value fields as arrays
+	doc := map[string]any{}
+	for _, field := range w.fields {
+		values, _ := exportFieldValues(company, field)
+		if isMultiValueField(field) {
+			if values == nil {
+				values = []string{}
+			}
+			doc[field] = values
+		} else if len(values) > 0 {
+			doc[field] = values[0]
+		}
+	}
+
+	return w.jsonWriter.Encode(doc)
+}
+
+func (w *exportWriter) flush() error {
+	if w.csvWriter == nil {
+		return nil
+	}
+
+	w.csvWriter.Flush()
+	return w.csvWriter.Error()
+}
+
+func isMultiValueField(field string) bool {
+	return field == "all_available_names" || field == "phone_numbers"
+}
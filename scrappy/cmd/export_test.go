@@ -0,0 +1,192 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+)
+
+func TestExportFormat(t *testing.T) {
+	testCases := []struct {
+		format      string
+		outputPath  string
+		expected    string
+		expectedErr bool
+	}{
+		{expected: formatCSV},
+		{outputPath: "companies.csv", expected: formatCSV},
+		{outputPath: "companies.JSONL", expected: formatJSONL},
+		{format: "JSONL", outputPath: "companies.csv", expected: formatJSONL},
+		{format: "csv", outputPath: "companies.jsonl", expected: formatCSV},
+		{format: "xml", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format+" "+tc.outputPath, func(t *testing.T) {
+			format, err := exportFormat(tc.format, tc.outputPath)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Expected error %t, got %v", tc.expectedErr, err)
+			}
+			if format != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, format)
+			}
+		})
+	}
+}
+
+func TestCheckExportFields(t *testing.T) {
+	testCases := []struct {
+		fields      []string
+		expectedErr error
+	}{
+		{fields: defaultExportFields},
+		{fields: []string{"id", "attributes.country"}},
+		{fields: nil, expectedErr: ErrUnknownField},
+		{fields: []string{"domain", "revenue"}, expectedErr: ErrUnknownField},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.fields), func(t *testing.T) {
+			err := checkExportFields(tc.fields)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func exportTestCompanies() []*es.Company {
+	maz := &es.Company{ID: "mazautoglass.com", PhoneNumbers: []string{"+1 415-626-4474", "+1 415-626-4475"}}
+	maz.Domain = csv.JSONUrl{URL: &url.URL{Scheme: "https", Host: "mazautoglass.com"}}
+	maz.CommercialName = "MAZ Auto Glass"
+	maz.AllAvailableNames = []string{"MAZ Auto Glass", "MAZ, Glass"}
+	maz.Attributes = map[string]string{"country": "US"}
+
+	// Companies may be missing fields
+	empty := &es.Company{ID: "putitontheglass.com"}
+
+	return []*es.Company{maz, empty}
+}
+
+func TestExportWriter(t *testing.T) {
+	testCases := []struct {
+		format   string
+		fields   []string
+		expected string
+	}{
+		{
+			format: formatCSV,
+			fields: defaultExportFields,
+			expected: "domain,commercial_name,legal_name,all_available_names,phone_numbers\n" +
+				`https://mazautoglass.com,MAZ Auto Glass,,"MAZ Auto Glass|MAZ, Glass",+1 415-626-4474|+1 415-626-4475` + "\n" +
+				",,,,\n",
+		},
+		{
+			format:   formatCSV,
+			fields:   []string{"id", "attributes.country"},
+			expected: "id,attributes.country\nmazautoglass.com,US\nputitontheglass.com,\n",
+		},
+		{
+			format: formatJSONL,
+			fields: []string{"domain", "commercial_name", "phone_numbers", "attributes.country"},
+			expected: `{"attributes.country":"US","commercial_name":"MAZ Auto Glass","domain":"https://mazautoglass.com",` +
+				`"phone_numbers":["+1 415-626-4474","+1 415-626-4475"]}` + "\n" +
+				`{"phone_numbers":[]}` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format+" "+fmt.Sprint(tc.fields), func(t *testing.T) {
+			var out bytes.Buffer
+			writer := newExportWriter(&out, tc.format, tc.fields)
+
+			err := writer.writeHeader()
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			for _, company := range exportTestCompanies() {
+				err = writer.write(company)
+				if err != nil {
+					t.Fatalf("Unexpected error %s", err)
+				}
+			}
+			err = writer.flush()
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			if out.String() != tc.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tc.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestExportCompanies(t *testing.T) {
+	searches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/companies/_pit":
+			fmt.Fprint(w, `{"id": "pit-1"}`)
+		case "/_pit":
+			fmt.Fprint(w, `{"succeeded": true}`)
+		case "/_search":
+			searches++
+			if searches > 1 {
+				fmt.Fprint(w, `{"hits": {"hits": []}}`)
+				return
+			}
+			fmt.Fprint(w, `{"hits": {"hits": [
+				{"_id": "mazautoglass.com", "_source": {"domain": "https://mazautoglass.com", "commercial_name": "MAZ Auto Glass"}, "sort": [1]},
+				{"_id": "putitontheglass.com", "_source": {"domain": "https://putitontheglass.com"}, "sort": [2]}
+			]}}`)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client, err := es.NewClient(&es.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var out bytes.Buffer
+	err = exportCompanies(client, &out, formatCSV, []string{"domain", "commercial_name"}, &es.ExportOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	expected := "domain,commercial_name\nhttps://mazautoglass.com,MAZ Auto Glass\nhttps://putitontheglass.com,\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if searches != 2 {
+		t.Errorf("Expected 2 searches, got %d", searches)
+	}
+}
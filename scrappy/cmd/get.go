@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"context"
-	"examples/scrappy/internal/es"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -39,21 +38,15 @@ func init() {
 }
 
 func getCompanyAction(url string) error {
-	// Get ElasticSearch config
-	config, err := esConfig()
-	if err != nil {
-		return err
-	}
-
-	// Initialize a new ES client
-	client, err := es.NewClient(config)
+	companyStore, err := openCompanyStore()
 	if err != nil {
 		return err
 	}
+	defer companyStore.Close()
 
 	// Get company by domain url
 	ctx := context.Background()
-	company, err := client.GetCompany(ctx, url)
+	company, err := companyStore.GetCompany(ctx, url)
 	if err != nil {
 		return fmt.Errorf("failed to get company %q: %s", url, err)
 	}
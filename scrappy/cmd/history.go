@@ -0,0 +1,125 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"examples/scrappy/internal/es"
+
+	"github.com/spf13/cobra"
+)
+
+// Layout of scrape times in the history table
+const historyTimeFormat = "2006-01-02 15:04:05"
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:          "history <domain>",
+	Short:        "Show the scrape history of a company",
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+
+		limit, err := flags.GetInt(limitFlagKey)
+		if err != nil {
+			return err
+		}
+
+		format, err := flags.GetString(formatFlagKey)
+		if err != nil {
+			return err
+		}
+
+		return historyAction(args[0], limit, format)
+	},
+}
+
+func init() {
+	esCmd.AddCommand(historyCmd)
+
+	flags := historyCmd.Flags()
+	flags.Int(limitFlagKey, es.DefaultScrapeHistoryLimit, "number of scrapes to show, newest first")
+	flags.String(formatFlagKey, formatTable, "output format, table or json")
+}
+
+func historyAction(domain string, limit int, format string) error {
+	format = strings.ToLower(format)
+	if format != formatTable && format != formatJSON {
+		return fmt.Errorf("unsupported history format %q, expected table or json", format)
+	}
+
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	entries, err := client.ScrapeHistory(context.Background(), domain, limit)
+	if err != nil {
+		return err
+	}
+
+	if format == formatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No scrapes recorded for %q\n", domain)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCRAPED AT\tDURATION\tPAGES\tERRORS\tPHONE NUMBERS\tCHANGES")
+	for _, entry := range entries {
+		numbers := make([]string, 0, len(entry.PhoneNumbers))
+		for _, sighting := range entry.PhoneNumbers {
+			numbers = append(numbers, sighting.Number)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n",
+			entry.ScrapedAt.Local().Format(historyTimeFormat),
+			time.Duration(entry.DurationMillis)*time.Millisecond,
+			len(entry.PagesVisited),
+			len(entry.Errors),
+			strings.Join(numbers, ", "),
+			phoneNumberChanges(&entry))
+	}
+
+	return w.Flush()
+}
+
+// phoneNumberChanges formats the numbers added and removed by a scrape,
+// e.g. "added +1 617-491-1000, removed +1 212-555-0100".
+func phoneNumberChanges(entry *es.ScrapeHistoryEntry) string {
+	changes := []string{}
+	for _, number := range entry.Added {
+		changes = append(changes, "added "+number)
+	}
+	for _, number := range entry.Removed {
+		changes = append(changes, "removed "+number)
+	}
+
+	return strings.Join(changes, ", ")
+}
@@ -24,6 +24,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const (
+	overwriteFlagKey   = "overwrite"
+	maxFailuresFlagKey = "max-failures"
+)
+
 // indexCmd represents the index command
 var importCmd = &cobra.Command{
 	Use:          "import <csv file to load company info from>",
@@ -31,46 +36,95 @@ var importCmd = &cobra.Command{
 	SilenceUsage: true,
 	Args:         cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return importCompanies(args[0])
+		rejectsPath, err := cmd.Flags().GetString(rejectsFlagKey)
+		if err != nil {
+			return err
+		}
+
+		overwrite, err := cmd.Flags().GetBool(overwriteFlagKey)
+		if err != nil {
+			return err
+		}
+
+		deadLetterPath, err := cmd.Flags().GetString(deadLetterFlagKey)
+		if err != nil {
+			return err
+		}
+
+		maxFailures, err := cmd.Flags().GetInt(maxFailuresFlagKey)
+		if err != nil {
+			return err
+		}
+
+		options := es.BulkIndexOptions{Overwrite: overwrite}
+		return importCompanies(args[0], rejectsPath, deadLetterPath, maxFailures, &options)
 	},
 }
 
 func init() {
 	esCmd.AddCommand(importCmd)
+	addRejectsFlag(importCmd)
+
+	importCmd.Flags().Bool(overwriteFlagKey, false,
+		"replace existing companies, dropping scraped data such as phone numbers")
+	addDeadLetterFlag(importCmd, defaultImportDeadLetterPath)
+	importCmd.Flags().Int(maxFailuresFlagKey, 0,
+		"exit with an error if more than this many documents fail to be written")
 }
 
-func importCompanies(csvPath string) error {
+func importCompanies(csvPath string, rejectsPath string, deadLetterPath string,
+	maxFailures int, options *es.BulkIndexOptions) error {
+
 	if csvPath == "" {
 		return fmt.Errorf("missing csv file argument")
 	}
 
-	config, err := esConfig()
+	companyStore, err := openCompanyStore()
 	if err != nil {
 		return err
 	}
+	defer companyStore.Close()
 
-	client, err := es.NewClient(config)
+	schema, err := csvSchema()
 	if err != nil {
 		return err
 	}
 
 	// Load company info from CSV
-	companies, err := csv.LoadCompaniesFromFile(csvPath)
+	companies, err := schema.LoadCompaniesFromFile(csvPath)
+	if saveErr := saveRejects(rejectsPath, err); saveErr != nil {
+		return saveErr
+	}
 	if err != nil {
 		printExtraErrInfo(err)
 		return err
 	}
 
-	// Bulk index companies into ElasticSearch
-	stats, err := client.BulkIndexCompanies(companies)
+	// Collapse companies sharing the same registrable domain,
+	// since they would be indexed under the same document id
+	companies, duplicates := csv.DedupCompanies(companies)
+	printDuplicates(duplicates)
+
+	// Upsert companies into the store
+	stats, err := companyStore.BulkIndexCompanies(companies, options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created [%d], updated [%d], unchanged [%d] documents\n",
+		stats.Created, stats.Updated, stats.Unchanged)
+	if stats.Failed > 0 {
+		fmt.Printf("Failed to index [%d] documents\n", stats.Failed)
+	}
+
+	err = appendDeadLetter(deadLetterPath, stats.FailedItems)
 	if err != nil {
 		return err
 	}
 
-	if stats.NumFailed > 0 {
-		fmt.Printf("Indexed [%d] documents with [%d] errors\n", stats.NumFlushed, stats.NumFailed)
-	} else {
-		fmt.Printf("Successfully indexed [%d] documents\n", stats.NumFlushed)
+	if stats.Failed > maxFailures {
+		return fmt.Errorf("%w: %d documents failed, at most %d allowed by --%s",
+			ErrFailedItems, stats.Failed, maxFailures, maxFailuresFlagKey)
 	}
 
 	return nil
@@ -16,16 +16,21 @@ limitations under the License.
 package cmd
 
 import (
-	"examples/scrappy/internal/es"
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// Time to wait for the cluster to answer the connection check
+const infoTimeout = 10 * time.Second
+
 // infoCmd represents the info command
 var infoCmd = &cobra.Command{
 	Use:          "info",
-	Short:        "Show info about ES cluster",
+	Short:        "Check the connection to the ES cluster, and show info about it",
 	SilenceUsage: true,
 	Args:         cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -38,21 +43,21 @@ func init() {
 }
 
 func esInfoAction() error {
-	config, err := esConfig()
+	client, err := esClient()
 	if err != nil {
 		return err
 	}
 
-	client, err := es.NewClient(config)
-	if err != nil {
-		return err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), infoTimeout)
+	defer cancel()
 
-	response, err := client.Info()
+	info, err := client.CheckConnection(ctx)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(response)
+	fmt.Printf("Connected to %s\n", strings.Join(esAddresses(), ", "))
+	fmt.Printf("Cluster: %s (node %s)\n", info.ClusterName, info.Name)
+	fmt.Printf("Version: %s\n", info.Version.Number)
 	return nil
 }
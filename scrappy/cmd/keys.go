@@ -0,0 +1,140 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"examples/scrappy/internal/auth"
+
+	"github.com/spf13/cobra"
+)
+
+// API key options, shared by keys generate and es keys create
+const scopeFlagKey = "scope"
+const keyRateLimitFlagKey = "rate-limit"
+const keyBurstFlagKey = "burst"
+
+// keysCmd represents the keys command
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Commands for managing server API keys",
+}
+
+// keysGenerateCmd represents the keys generate command
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate <name>",
+	Short: "Generate an API key for the server keys file",
+	Long: `Generate an API key for the server keys file.
+
+The key is printed once, and must be given to the client,
+only its digest is added to the keys file, under the "keys" field.`,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, apiKey, err := newAPIKey(cmd, args[0])
+		if err != nil {
+			return err
+		}
+
+		printAPIKey(key)
+		fmt.Println("Keys file entry:")
+		fmt.Printf("  - name: %q\n", apiKey.Name)
+		fmt.Printf("    hash: %q\n", apiKey.Hash)
+		fmt.Printf("    scopes: [%s]\n", joinScopes(apiKey.Scopes))
+		if apiKey.RateLimit > 0 {
+			fmt.Printf("    rate_limit: %g\n", apiKey.RateLimit)
+		}
+		if apiKey.Burst > 0 {
+			fmt.Printf("    burst: %d\n", apiKey.Burst)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysGenerateCmd)
+	addAPIKeyFlags(keysGenerateCmd)
+}
+
+func addAPIKeyFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringSlice(scopeFlagKey, []string{string(auth.ScopeRead)}, "scopes granted to the key, read or admin")
+	flags.Float64(keyRateLimitFlagKey, 0, "requests per second allowed, the server default if 0")
+	flags.Int(keyBurstFlagKey, 0, "requests allowed at once, above the rate limit")
+}
+
+// newAPIKey generates a key, with the options read from the command flags.
+func newAPIKey(cmd *cobra.Command, name string) (string, *auth.APIKey, error) {
+	flags := cmd.Flags()
+
+	scopeNames, err := flags.GetStringSlice(scopeFlagKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	scopes, err := auth.ParseScopes(scopeNames)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rateLimit, err := flags.GetFloat64(keyRateLimitFlagKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	burst, err := flags.GetInt(keyBurstFlagKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, hash, err := auth.GenerateKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	apiKey := &auth.APIKey{
+		Name:      name,
+		Hash:      hash,
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+		Burst:     burst,
+	}
+
+	err = apiKey.Validate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return key, apiKey, nil
+}
+
+func printAPIKey(key string) {
+	fmt.Printf("API key: %s\n", key)
+	fmt.Println("The key isn't stored, keep it now, it can't be shown again.")
+	fmt.Println()
+}
+
+func joinScopes(scopes []auth.Scope) string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the companies index versions",
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listIndicesAction()
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(listCmd)
+}
+
+func listIndicesAction() error {
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	indices, err := client.ListCompanyIndices(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tHEALTH\tSTATUS\tDOCS\tSIZE\tALIAS")
+	for _, index := range indices {
+		alias := ""
+		if index.Current {
+			alias = "*"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", index.Name, index.Health,
+			index.Status, index.DocsCount, index.StoreSize, alias)
+	}
+
+	return w.Flush()
+}
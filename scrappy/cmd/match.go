@@ -0,0 +1,154 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"examples/scrappy/internal/es"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	nameFlagKey           = "name"
+	websiteFlagKey        = "website"
+	facebookFlagKey       = "facebook"
+	nameWeightFlagKey     = "name-weight"
+	phoneWeightFlagKey    = "phone-weight"
+	websiteWeightFlagKey  = "website-weight"
+	facebookWeightFlagKey = "facebook-weight"
+)
+
+// matchCmd represents the match command
+var matchCmd = &cobra.Command{
+	Use:   "match",
+	Short: "Find the companies best matching a partial company record",
+	Long: `Find the companies best matching a partial company record.
+
+Any of the name, phone number, website and Facebook page can be provided,
+candidates matching more of them, or matching them more closely, rank higher.`,
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		match, err := matchQueryFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		return matchCompanyAction(match)
+	},
+}
+
+func init() {
+	esCmd.AddCommand(matchCmd)
+
+	flags := matchCmd.Flags()
+	flags.String(nameFlagKey, "", "company name")
+	flags.String(phoneFlagKey, "", "company phone number")
+	flags.String(websiteFlagKey, "", "company website")
+	flags.String(facebookFlagKey, "", "company Facebook page url")
+	flags.Int(limitFlagKey, es.DefaultMatchLimit, "maximum number of candidates returned")
+	addMatchWeightFlags(matchCmd)
+}
+
+// addMatchWeightFlags adds a flag for the weight of each match signal.
+func addMatchWeightFlags(cmd *cobra.Command) {
+	weights := es.DefaultMatchWeights()
+
+	flags := cmd.Flags()
+	flags.Float64(nameWeightFlagKey, weights.Name, "weight of the name signal")
+	flags.Float64(phoneWeightFlagKey, weights.Phone, "weight of the phone number signal")
+	flags.Float64(websiteWeightFlagKey, weights.Website, "weight of the website signal")
+	flags.Float64(facebookWeightFlagKey, weights.Facebook, "weight of the Facebook page signal")
+}
+
+// matchWeightsFromFlags reads the flags added by addMatchWeightFlags.
+func matchWeightsFromFlags(cmd *cobra.Command) (*es.MatchWeights, error) {
+	var weights es.MatchWeights
+
+	weightFlags := map[string]*float64{
+		nameWeightFlagKey:     &weights.Name,
+		phoneWeightFlagKey:    &weights.Phone,
+		websiteWeightFlagKey:  &weights.Website,
+		facebookWeightFlagKey: &weights.Facebook,
+	}
+	for key, value := range weightFlags {
+		var err error
+		*value, err = cmd.Flags().GetFloat64(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &weights, nil
+}
+
+func matchQueryFromFlags(cmd *cobra.Command) (*es.MatchQuery, error) {
+	flags := cmd.Flags()
+
+	var match es.MatchQuery
+	var err error
+
+	stringFlags := map[string]*string{
+		nameFlagKey:     &match.Name,
+		phoneFlagKey:    &match.Phone,
+		websiteFlagKey:  &match.Website,
+		facebookFlagKey: &match.Facebook,
+	}
+	for key, value := range stringFlags {
+		*value, err = flags.GetString(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	match.Limit, err = flags.GetInt(limitFlagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	match.Weights, err = matchWeightsFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &match, nil
+}
+
+func matchCompanyAction(match *es.MatchQuery) error {
+	companyStore, err := openCompanyStore()
+	if err != nil {
+		return err
+	}
+	defer companyStore.Close()
+
+	ctx := context.Background()
+	result, err := companyStore.MatchCompany(ctx, match)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d candidates found\n\n", len(result.Candidates))
+	for index := range result.Candidates {
+		fmt.Printf("#%d\n", index+1)
+		printCompanyResult(&result.Candidates[index])
+		fmt.Println()
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	minScoreFlagKey  = "min-score"
+	batchSizeFlagKey = "batch-size"
+)
+
+// matchFileCmd represents the match-file command
+var matchFileCmd = &cobra.Command{
+	Use:   "match-file <csv file of partial company records>",
+	Short: "Match a CSV file of partial company records against ElasticSearch",
+	Long: `Match a CSV file of partial company records against ElasticSearch.
+
+Records can have name, phone, website and facebook columns, see "es match".
+Every record is written to the output CSV, along with the domain, name and score
+of its best candidate, and its match status (match, no_match or error).
+Invalid lines are written too, with the error status.`,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+
+		outputPath, err := flags.GetString(outputFlagKey)
+		if err != nil {
+			return err
+		}
+
+		rejectsPath, err := flags.GetString(rejectsFlagKey)
+		if err != nil {
+			return err
+		}
+
+		minScore, err := flags.GetFloat64(minScoreFlagKey)
+		if err != nil {
+			return err
+		}
+
+		batchSize, err := flags.GetInt(batchSizeFlagKey)
+		if err != nil {
+			return err
+		}
+
+		numWorkers, err := flags.GetInt("workers")
+		if err != nil {
+			return err
+		}
+
+		weights, err := matchWeightsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		options := es.BatchMatchOptions{BatchSize: batchSize, NumWorkers: numWorkers}
+		return matchFileAction(args[0], outputPath, rejectsPath, minScore, weights, &options)
+	},
+}
+
+func init() {
+	esCmd.AddCommand(matchFileCmd)
+	addRejectsFlag(matchFileCmd)
+
+	flags := matchFileCmd.Flags()
+	flags.StringP(outputFlagKey, "o", "", "file to write match results to (defaults to stdout)")
+	flags.Float64(minScoreFlagKey, 0, "minimum score of the best candidate for a record to match")
+	flags.Int(batchSizeFlagKey, 100, "number of records matched by each multi search request")
+	flags.Int("workers", 4, "number of concurrent multi search requests")
+	addMatchWeightFlags(matchFileCmd)
+}
+
+func matchFileAction(csvPath string, outputPath string, rejectsPath string, minScore float64,
+	weights *es.MatchWeights, options *es.BatchMatchOptions) error {
+	companyStore, err := openCompanyStore()
+	if err != nil {
+		return err
+	}
+	defer companyStore.Close()
+
+	// Load partial company records from CSV,
+	// records without any signal are reported, the others are still matched
+	records, err := csv.LoadMatchRecordsFromFile(csvPath)
+	if saveErr := saveRejects(rejectsPath, err); saveErr != nil {
+		return saveErr
+	}
+	if err != nil {
+		printExtraErrInfo(err)
+		if records == nil {
+			return err
+		}
+	}
+
+	// Invalid lines are written to the output too, with an error outcome
+	var invalidLines csv.ErrInvalidCSVLines
+	errors.As(err, &invalidLines)
+
+	matches := make([]es.MatchQuery, 0, len(records.Records))
+	for index := range records.Records {
+		matches = append(matches, es.NewMatchQuery(&records.Records[index], weights))
+	}
+
+	ctx := context.Background()
+	results := companyStore.MatchCompanies(ctx, matches, options)
+
+	outcomes := make([]csv.MatchOutcome, 0, len(results))
+	for index := range results {
+		outcomes = append(outcomes, results[index].Outcome(minScore))
+	}
+
+	rows, outcomes := records.WithInvalidLines(outcomes, invalidLines)
+	err = writeMatchResults(outputPath, records.Header, rows, outcomes)
+	if err != nil {
+		return err
+	}
+
+	printMatchSummary(csv.NewMatchSummary(outcomes))
+	return nil
+}
+
+// writeMatchResults writes the match results CSV to the output file, or to stdout if no path is given.
+func writeMatchResults(outputPath string, header []string, rows []csv.MatchRecord, outcomes []csv.MatchOutcome) error {
+	if outputPath == "" {
+		return csv.WriteMatchResultsCSV(os.Stdout, header, rows, outcomes)
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+
+	err = csv.WriteMatchResultsCSV(file, header, rows, outcomes)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+
+	// Buffered writes may only fail once the file is closed
+	return closeErr
+}
+
+func printMatchSummary(summary csv.MatchSummary) {
+	fmt.Fprintf(os.Stderr, "\nMatched %d of %d records (%.1f%%)\n",
+		summary.Matched, summary.Total, summary.MatchRate)
+	fmt.Fprintf(os.Stderr, "    no match: %d\n", summary.NoMatch)
+	fmt.Fprintf(os.Stderr, "    errors: %d\n", summary.Errors)
+}
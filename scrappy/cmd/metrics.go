@@ -0,0 +1,131 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/metrics"
+	"examples/scrappy/internal/web"
+)
+
+// Metrics flags of the batch commands (scrape, check domains)
+const (
+	metricsAddrFlagKey = "metrics-addr"
+	metricsPushFlagKey = "metrics-push"
+)
+
+// Interval between pushes to the Pushgateway while a command runs
+const metricsPushInterval = 15 * time.Second
+
+// esObserver is set on the config of the ES clients, nil unless metrics are enabled.
+var esObserver es.Observer
+
+func addMetricsFlags(cmd *cobra.Command) {
+	cmd.Flags().String(metricsAddrFlagKey, "",
+		"expose metrics on this address while running, e.g. :9100")
+	cmd.Flags().String(metricsPushFlagKey, "",
+		"push metrics to this Prometheus Pushgateway URL while running, and once done")
+}
+
+// startCommandMetrics collects the scrape, domain check and ES metrics of a batch command,
+// if enabled by the metrics flags. It must be called before the store is opened.
+//
+// The returned function stops exposing the metrics, and pushes them a last time.
+func startCommandMetrics(cmd *cobra.Command, job string) (func(), error) {
+	addr, err := cmd.Flags().GetString(metricsAddrFlagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pushURL, err := cmd.Flags().GetString(metricsPushFlagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr == "" && pushURL == "" {
+		return func() {}, nil
+	}
+
+	commandMetrics := metrics.New()
+	web.SetObserver(commandMetrics)
+	esObserver = commandMetrics
+
+	var stops []func()
+
+	if addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expose metrics: %w", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", commandMetrics.Handler())
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go server.Serve(listener)
+
+		log.Printf("Exposing metrics on http://%s/metrics\n", listener.Addr())
+		stops = append(stops, func() { server.Close() })
+	}
+
+	if pushURL != "" {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+
+			ticker := time.NewTicker(metricsPushInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					pushMetrics(commandMetrics, pushURL, job)
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		stops = append(stops, func() {
+			close(done)
+			<-stopped
+			pushMetrics(commandMetrics, pushURL, job)
+		})
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}, nil
+}
+
+// pushMetrics logs push failures, which shouldn't fail the command.
+func pushMetrics(commandMetrics *metrics.Metrics, url string, job string) {
+	err := commandMetrics.Push(url, job)
+	if err != nil {
+		log.Printf("ERROR: Failed to push metrics to %s: %s\n", url, err)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+const planFlagKey = "plan"
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the companies index to the current mapping version",
+	Long: `Compare the mapping version recorded in the current companies index
+with the current mapping, and apply the missing migration steps.
+
+Additive changes (new fields) are applied to the index in place,
+other changes require a reindex into a new index version (see reindex).`,
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		planOnly, err := cmd.Flags().GetBool(planFlagKey)
+		if err != nil {
+			return err
+		}
+
+		return migrateAction(planOnly)
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().Bool(planFlagKey, false, "only print the migration steps, without applying them")
+}
+
+func migrateAction(planOnly bool) error {
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	plan, err := client.PlanCompanyIndexMigration(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(plan.Steps) == 0 {
+		fmt.Printf("%s is up to date, mapping version %d\n", plan.Index, plan.FromVersion)
+		return nil
+	}
+
+	fmt.Printf("%s mapping version %d, current version %d\n", plan.Index, plan.FromVersion, plan.ToVersion)
+	for _, step := range plan.Steps {
+		change := "update mapping"
+		if step.Reindex {
+			change = "reindex"
+		}
+		fmt.Printf("  %d. %s (%s)\n", step.Version, step.Description, change)
+	}
+
+	if planOnly {
+		if plan.Reindex {
+			fmt.Println("Migration requires a reindex into a new index version")
+		}
+		return nil
+	}
+
+	result, err := client.MigrateCompanyIndex(ctx, plan)
+	if err != nil {
+		return err
+	}
+
+	if result.Reindexed != nil {
+		fmt.Printf("Reindexed %d documents from %q to %q, alias swapped\n",
+			result.Reindexed.Count, result.Reindexed.Source, result.Reindexed.Dest)
+		return nil
+	}
+
+	fmt.Printf("Updated %s mapping to version %d\n", plan.Index, plan.ToVersion)
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// reindexCmd represents the reindex command
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Reindex companies into a new index version using the current mapping",
+	Long: `Create a new version of the companies index using the current mapping,
+copy every company into it, and swap the companies alias once the
+document counts of both indices match.
+
+Imports and scrapes should not run while reindexing, since documents written
+to the old index after the copy started would not be copied.`,
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reindexAction()
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(reindexCmd)
+}
+
+func reindexAction() error {
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	result, err := client.ReindexCompanies(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reindexed %d documents from %q to %q, alias swapped\n",
+		result.Count, result.Source, result.Dest)
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"examples/scrappy/internal/es"
+
+	"github.com/spf13/cobra"
+)
+
+const deadLetterFlagKey = "dead-letter"
+
+// Dead-letter files written when bulk items fail, unless configured otherwise.
+// Each command has its own file, so a run doesn't replace the failures of another command.
+const (
+	defaultImportDeadLetterPath = "./failed-import.jsonl"
+	defaultScrapeDeadLetterPath = "./failed-scrape.jsonl"
+)
+
+var ErrFailedItems = errors.New("failed to write documents")
+
+// retryFailedCmd represents the retry-failed command
+var retryFailedCmd = &cobra.Command{
+	Use:   "retry-failed <dead-letter file>",
+	Short: "Resubmit the failed items of a dead-letter file to ElasticSearch",
+	Long: `Resubmit the items of a dead-letter file, written by import and scrape
+when documents fail to be written, to ElasticSearch.
+
+Items failing again are written back to the dead-letter file, with their new reason,
+or appended to the --dead-letter file if set. The retried file is removed once
+none of its items are left.`,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deadLetterPath, err := cmd.Flags().GetString(deadLetterFlagKey)
+		if err != nil {
+			return err
+		}
+
+		return retryFailedAction(args[0], deadLetterPath)
+	},
+}
+
+func init() {
+	esCmd.AddCommand(retryFailedCmd)
+	retryFailedCmd.Flags().String(deadLetterFlagKey, "",
+		"write items failing again to this JSON Lines file (default the retried file)")
+}
+
+func addDeadLetterFlag(cmd *cobra.Command, defaultPath string) {
+	cmd.Flags().String(deadLetterFlagKey, defaultPath,
+		"append documents which failed to be written to this JSON Lines file, retry them using es retry-failed")
+}
+
+func retryFailedAction(path string, deadLetterPath string) error {
+	items, err := es.LoadFailedItemsFromFile(path)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		fmt.Printf("No failed items in %s\n", path)
+		return nil
+	}
+
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	stats, err := client.RetryFailedItems(context.Background(), items)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Resubmitted %d item(s): %d succeeded, %d failed\n", len(items), stats.Succeeded, stats.Failed)
+
+	// The retried file only keeps the items still failing, unless they are moved to another dead-letter file
+	if deadLetterPath == "" || deadLetterPath == path {
+		err = replaceDeadLetter(path, stats.FailedItems)
+	} else {
+		err = appendDeadLetter(deadLetterPath, stats.FailedItems)
+		if err == nil {
+			err = replaceDeadLetter(path, nil)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if stats.Failed > 0 {
+		return fmt.Errorf("%w: %d item(s) failed again", ErrFailedItems, stats.Failed)
+	}
+
+	return nil
+}
+
+// appendDeadLetter appends the failed items of a run to the dead-letter file.
+//
+// Failures of previous runs are kept, until they are resubmitted using es retry-failed.
+func appendDeadLetter(path string, items []es.FailedItem) error {
+	if path == "" || len(items) == 0 {
+		return nil
+	}
+
+	err := es.AppendFailedItemsToFile(path, items)
+	if err != nil {
+		return fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Appended %d failed item(s) to %s\n", len(items), path)
+	return nil
+}
+
+// replaceDeadLetter replaces the items of a retried dead-letter file with the ones still failing.
+//
+// The file is removed once no items are left, so they aren't resubmitted again.
+func replaceDeadLetter(path string, items []es.FailedItem) error {
+	if len(items) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove dead-letter file: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Removed retried dead-letter file %s\n", path)
+		return nil
+	}
+
+	err := es.SaveFailedItemsToFile(path, items)
+	if err != nil {
+		return fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %d failed item(s) to %s\n", len(items), path)
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"examples/scrappy/internal/es"
+)
+
+func TestDeadLetterFiles(t *testing.T) {
+	failed := []es.FailedItem{{ID: "example.com", Action: "update", Body: []byte(`{"doc":{}}`)}}
+	previous := []es.FailedItem{{ID: "example.org", Action: "update", Body: []byte(`{"doc":{}}`)}}
+
+	testCases := []struct {
+		name     string
+		save     func(path string) error
+		expected []string
+	}{
+		{
+			name:     "append keeps previous failures",
+			save:     func(path string) error { return appendDeadLetter(path, failed) },
+			expected: []string{"example.org", "example.com"},
+		},
+		{
+			name:     "clean run keeps previous failures",
+			save:     func(path string) error { return appendDeadLetter(path, nil) },
+			expected: []string{"example.org"},
+		},
+		{
+			name:     "retried file keeps items failing again",
+			save:     func(path string) error { return replaceDeadLetter(path, failed) },
+			expected: []string{"example.com"},
+		},
+		{
+			name: "retried file is removed once no items are left",
+			save: func(path string) error { return replaceDeadLetter(path, nil) },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "failed.jsonl")
+			err := es.SaveFailedItemsToFile(path, previous)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			err = tc.save(path)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			items, err := es.LoadFailedItemsFromFile(path)
+			if tc.expected == nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("Expected the file to be removed, got %v instead", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			ids := make([]string, 0, len(items))
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.expected) {
+				t.Errorf("Expected items %v, got %v instead", tc.expected, ids)
+			}
+		})
+	}
+}
@@ -54,7 +54,8 @@ func init() {
 	// Read config flags from env or CLI flags
 	replacer := strings.NewReplacer("-", "_")
 	viper.SetEnvKeyReplacer(replacer)
-	viper.SetEnvPrefix("SCRAPPY_")
+	// Viper joins the prefix and keys with "_", e.g. SCRAPPY_ES_PASSWORD
+	viper.SetEnvPrefix("SCRAPPY")
 }
 
 // initConfig reads in config file and ENV variables if set.
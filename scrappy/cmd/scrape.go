@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -41,73 +42,199 @@ var scrapeCmd = &cobra.Command{
 			return err
 		}
 
-		return scrapeDomainsAction(csvPath, numWorkers)
+		rejectsPath, err := cmd.Flags().GetString(rejectsFlagKey)
+		if err != nil {
+			return err
+		}
+
+		deadLetterPath, err := cmd.Flags().GetString(deadLetterFlagKey)
+		if err != nil {
+			return err
+		}
+
+		options, err := phoneNumbersWriterOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		stopMetrics, err := startCommandMetrics(cmd, "scrappy_scrape")
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+
+		return scrapeDomainsAction(csvPath, numWorkers, rejectsPath, deadLetterPath, options)
 	},
 }
 
+const (
+	staleAfterFlagKey        = "stale-after"
+	bulkWorkersFlagKey       = "bulk-workers"
+	bulkFlushBytesFlagKey    = "bulk-flush-bytes"
+	bulkFlushIntervalFlagKey = "bulk-flush-interval"
+	bulkRetriesFlagKey       = "bulk-retries"
+)
+
 func init() {
 	rootCmd.AddCommand(scrapeCmd)
 
 	scrapeCmd.Flags().Int("workers", runtime.NumCPU()*20,
 		"number of concurrent workers (defaults to 20 * NumCPUs)")
+	addRejectsFlag(scrapeCmd)
+	addDeadLetterFlag(scrapeCmd, defaultScrapeDeadLetterPath)
+	addMetricsFlags(scrapeCmd)
+	scrapeCmd.Flags().Duration(staleAfterFlagKey, es.DefaultPhoneStaleAfter,
+		"mark phone numbers not found for this long as stale")
 
+	scrapeCmd.Flags().Int(bulkWorkersFlagKey, runtime.NumCPU(),
+		"number of concurrent ElasticSearch bulk requests")
+	scrapeCmd.Flags().Int(bulkFlushBytesFlagKey, 5*1024*1024,
+		"send a bulk request once this many bytes of updates are queued")
+	scrapeCmd.Flags().Duration(bulkFlushIntervalFlagKey, 30*time.Second,
+		"send a bulk request at least this often")
+	scrapeCmd.Flags().Int(bulkRetriesFlagKey, es.DefaultBulkRetries,
+		"number of times failed updates are retried")
+}
+
+func phoneNumbersWriterOptions(cmd *cobra.Command) (*es.PhoneNumbersWriterOptions, error) {
+	flags := cmd.Flags()
+
+	staleAfter, err := flags.GetDuration(staleAfterFlagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	numWorkers, err := flags.GetInt(bulkWorkersFlagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	flushBytes, err := flags.GetInt(bulkFlushBytesFlagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	flushInterval, err := flags.GetDuration(bulkFlushIntervalFlagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRetries, err := flags.GetInt(bulkRetriesFlagKey)
+	if err != nil {
+		return nil, err
+	}
+	if maxRetries == 0 {
+		// Zero retries means no retries for the flag, but the default for the options
+		maxRetries = -1
+	}
+
+	return &es.PhoneNumbersWriterOptions{
+		NumWorkers:    numWorkers,
+		FlushBytes:    flushBytes,
+		FlushInterval: flushInterval,
+		MaxRetries:    maxRetries,
+		StaleAfter:    staleAfter,
+	}, nil
 }
 
 type scrapeResult struct {
 	// Number of domains for which we have collected phone numbers
 	phoneNumbersCollected int
+	// Outcome of the ElasticSearch updates
+	updates *es.BulkUpdateStats
+	// Outcome of the scrape history writes, nil if the store doesn't record history
+	history *es.ScrapeHistoryStats
+}
+
+// scrapeHistoryRecorder is implemented by stores recording every scrape,
+// currently only the ElasticSearch store.
+type scrapeHistoryRecorder interface {
+	NewScrapeHistoryWriter(ctx context.Context) (*es.ScrapeHistoryWriter, error)
 }
 
-func scrapeDomainsAction(csvPath string, numWorkers int) error {
-	// Get ElasticSearch config
-	config, err := esConfig()
+func scrapeDomainsAction(csvPath string, numWorkers int, rejectsPath string, deadLetterPath string,
+	options *es.PhoneNumbersWriterOptions) error {
+
+	companyStore, err := openCompanyStore()
 	if err != nil {
 		return err
 	}
+	defer companyStore.Close()
 
-	// Initialize a new ES client
-	client, err := es.NewClient(config)
+	// Load website URLs from CSV file
+	urls, err := loadDomainUrls(csvPath, rejectsPath)
 	if err != nil {
 		return err
 	}
 
-	// Load website URLs from CSV file
-	urls, err := loadDomainUrls(csvPath)
+	// Updates are sent in bulk, so ES latency doesn't slow down the scrape
+	writer, err := companyStore.NewPhoneNumbersWriter(options)
 	if err != nil {
 		return err
 	}
 
 	var stats scrapeResult
+	ctx := context.Background()
+
+	// Updates which couldn't be queued, counted as failed updates
+	queueFailures := 0
+
+	// Every scrape, failed ones included, is recorded in the scrape history
+	var history *es.ScrapeHistoryWriter
+	if recorder, ok := companyStore.(scrapeHistoryRecorder); ok {
+		history, err = recorder.NewScrapeHistoryWriter(ctx)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Scrape domains and handle each job result.
 	web.ScrapeDomains(urls, numWorkers, func(result *web.ScrapeJobResult) {
+		if history != nil {
+			err := history.Add(ctx, newScrapeRecord(result))
+			if err != nil {
+				log.Printf("ERROR: Failed to queue scrape history of %q: %s", result.Url, err)
+			}
+		}
+
 		if result.Err != nil {
 			log.Printf("Failed request to domain %q: %q\n", result.Url, result.Err)
 			return
 		}
 
-		companyInfo := map[string]any{}
-
 		url, info := result.Url, result.Info
 		if len(info.PhoneNumbers) > 0 {
 			stats.phoneNumbersCollected++
-			companyInfo["phone_numbers"] = collectPhoneNumbers(info.PhoneNumbers)
 		}
 
-		// If we have new company information, update it in ElasticSearch
-		if len(companyInfo) > 0 {
-			ctx := context.Background()
-			fmt.Printf("Updating %q %#v\n", url, companyInfo)
-			err := client.UpdateCompanyInfo(ctx, url, companyInfo)
-			if err != nil {
-				log.Printf("ERROR: Failed to update company info: %s", err)
-			}
-			log.Printf("Updated info for %q, %#v\n", url, companyInfo)
+		// Merge the numbers into the stored ones, even if none were found,
+		// so numbers no longer on the pages visited eventually become stale
+		sightings := collectPhoneSightings(info.PhoneNumbers)
+		err := writer.Add(ctx, url, sightings, info.LinksVisited)
+		if err != nil {
+			log.Printf("ERROR: Failed to queue company info update for %q: %s", url, err)
+			queueFailures++
+			return
 		}
+
+		log.Printf("Queued phone numbers update for %q, %v\n", url, sightings)
 	})
 
+	stats.updates, err = writer.Close(ctx)
+	if err != nil {
+		return err
+	}
+	stats.updates.Failed += queueFailures
+
+	if history != nil {
+		stats.history, err = history.Close(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	printScrapeResultStats(&stats)
-	return nil
+	return appendDeadLetter(deadLetterPath, stats.updates.FailedItems)
 }
 
 func printScrapeResultStats(stats *scrapeResult) {
@@ -115,13 +242,50 @@ func printScrapeResultStats(stats *scrapeResult) {
 		fmt.Printf("Collected phone numbers for %d domain(s)\n",
 			stats.phoneNumbersCollected)
 	}
+
+	updates := stats.updates
+	fmt.Printf("Updated %d companies, %d unchanged, %d not found, %d failed\n",
+		updates.Updated, updates.Unchanged, updates.NotFound, updates.Failed)
+	if updates.Retried > 0 {
+		fmt.Printf("Retried %d failed update(s)\n", updates.Retried)
+	}
+
+	if stats.history != nil {
+		fmt.Printf("Recorded %d scrape(s) in history, %d failed\n",
+			stats.history.Recorded, stats.history.Failed)
+	}
+}
+
+// newScrapeRecord converts a scrape result into its scrape history record.
+func newScrapeRecord(result *web.ScrapeJobResult) *es.ScrapeRecord {
+	info := result.Info
+
+	record := &es.ScrapeRecord{
+		URL:            result.Url,
+		ScrapedAt:      info.StartedAt,
+		DurationMillis: info.Duration.Milliseconds(),
+		PagesVisited:   info.LinksVisited,
+		PhoneNumbers:   collectPhoneSightings(info.PhoneNumbers),
+		Statuses:       make([]es.PageStatus, 0, len(info.Statuses)),
+		Errors:         info.Errors,
+	}
+
+	for _, status := range info.Statuses {
+		record.Statuses = append(record.Statuses, es.PageStatus{URL: status.URL, Status: status.Status})
+	}
+
+	return record
 }
 
-func collectPhoneNumbers(phoneNumbers []phone.Phone) []string {
-	results := make([]string, 0, len(phoneNumbers))
+func collectPhoneSightings(phoneNumbers []phone.Phone) []es.PhoneSighting {
+	results := make([]es.PhoneSighting, 0, len(phoneNumbers))
 
 	for _, phone := range phoneNumbers {
-		results = append(results, phone.Number)
+		results = append(results, es.PhoneSighting{
+			Number:     phone.Number,
+			Source:     phone.Source,
+			Confidence: phone.Confidence,
+		})
 	}
 
 	return results
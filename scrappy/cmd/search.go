@@ -18,13 +18,23 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"examples/scrappy/internal/es"
 
 	"github.com/spf13/cobra"
 )
 
-const phoneFlagKey = "phone"
+const (
+	phoneFlagKey   = "phone"
+	limitFlagKey   = "limit"
+	cursorFlagKey  = "cursor"
+	explainFlagKey = "explain"
+)
+
+// Depth of the score explanation tree printed for each company
+const maxExplanationDepth = 4
 
 // searchCmd represents the search command
 var searchCmd = &cobra.Command{
@@ -38,37 +48,54 @@ var searchCmd = &cobra.Command{
 			query = args[0]
 		}
 
-		phone, err := cmd.Flags().GetString(phoneFlagKey)
+		flags := cmd.Flags()
+
+		phone, err := flags.GetString(phoneFlagKey)
+		if err != nil {
+			return err
+		}
+
+		limit, err := flags.GetInt(limitFlagKey)
+		if err != nil {
+			return err
+		}
+
+		cursor, err := flags.GetString(cursorFlagKey)
+		if err != nil {
+			return err
+		}
+
+		explain, err := flags.GetBool(explainFlagKey)
 		if err != nil {
 			return err
 		}
 
-		return searchCompany(query, phone)
+		options := es.SearchOptions{Limit: limit, Cursor: cursor, Explain: explain}
+		return searchCompany(query, phone, &options)
 	},
 }
 
 func init() {
 	esCmd.AddCommand(searchCmd)
 
-	searchCmd.Flags().String(phoneFlagKey, "", "phone number to search by")
+	flags := searchCmd.Flags()
+	flags.String(phoneFlagKey, "", "phone number to search by")
+	flags.Int(limitFlagKey, es.DefaultSearchLimit,
+		fmt.Sprintf("maximum number of companies returned (at most %d)", es.MaxSearchLimit))
+	flags.String(cursorFlagKey, "", "cursor of the results page to return, printed after the previous page")
+	flags.Bool(explainFlagKey, false, "show how the score of each company was computed")
 }
 
-func searchCompany(query string, phone string) error {
-	// Get ElasticSearch config
-	config, err := esConfig()
-	if err != nil {
-		return err
-	}
-
-	// Initialize a new ES client
-	client, err := es.NewClient(config)
+func searchCompany(query string, phone string, options *es.SearchOptions) error {
+	companyStore, err := openCompanyStore()
 	if err != nil {
 		return err
 	}
+	defer companyStore.Close()
 
 	// Search for company
 	ctx := context.Background()
-	result, err := client.SearchCompany(ctx, query, phone)
+	result, err := companyStore.SearchCompany(ctx, query, phone, options)
 	if err != nil {
 		return err
 	}
@@ -83,11 +110,59 @@ func printSearchCompaniesResult(query string, result *es.SearchCompaniesResult)
 		printCompanyResult(&company)
 		fmt.Println()
 	}
+
+	if result.Next != "" {
+		fmt.Printf("More results available, use --cursor %s\n", result.Next)
+	}
 }
 
 func printCompanyResult(company *es.Company) {
 	printCompanyInfo(&company.Company)
 	printCompanyPhoneNumbers(company.PhoneNumbers)
+	printCompanyPhoneHistory(company.PhoneHistory)
+	printSearchMatch(company.SearchMatch)
+}
+
+func printSearchMatch(match *es.SearchMatch) {
+	if match == nil {
+		return
+	}
+
+	fmt.Printf("Score: %.3f\n", match.Score)
+	if len(match.MatchedQueries) > 0 {
+		fmt.Println("Matched:", strings.Join(match.MatchedQueries, ", "))
+	}
+
+	// Sort field names, so they are always shown in the same order
+	fields := make([]string, 0, len(match.Highlights))
+	for field := range match.Highlights {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	if len(fields) > 0 {
+		fmt.Println("Highlights:")
+	}
+	for _, field := range fields {
+		fmt.Printf("    %s: %s\n", field, strings.Join(match.Highlights[field], " | "))
+	}
+
+	if match.Explanation != nil {
+		fmt.Println("Explanation:")
+		printExplanation(match.Explanation, 1)
+	}
+}
+
+func printExplanation(explanation *es.Explanation, depth int) {
+	fmt.Printf("%s%.3f %s\n", strings.Repeat("    ", depth), explanation.Value, explanation.Description)
+
+	if depth == maxExplanationDepth {
+		return
+	}
+
+	for index := range explanation.Details {
+		printExplanation(&explanation.Details[index], depth+1)
+	}
 }
 
 func printCompanyPhoneNumbers(phoneNumbers []string) {
@@ -99,3 +174,25 @@ func printCompanyPhoneNumbers(phoneNumbers []string) {
 		fmt.Println("    -", phoneNumber)
 	}
 }
+
+// Format of the dates shown in the phone history
+const dateFormat = "2006-01-02"
+
+func printCompanyPhoneHistory(history []es.PhoneRecord) {
+	if len(history) > 0 {
+		fmt.Println("Phone history:")
+	}
+
+	for _, record := range history {
+		stale := ""
+		if record.Stale {
+			stale = ", stale"
+		}
+
+		fmt.Printf("    - %s (seen %d time(s), first %s, last %s%s)\n", record.Number, record.TimesSeen,
+			record.FirstSeen.Format(dateFormat), record.LastSeen.Format(dateFormat), stale)
+		for _, source := range record.Sources {
+			fmt.Println("        ", source)
+		}
+	}
+}
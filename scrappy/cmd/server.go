@@ -16,13 +16,23 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/auth"
+	"examples/scrappy/internal/metrics"
 	"examples/scrappy/internal/server"
+	"examples/scrappy/internal/store"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -40,6 +50,36 @@ const defaultHost = "localhost"
 const timeoutFlagKey = "timeout"
 const defaultTimeout = 10000 // milliseconds
 
+// Default time allowed for in-flight requests to complete on shutdown
+const shutdownTimeoutFlagKey = "shutdown_timeout"
+const defaultShutdownTimeout = 15000 // milliseconds
+
+// API key authentication, one of authNone, authFile or authElastic
+const authFlagKey = "auth"
+const (
+	authNone    = "none"
+	authFile    = "file"
+	authElastic = "elastic"
+)
+
+// Keys file, for file authentication
+const apiKeysFileFlagKey = "api_keys_file"
+const defaultAPIKeysFile = "./api_keys.yaml"
+
+// Requests per second and burst of keys without their own limits
+const rateLimitFlagKey = "rate_limit"
+const defaultRateLimit = 10.0
+const rateBurstFlagKey = "rate_burst"
+const defaultRateBurst = 20
+
+// Audit log file, standard error if empty
+const auditLogFlagKey = "audit_log"
+
+// How long keys stored in ES are cached, revoked keys are accepted until they expire
+const apiKeysCacheTTL = time.Minute
+
+var ErrInvalidAuthConfig = errors.New("invalid authentication config")
+
 // serverCmd represents the server command
 var serverCmd = &cobra.Command{
 	Use:          "server",
@@ -53,7 +93,10 @@ var serverCmd = &cobra.Command{
 		timeoutMillis := viper.GetInt(timeoutFlagKey)
 		timeout := time.Duration(timeoutMillis) * time.Millisecond
 
-		return serverAction(host, port, timeout)
+		shutdownMillis := viper.GetInt(shutdownTimeoutFlagKey)
+		shutdownTimeout := time.Duration(shutdownMillis) * time.Millisecond
+
+		return serverAction(host, port, timeout, shutdownTimeout)
 	},
 }
 
@@ -75,26 +118,229 @@ func init() {
 	timeoutUsage := fmt.Sprintf("Request timeout in milliseconds (default %d)", defaultTimeout)
 	serverCmd.Flags().Int(timeoutFlagKey, defaultTimeout, timeoutUsage)
 	viper.BindPFlag(timeoutFlagKey, serverCmd.Flags().Lookup(timeoutFlagKey))
+
+	// Shutdown timeout
+	shutdownUsage := fmt.Sprintf("Time allowed for in-flight requests to complete on shutdown, in milliseconds (default %d)",
+		defaultShutdownTimeout)
+	serverCmd.Flags().Int(shutdownTimeoutFlagKey, defaultShutdownTimeout, shutdownUsage)
+	viper.BindPFlag(shutdownTimeoutFlagKey, serverCmd.Flags().Lookup(shutdownTimeoutFlagKey))
+
+	// Authentication
+	authUsage := fmt.Sprintf("API key authentication: %s, %s (keys file) or %s (keys stored in ES)",
+		authNone, authFile, authElastic)
+	serverCmd.Flags().String(authFlagKey, authNone, authUsage)
+	viper.BindPFlag(authFlagKey, serverCmd.Flags().Lookup(authFlagKey))
+
+	serverCmd.Flags().String(apiKeysFileFlagKey, defaultAPIKeysFile, "API keys file, for file authentication")
+	viper.BindPFlag(apiKeysFileFlagKey, serverCmd.Flags().Lookup(apiKeysFileFlagKey))
+
+	serverCmd.Flags().Float64(rateLimitFlagKey, defaultRateLimit,
+		"Requests per second allowed for keys without their own rate limit, 0 for no limit")
+	viper.BindPFlag(rateLimitFlagKey, serverCmd.Flags().Lookup(rateLimitFlagKey))
+
+	serverCmd.Flags().Int(rateBurstFlagKey, defaultRateBurst,
+		"Requests allowed at once for keys without their own rate limit")
+	viper.BindPFlag(rateBurstFlagKey, serverCmd.Flags().Lookup(rateBurstFlagKey))
+
+	serverCmd.Flags().String(auditLogFlagKey, "", "File logging which API key made each request (default standard error)")
+	viper.BindPFlag(auditLogFlagKey, serverCmd.Flags().Lookup(auditLogFlagKey))
 }
 
-func serverAction(host string, port int, timeout time.Duration) error {
-	// Get ElasticSearch config
-	config, err := esConfig()
+func serverAction(host string, port int, timeout time.Duration, shutdownTimeout time.Duration) error {
+	// Collect the ES request metrics of the store, and of the elastic API keys lookups
+	serverMetrics := metrics.New()
+	esObserver = serverMetrics
+
+	companyStore, err := openCompanyStore()
 	if err != nil {
 		return err
 	}
+	defer companyStore.Close()
 
-	// Initialize a new ES client
-	client, err := es.NewClient(config)
+	options, closeAuditLog, err := serverOptions()
 	if err != nil {
 		return err
 	}
+	defer closeAuditLog()
+
+	options.Metrics = serverMetrics
+	options.MetricsHandler = serverMetrics.Handler()
+
+	if options.Keys == nil && !isLoopbackHost(host) {
+		log.Printf("Warning: authentication is disabled, anyone reaching %s can query the server, see --%s\n",
+			host, authFlagKey)
+	}
 
 	// Initialize server
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
-	server := server.NewServer(addr, timeout, client)
+	server := server.NewServer(addr, timeout, companyStore, options)
+	logServerConfig(timeout, shutdownTimeout)
+
+	// Stop on SIGINT or SIGTERM, a second signal stops immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Listening on %s\n", addr)
+
+	return serve(ctx, server, listener, shutdownTimeout)
+}
+
+// serve serves requests until the context is done,
+// then waits up to the shutdown timeout for in-flight requests to complete.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, shutdownTimeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections, and wait for in-flight requests to complete
+	log.Printf("Shutting down, waiting up to %s for in-flight requests\n", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		server.Close()
+		return fmt.Errorf("failed to complete in-flight requests: %w", err)
+	}
+
+	err = <-serveErr
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	log.Println("Server stopped")
+	return nil
+}
+
+// logServerConfig logs the configuration the server started with, leaving out secrets.
+func logServerConfig(timeout time.Duration, shutdownTimeout time.Duration) {
+	backend := viper.GetString(storeFlagKey)
+	switch backend {
+	case store.BackendSQLite:
+		log.Printf("Store: %s %s\n", backend, viper.GetString(sqlitePathFlagKey))
+	case store.BackendElastic, "":
+		log.Printf("Store: %s %s\n", store.BackendElastic, strings.Join(esAddresses(), ", "))
+	default:
+		log.Printf("Store: %s\n", backend)
+	}
+
+	mode := viper.GetString(authFlagKey)
+	switch mode {
+	case authFile:
+		log.Printf("Authentication: %s %s\n", mode, viper.GetString(apiKeysFileFlagKey))
+	default:
+		log.Printf("Authentication: %s\n", mode)
+	}
+	if mode != authNone {
+		auditLog := viper.GetString(auditLogFlagKey)
+		if auditLog == "" {
+			auditLog = "standard error"
+		}
+		log.Printf("Default rate limit: %g requests/s, burst %d, audit log: %s\n",
+			viper.GetFloat64(rateLimitFlagKey), viper.GetInt(rateBurstFlagKey), auditLog)
+	}
+
+	log.Printf("Request timeout: %s, shutdown timeout: %s\n", timeout, shutdownTimeout)
+}
+
+// serverOptions configures the authentication selected by the auth flag,
+// the returned function closes the audit log file.
+func serverOptions() (*server.Options, func(), error) {
+	options := &server.Options{}
+	noop := func() {}
+
+	switch mode := viper.GetString(authFlagKey); mode {
+	case authNone, "":
+		return options, noop, nil
+	case authFile:
+		keyring, err := loadAPIKeysFile(viper.GetString(apiKeysFileFlagKey))
+		if err != nil {
+			return nil, nil, err
+		}
+		options.Keys = keyring
+		log.Printf("Loaded %d API keys\n", keyring.Len())
+	case authElastic:
+		client, err := esClient()
+		if err != nil {
+			return nil, nil, err
+		}
+		options.Keys = auth.NewCachedProvider(client, apiKeysCacheTTL)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown %s %q, use %s, %s or %s",
+			ErrInvalidAuthConfig, authFlagKey, mode, authNone, authFile, authElastic)
+	}
+
+	rate := viper.GetFloat64(rateLimitFlagKey)
+	burst := viper.GetInt(rateBurstFlagKey)
+	if rate < 0 || burst < 0 {
+		return nil, nil, fmt.Errorf("%w: %s and %s must not be negative",
+			ErrInvalidAuthConfig, rateLimitFlagKey, rateBurstFlagKey)
+	}
+	options.RateLimiter = auth.NewRateLimiter(rate, burst)
+
+	path := viper.GetString(auditLogFlagKey)
+	if path == "" {
+		options.AuditLog = log.New(os.Stderr, "audit: ", log.LstdFlags|log.LUTC)
+		return options, noop, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	options.AuditLog = log.New(file, "", log.LstdFlags|log.LUTC)
+
+	return options, func() { file.Close() }, nil
+}
+
+// loadAPIKeysFile loads the keys listed in a YAML, JSON or TOML file, under the "keys" field.
+func loadAPIKeysFile(path string) (*auth.Keyring, error) {
+	keysConfig := viper.New()
+	keysConfig.SetConfigFile(path)
+
+	err := keysConfig.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read API keys file: %s", ErrInvalidAuthConfig, err)
+	}
+
+	var keys []auth.APIKey
+	err = keysConfig.UnmarshalKey("keys", &keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidAuthConfig, path, err)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s: no keys found", ErrInvalidAuthConfig, path)
+	}
+
+	keyring, err := auth.NewKeyring(keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidAuthConfig, path, err)
+	}
+
+	return keyring, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
 
-	// Listen for HTTP requests
-	fmt.Printf("Listening on %s\n", addr)
-	return server.ListenAndServe()
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
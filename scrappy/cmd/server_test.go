@@ -0,0 +1,95 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeShutdown(t *testing.T) {
+	testCases := []struct {
+		name            string
+		delay           time.Duration
+		shutdownTimeout time.Duration
+		expectedErr     bool
+	}{
+		{name: "in-flight request drained", delay: 100 * time.Millisecond, shutdownTimeout: time.Second},
+		{name: "grace period exceeded", delay: time.Second, shutdownTimeout: 50 * time.Millisecond, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			started := make(chan struct{})
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(tc.delay)
+				io.WriteString(w, "done")
+			})}
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			serveErr := make(chan error, 1)
+			go func() {
+				serveErr <- serve(ctx, server, listener, tc.shutdownTimeout)
+			}()
+
+			type response struct {
+				status int
+				body   string
+				err    error
+			}
+			responses := make(chan response, 1)
+			go func() {
+				res, err := http.Get("http://" + listener.Addr().String())
+				if err != nil {
+					responses <- response{err: err}
+					return
+				}
+				defer res.Body.Close()
+				body, err := io.ReadAll(res.Body)
+				responses <- response{status: res.StatusCode, body: string(body), err: err}
+			}()
+
+			// Shut down while the request is in flight
+			<-started
+			cancel()
+
+			err = <-serveErr
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Expected error %t, got %v", tc.expectedErr, err)
+			}
+
+			res := <-responses
+			if tc.expectedErr {
+				return
+			}
+			if res.err != nil || res.status != http.StatusOK || res.body != "done" {
+				t.Errorf("Expected the in-flight request to complete, got %d %q %v", res.status, res.body, res.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"examples/scrappy/internal/es"
+
+	"github.com/spf13/cobra"
+)
+
+// Supported stats formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:          "stats",
+	Short:        "Show statistics about the companies data",
+	SilenceUsage: true,
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := cmd.Flags().GetString(formatFlagKey)
+		if err != nil {
+			return err
+		}
+
+		return statsAction(format)
+	},
+}
+
+func init() {
+	esCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().String(formatFlagKey, formatTable, "output format, table or json")
+}
+
+func statsAction(format string) error {
+	format = strings.ToLower(format)
+	if format != formatTable && format != formatJSON {
+		return fmt.Errorf("unsupported stats format %q, expected table or json", format)
+	}
+
+	client, err := esClient()
+	if err != nil {
+		return err
+	}
+
+	stats, err := client.CompanyStats(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if format == formatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+
+	return printStats(os.Stdout, stats)
+}
+
+func printStats(out io.Writer, stats *es.CompanyStats) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Companies:\t%d\n", stats.Total)
+
+	fmt.Fprintln(w, "\nFIELD\tCOMPANIES\tFILL RATE")
+	for _, rate := range stats.FillRates {
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\n", rate.Field, rate.Count, rate.Rate*100)
+	}
+
+	sections := []struct {
+		header  string
+		buckets []es.StatsBucket
+	}{
+		{header: "PHONE NUMBERS\tCOMPANIES", buckets: stats.PhoneCounts},
+		{header: "TLD\tCOMPANIES", buckets: stats.TLDs},
+		{header: "PHONE CONFIDENCE\tPHONE NUMBERS", buckets: stats.PhoneConfidence},
+		{header: "LAST SCRAPED\tCOMPANIES", buckets: stats.ScrapeFreshness},
+	}
+
+	for _, section := range sections {
+		fmt.Fprintf(w, "\n%s\n", section.header)
+		for _, bucket := range section.buckets {
+			fmt.Fprintf(w, "%s\t%d\n", bucket.Key, bucket.Count)
+		}
+	}
+
+	return w.Flush()
+}
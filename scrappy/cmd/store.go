@@ -0,0 +1,46 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"examples/scrappy/internal/store"
+
+	"github.com/spf13/viper"
+)
+
+// Storage backend configuration
+const storeFlagKey = "store"
+const sqlitePathFlagKey = "sqlite_path"
+
+func init() {
+	rootCmd.PersistentFlags().String(storeFlagKey, store.BackendElastic,
+		"storage backend for companies: elastic or sqlite")
+	viper.BindPFlag(storeFlagKey, rootCmd.PersistentFlags().Lookup(storeFlagKey))
+
+	rootCmd.PersistentFlags().String(sqlitePathFlagKey, store.DefaultSQLitePath,
+		"SQLite database file, used by the sqlite store")
+	viper.BindPFlag(sqlitePathFlagKey, rootCmd.PersistentFlags().Lookup(sqlitePathFlagKey))
+}
+
+// openCompanyStore opens the storage backend selected by the config,
+// the ElasticSearch config is only needed by the elastic store.
+func openCompanyStore() (store.CompanyStore, error) {
+	return store.New(&store.Config{
+		Backend:       viper.GetString(storeFlagKey),
+		SQLitePath:    viper.GetString(sqlitePathFlagKey),
+		ElasticConfig: esConfig,
+	})
+}
@@ -18,7 +18,6 @@ package cmd
 import (
 	"context"
 	"encoding/json"
-	"examples/scrappy/internal/es"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -40,17 +39,11 @@ func init() {
 }
 
 func updateCompanyAction(id string, key string, encodedValue string) error {
-	// Get ElasticSearch config
-	config, err := esConfig()
-	if err != nil {
-		return err
-	}
-
-	// Initialize a new ES client
-	client, err := es.NewClient(config)
+	companyStore, err := openCompanyStore()
 	if err != nil {
 		return err
 	}
+	defer companyStore.Close()
 
 	// JSON decode value
 	var value interface{}
@@ -66,7 +59,7 @@ func updateCompanyAction(id string, key string, encodedValue string) error {
 
 	// Update company info
 	ctx := context.Background()
-	err = client.UpdateCompanyInfo(ctx, id, doc)
+	err = companyStore.UpdateCompanyInfo(ctx, id, doc)
 	if err != nil {
 		return fmt.Errorf("failed to update company info: %s", err)
 	}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Clients of the server authenticate using API keys.
+// Only the SHA256 digest of each key is stored, either in a keys file, or in ES,
+// so the keys can't be recovered from the stored configuration.
+
+// Scope is a set of routes a key can call.
+type Scope string
+
+const (
+	// Company search, lookup and match routes
+	ScopeRead Scope = "read"
+	// Every route, including dataset-wide operations
+	ScopeAdmin Scope = "admin"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown API key")
+	ErrInvalidKey = errors.New("invalid API key")
+)
+
+// Prefix of generated keys, so they're easy to recognize, e.g. when leaked in a config file
+const keyPrefix = "scrappy_"
+
+// Random bytes of generated keys
+const keyBytes = 32
+
+// APIKey describes a client allowed to call the server.
+type APIKey struct {
+	// Name of the client, written to the audit log
+	Name string `json:"name" mapstructure:"name"`
+	// Hex encoded SHA256 digest of the key, see HashKey
+	Hash   string  `json:"hash" mapstructure:"hash"`
+	Scopes []Scope `json:"scopes" mapstructure:"scopes"`
+	// Sustained requests per second, the server default if 0
+	RateLimit float64 `json:"rate_limit,omitempty" mapstructure:"rate_limit"`
+	// Requests allowed at once, if 0 the server default is used for keys without a rate limit,
+	// or the rate limit rounded up
+	Burst int `json:"burst,omitempty" mapstructure:"burst"`
+}
+
+// KeyProvider looks up API keys by the digest of the key,
+// returning ErrUnknownKey if no such key exists.
+type KeyProvider interface {
+	LookupKey(ctx context.Context, hash string) (*APIKey, error)
+}
+
+// Allows checks if the key grants the scope, the admin scope grants every scope.
+func (k *APIKey) Allows(scope Scope) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks the key has a name, a valid digest and known scopes.
+func (k *APIKey) Validate() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidKey)
+	}
+
+	digest, err := hex.DecodeString(k.Hash)
+	if err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("%w: %s: hash must be a hex encoded SHA256 digest", ErrInvalidKey, k.Name)
+	}
+
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("%w: %s: missing scopes", ErrInvalidKey, k.Name)
+	}
+	for _, scope := range k.Scopes {
+		if scope != ScopeRead && scope != ScopeAdmin {
+			return fmt.Errorf("%w: %s: unknown scope %q", ErrInvalidKey, k.Name, scope)
+		}
+	}
+
+	if k.RateLimit < 0 || k.Burst < 0 {
+		return fmt.Errorf("%w: %s: rate limit and burst must not be negative", ErrInvalidKey, k.Name)
+	}
+
+	return nil
+}
+
+// ParseScopes parses scope names, e.g. from command line flags.
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		scope := Scope(strings.ToLower(strings.TrimSpace(name)))
+		if scope != ScopeRead && scope != ScopeAdmin {
+			return nil, fmt.Errorf("%w: unknown scope %q, use %s or %s", ErrInvalidKey, name, ScopeRead, ScopeAdmin)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, nil
+}
+
+// GenerateKey returns a new random key, which must be given to the client,
+// and its digest, which is stored.
+func GenerateKey() (key string, hash string, err error) {
+	var random [keyBytes]byte
+	_, err = rand.Read(random[:])
+	if err != nil {
+		return "", "", err
+	}
+
+	key = keyPrefix + hex.EncodeToString(random[:])
+	return key, HashKey(key), nil
+}
+
+// HashKey returns the hex encoded SHA256 digest of a key.
+func HashKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testHash = HashKey("scrappy_test")
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		key           APIKey
+		expectedError bool
+	}{
+		{name: "valid", key: APIKey{Name: "reports", Hash: testHash, Scopes: []Scope{ScopeRead}}},
+		{name: "valid with limits", key: APIKey{Name: "reports", Hash: testHash, Scopes: []Scope{ScopeAdmin}, RateLimit: 0.5, Burst: 2}},
+		{name: "missing name", key: APIKey{Hash: testHash, Scopes: []Scope{ScopeRead}}, expectedError: true},
+		{name: "plain key instead of hash", key: APIKey{Name: "reports", Hash: "scrappy_test", Scopes: []Scope{ScopeRead}}, expectedError: true},
+		{name: "short hash", key: APIKey{Name: "reports", Hash: testHash[:32], Scopes: []Scope{ScopeRead}}, expectedError: true},
+		{name: "missing scopes", key: APIKey{Name: "reports", Hash: testHash}, expectedError: true},
+		{name: "unknown scope", key: APIKey{Name: "reports", Hash: testHash, Scopes: []Scope{"write"}}, expectedError: true},
+		{name: "negative rate", key: APIKey{Name: "reports", Hash: testHash, Scopes: []Scope{ScopeRead}, RateLimit: -1}, expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.key.Validate()
+			if tc.expectedError != (err != nil) {
+				t.Errorf("Expected error %t, got %v instead", tc.expectedError, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Expected %v, got %v instead", ErrInvalidKey, err)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	testCases := []struct {
+		name     string
+		scopes   []Scope
+		scope    Scope
+		expected bool
+	}{
+		{name: "read key reads", scopes: []Scope{ScopeRead}, scope: ScopeRead, expected: true},
+		{name: "read key can't administer", scopes: []Scope{ScopeRead}, scope: ScopeAdmin, expected: false},
+		{name: "admin key reads", scopes: []Scope{ScopeAdmin}, scope: ScopeRead, expected: true},
+		{name: "admin key administers", scopes: []Scope{ScopeAdmin}, scope: ScopeAdmin, expected: true},
+		{name: "no scopes", scopes: nil, scope: ScopeRead, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := APIKey{Name: "reports", Scopes: tc.scopes}
+			if key.Allows(tc.scope) != tc.expected {
+				t.Errorf("Expected %v to allow %s: %t", tc.scopes, tc.scope, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"read", " Admin "})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(scopes) != 2 || scopes[0] != ScopeRead || scopes[1] != ScopeAdmin {
+		t.Errorf("Expected [read admin], got %v instead", scopes)
+	}
+
+	_, err = ParseScopes([]string{"write"})
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected %v, got %v instead", ErrInvalidKey, err)
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, hash, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if !strings.HasPrefix(key, keyPrefix) {
+		t.Errorf("Expected key prefix %q, got %q instead", keyPrefix, key)
+	}
+	if hash != HashKey(key) {
+		t.Errorf("Expected hash %q, got %q instead", HashKey(key), hash)
+	}
+
+	other, _, _ := GenerateKey()
+	if other == key {
+		t.Errorf("Expected different keys, got %q twice", key)
+	}
+}
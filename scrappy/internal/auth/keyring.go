@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Keyring holds the keys loaded from a keys file.
+type Keyring struct {
+	keys map[string]*APIKey
+}
+
+// NewKeyring validates the keys, which must have unique names and digests.
+func NewKeyring(keys []APIKey) (*Keyring, error) {
+	keyring := &Keyring{keys: map[string]*APIKey{}}
+	names := map[string]bool{}
+
+	for index := range keys {
+		key := keys[index]
+		err := key.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if names[key.Name] {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrInvalidKey, key.Name)
+		}
+		if _, found := keyring.keys[key.Hash]; found {
+			return nil, fmt.Errorf("%w: %s: duplicate hash", ErrInvalidKey, key.Name)
+		}
+
+		names[key.Name] = true
+		keyring.keys[key.Hash] = &key
+	}
+
+	return keyring, nil
+}
+
+// LookupKey returns the key with the given digest.
+func (k *Keyring) LookupKey(ctx context.Context, hash string) (*APIKey, error) {
+	key, found := k.keys[hash]
+	if !found {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// Len returns the number of keys.
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// CachedProvider caches the keys returned by a provider, so they aren't looked up on every request.
+//
+// Unknown keys are cached too, revoked keys are valid until their cache entry expires.
+// Unknown keys are kept apart, so clients sending random keys can't flush the cached valid keys.
+type CachedProvider struct {
+	provider KeyProvider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]cachedKey
+	unknown map[string]time.Time
+}
+
+type cachedKey struct {
+	key     *APIKey
+	expires time.Time
+}
+
+// Maximum number of cached keys, and of cached unknown keys, each cache is cleared once full
+const maxCachedKeys = 10000
+
+// NewCachedProvider caches the keys of the provider for the ttl.
+func NewCachedProvider(provider KeyProvider, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		keys:     map[string]cachedKey{},
+		unknown:  map[string]time.Time{},
+	}
+}
+
+// LookupKey returns the cached key, or looks it up using the provider.
+//
+// Lookup failures, other than unknown keys, aren't cached.
+func (c *CachedProvider) LookupKey(ctx context.Context, hash string) (*APIKey, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	entry, found := c.keys[hash]
+	unknownUntil, unknown := c.unknown[hash]
+	c.mu.Unlock()
+
+	if found && now.Before(entry.expires) {
+		return entry.key, nil
+	}
+	if unknown && now.Before(unknownUntil) {
+		return nil, ErrUnknownKey
+	}
+
+	key, err := c.provider.LookupKey(ctx, hash)
+	if err != nil && !errors.Is(err, ErrUnknownKey) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := now.Add(c.ttl)
+	if err != nil {
+		if len(c.unknown) >= maxCachedKeys {
+			c.unknown = map[string]time.Time{}
+		}
+		delete(c.keys, hash)
+		c.unknown[hash] = expires
+		return nil, err
+	}
+
+	if len(c.keys) >= maxCachedKeys {
+		c.keys = map[string]cachedKey{}
+	}
+	delete(c.unknown, hash)
+	c.keys[hash] = cachedKey{key: key, expires: expires}
+
+	return key, nil
+}
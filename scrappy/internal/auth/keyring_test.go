@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewKeyring(t *testing.T) {
+	reports := APIKey{Name: "reports", Hash: HashKey("scrappy_reports"), Scopes: []Scope{ScopeRead}}
+	admin := APIKey{Name: "admin", Hash: HashKey("scrappy_admin"), Scopes: []Scope{ScopeAdmin}}
+
+	testCases := []struct {
+		name          string
+		keys          []APIKey
+		expectedError bool
+	}{
+		{name: "no keys", keys: nil},
+		{name: "unique keys", keys: []APIKey{reports, admin}},
+		{name: "invalid key", keys: []APIKey{reports, {Name: "broken"}}, expectedError: true},
+		{name: "duplicate name", keys: []APIKey{reports, {Name: "reports", Hash: admin.Hash, Scopes: admin.Scopes}}, expectedError: true},
+		{name: "duplicate hash", keys: []APIKey{reports, {Name: "other", Hash: reports.Hash, Scopes: admin.Scopes}}, expectedError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyring, err := NewKeyring(tc.keys)
+			if tc.expectedError {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Expected %v, got %v instead", ErrInvalidKey, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if keyring.Len() != len(tc.keys) {
+				t.Errorf("Expected %d keys, got %d instead", len(tc.keys), keyring.Len())
+			}
+
+			for _, expected := range tc.keys {
+				key, err := keyring.LookupKey(context.Background(), expected.Hash)
+				if err != nil || key.Name != expected.Name {
+					t.Errorf("Expected key %q, got %v, %v instead", expected.Name, key, err)
+				}
+			}
+
+			_, err = keyring.LookupKey(context.Background(), HashKey("scrappy_unknown"))
+			if !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("Expected %v, got %v instead", ErrUnknownKey, err)
+			}
+		})
+	}
+}
+
+// countingProvider counts lookups, failing while err is set.
+type countingProvider struct {
+	keyring *Keyring
+	lookups int
+	err     error
+}
+
+func (p *countingProvider) LookupKey(ctx context.Context, hash string) (*APIKey, error) {
+	p.lookups++
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return p.keyring.LookupKey(ctx, hash)
+}
+
+func TestCachedProvider(t *testing.T) {
+	reports := APIKey{Name: "reports", Hash: HashKey("scrappy_reports"), Scopes: []Scope{ScopeRead}}
+	keyring, err := NewKeyring([]APIKey{reports})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	provider := &countingProvider{keyring: keyring}
+	now := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	cached := NewCachedProvider(provider, time.Minute)
+	cached.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	unknown := HashKey("scrappy_unknown")
+	expectLookups := func(step string, expected int) {
+		t.Helper()
+		if provider.lookups != expected {
+			t.Errorf("%s: expected %d lookups, got %d instead", step, expected, provider.lookups)
+		}
+	}
+
+	key, err := cached.LookupKey(ctx, reports.Hash)
+	if err != nil || key.Name != reports.Name {
+		t.Fatalf("Expected key %q, got %v, %v instead", reports.Name, key, err)
+	}
+	cached.LookupKey(ctx, reports.Hash)
+	expectLookups("cached key", 1)
+
+	_, err = cached.LookupKey(ctx, unknown)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected %v, got %v instead", ErrUnknownKey, err)
+	}
+	_, err = cached.LookupKey(ctx, unknown)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected cached %v, got %v instead", ErrUnknownKey, err)
+	}
+	expectLookups("cached unknown key", 2)
+
+	// Failures aren't cached
+	now = now.Add(2 * time.Minute)
+	provider.err = errors.New("cluster unavailable")
+	_, err = cached.LookupKey(ctx, reports.Hash)
+	if !errors.Is(err, provider.err) {
+		t.Errorf("Expected %v, got %v instead", provider.err, err)
+	}
+	provider.err = nil
+	key, err = cached.LookupKey(ctx, reports.Hash)
+	if err != nil || key.Name != reports.Name {
+		t.Errorf("Expected key %q, got %v, %v instead", reports.Name, key, err)
+	}
+	expectLookups("expired key", 4)
+
+	// Random unknown keys don't flush the cached valid keys
+	for index := 0; index <= maxCachedKeys; index++ {
+		cached.LookupKey(ctx, HashKey(fmt.Sprintf("scrappy_random_%d", index)))
+	}
+	cached.LookupKey(ctx, reports.Hash)
+	expectLookups("flooded cache", 4+maxCachedKeys+1)
+}
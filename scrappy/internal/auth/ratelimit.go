@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the requests of each key, using a token bucket per key.
+//
+// Each bucket holds up to burst tokens, refilled at the rate limit,
+// and every request takes a token.
+//
+// https://en.wikipedia.org/wiki/Token_bucket
+type RateLimiter struct {
+	// Used for keys without their own limits, and for clients, no limit if 0
+	defaultRate  float64
+	defaultBurst int
+	now          func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	rate    float64
+	burst   int
+}
+
+// Maximum number of buckets, full buckets are dropped once reached,
+// since a full bucket is the same as a missing one
+const maxRateLimitBuckets = 10000
+
+// NewRateLimiter returns a limiter using the defaults for keys without their own rate limit.
+//
+// A burst of 0 allows as many requests at once as the rate, and at least one.
+func NewRateLimiter(defaultRate float64, defaultBurst int) *RateLimiter {
+	return &RateLimiter{
+		defaultRate:  defaultRate,
+		defaultBurst: defaultBurst,
+		now:          time.Now,
+		buckets:      map[string]*tokenBucket{},
+	}
+}
+
+// Allow takes a token from the bucket of the key, if the request is denied,
+// it returns the time to wait for the next token.
+func (l *RateLimiter) Allow(key *APIKey) (bool, time.Duration) {
+	rate, burst := key.RateLimit, key.Burst
+	if rate == 0 {
+		rate = l.defaultRate
+		if burst == 0 {
+			burst = l.defaultBurst
+		}
+	}
+
+	// Key names are unique
+	return l.take(key.Name, rate, burst, true)
+}
+
+// Check returns true if the bucket of a client, e.g. a remote address, has a token,
+// without taking it, otherwise it returns the time to wait for the next token.
+// Clients use the default limits.
+func (l *RateLimiter) Check(client string) (bool, time.Duration) {
+	return l.take(client, l.defaultRate, l.defaultBurst, false)
+}
+
+// Take takes a token from the bucket of a client, if there is one, e.g. to count a failed request.
+func (l *RateLimiter) Take(client string) {
+	l.take(client, l.defaultRate, l.defaultBurst, true)
+}
+
+// take refills the bucket of name, and takes a token from it if there is one and consume is set.
+func (l *RateLimiter) take(name string, rate float64, burst int, consume bool) (bool, time.Duration) {
+	if rate <= 0 {
+		return true, 0
+	}
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, found := l.buckets[name]
+	if !found {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.dropFullBuckets(now)
+		}
+		bucket = &tokenBucket{tokens: float64(burst), updated: now}
+		l.buckets[name] = bucket
+	}
+
+	bucket.refill(now, rate, burst)
+
+	if bucket.tokens >= 1 {
+		if consume {
+			bucket.tokens--
+		}
+		return true, 0
+	}
+
+	wait := (1 - bucket.tokens) / rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+	b.updated = now
+	b.rate, b.burst = rate, burst
+}
+
+func (l *RateLimiter) dropFullBuckets(now time.Time) {
+	for name, bucket := range l.buckets {
+		bucket.refill(now, bucket.rate, bucket.burst)
+		if bucket.tokens >= float64(bucket.burst) {
+			delete(l.buckets, name)
+		}
+	}
+}
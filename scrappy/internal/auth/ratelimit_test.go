@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	type request struct {
+		// Time since the first request
+		at           time.Duration
+		expected     bool
+		expectedWait time.Duration
+	}
+
+	testCases := []struct {
+		name     string
+		key      APIKey
+		requests []request
+	}{
+		{
+			name: "key limits",
+			key:  APIKey{Name: "reports", RateLimit: 2, Burst: 2},
+			requests: []request{
+				{at: 0, expected: true},
+				{at: 0, expected: true},
+				{at: 0, expected: false, expectedWait: 500 * time.Millisecond},
+				{at: 250 * time.Millisecond, expected: false, expectedWait: 250 * time.Millisecond},
+				{at: 500 * time.Millisecond, expected: true},
+				{at: 500 * time.Millisecond, expected: false, expectedWait: 500 * time.Millisecond},
+				// The bucket holds at most burst tokens
+				{at: 10 * time.Second, expected: true},
+				{at: 10 * time.Second, expected: true},
+				{at: 10 * time.Second, expected: false, expectedWait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "default limits",
+			key:  APIKey{Name: "reports"},
+			requests: []request{
+				{at: 0, expected: true},
+				{at: 0, expected: false, expectedWait: time.Second},
+				{at: time.Second, expected: true},
+			},
+		},
+		{
+			name: "burst defaults to rate",
+			key:  APIKey{Name: "reports", RateLimit: 3},
+			requests: []request{
+				{at: 0, expected: true},
+				{at: 0, expected: true},
+				{at: 0, expected: true},
+				{at: 0, expected: false, expectedWait: time.Second / 3},
+			},
+		},
+	}
+
+	start := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var now time.Time
+			limiter := NewRateLimiter(1, 1)
+			limiter.now = func() time.Time { return now }
+
+			for index, req := range tc.requests {
+				now = start.Add(req.at)
+				allowed, wait := limiter.Allow(&tc.key)
+				if allowed != req.expected || wait != req.expectedWait {
+					t.Errorf("Request %d: expected %t, %s, got %t, %s instead",
+						index, req.expected, req.expectedWait, allowed, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	limiter := NewRateLimiter(0, 0)
+	key := APIKey{Name: "reports"}
+
+	for index := 0; index < 100; index++ {
+		allowed, _ := limiter.Allow(&key)
+		if !allowed {
+			t.Fatalf("Request %d: expected no limit", index)
+		}
+	}
+}
+
+func TestRateLimiterClients(t *testing.T) {
+	var now time.Time
+	limiter := NewRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	steps := []struct {
+		// Time since the first step
+		at time.Duration
+		// Takes a token, e.g. for a failed request, before checking
+		take         bool
+		expected     bool
+		expectedWait time.Duration
+	}{
+		// Checks don't take tokens
+		{at: 0, expected: true},
+		{at: 0, expected: true},
+		{at: 0, take: true, expected: true},
+		{at: 0, take: true, expected: false, expectedWait: time.Second},
+		// Taking from an empty bucket doesn't push back the next token
+		{at: 500 * time.Millisecond, take: true, expected: false, expectedWait: 500 * time.Millisecond},
+		{at: time.Second, expected: true},
+	}
+
+	start := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	for index, step := range steps {
+		now = start.Add(step.at)
+		if step.take {
+			limiter.Take("10.0.0.7")
+		}
+
+		allowed, wait := limiter.Check("10.0.0.7")
+		if allowed != step.expected || wait != step.expectedWait {
+			t.Errorf("Step %d: expected %t, %s, got %t, %s instead",
+				index, step.expected, step.expectedWait, allowed, wait)
+		}
+	}
+
+	// Other clients have their own bucket
+	if allowed, _ := limiter.Check("10.0.0.8"); !allowed {
+		t.Errorf("Expected other clients to be allowed")
+	}
+}
+
+func TestRateLimiterDropsFullBuckets(t *testing.T) {
+	now := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	for index := 0; index < maxRateLimitBuckets; index++ {
+		limiter.Take(fmt.Sprintf("client-%d", index))
+	}
+
+	// Once refilled, full buckets are dropped to make room for new clients
+	now = now.Add(time.Second)
+	limiter.Take("new-client")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected full buckets to be dropped, got %d buckets", len(limiter.buckets))
+	}
+}
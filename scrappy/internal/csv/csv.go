@@ -2,7 +2,6 @@
 package csv
 
 import (
-	"bufio"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
@@ -15,6 +14,8 @@ import (
 
 type Website struct {
 	Domain url.URL
+	// Index of the CSV line the website was parsed from
+	Line int
 }
 
 func (w *Website) URL() string {
@@ -26,6 +27,12 @@ type Company struct {
 	CommercialName    string   `json:"commercial_name"`
 	LegalName         string   `json:"legal_name"`
 	AllAvailableNames []string `json:"all_available_names"`
+
+	// Extra CSV columns, keyed by normalized header name
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Index of the CSV line the company was parsed from
+	Line int `json:"-"`
 }
 
 type JSONUrl struct {
@@ -56,24 +63,40 @@ func (j *JSONUrl) UnmarshalJSON(raw []byte) error {
 }
 
 func LoadDomainsFromFile(path string) ([]Website, error) {
+	return DefaultSchema().LoadDomainsFromFile(path)
+}
+
+func LoadCompaniesFromFile(path string) ([]Company, error) {
+	return DefaultSchema().LoadCompaniesFromFile(path)
+}
+
+func ParseDomainsCSV(reader io.Reader) ([]Website, error) {
+	return DefaultSchema().ParseDomainsCSV(reader)
+}
+
+func ParseCompaniesCSV(reader io.Reader) ([]Company, error) {
+	return DefaultSchema().ParseCompaniesCSV(reader)
+}
+
+func (s *Schema) LoadDomainsFromFile(path string) ([]Website, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	results, err := ParseDomainsCSV(file)
+	results, err := s.ParseDomainsCSV(file)
 	return results, wrapWithPathInfo(err, path)
 }
 
-func LoadCompaniesFromFile(path string) ([]Company, error) {
+func (s *Schema) LoadCompaniesFromFile(path string) ([]Company, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	results, err := ParseCompaniesCSV(file)
+	results, err := s.ParseCompaniesCSV(file)
 	return results, wrapWithPathInfo(err, path)
 }
 
@@ -85,68 +108,74 @@ func wrapWithPathInfo(err error, path string) error {
 	return nil
 }
 
-func ParseDomainsCSV(reader io.Reader) ([]Website, error) {
-	var results []Website
-
-	// Some CSV lines may be invalid, accumulate them so we can show them in an error message
-	var invalidLines ErrInvalidCSVLines
+// ParseDomainsCSV parses website domains from the column mapped to the domain field.
+//
+// Other columns are ignored.
+func (s *Schema) ParseDomainsCSV(reader io.Reader) (results []Website, err error) {
+	err = s.parseCSV(reader, func(mapping *headerMapping, record []string, index int) error {
+		parsedURL, err := NormalizeURL(mapping.column(record, FieldDomain))
+		if err != nil {
+			return err
+		}
 
-	// Split input into lines using a scanner
-	scanner := bufio.NewScanner(reader)
+		results = append(results, Website{Domain: *parsedURL, Line: index})
+		return nil
+	})
 
-	// Parse each line of the CSV, trimming whitespace and validating URLs
-	for index := 0; scanner.Scan(); index++ {
-		line := strings.TrimSpace(scanner.Text())
+	if err != nil && !errors.Is(err, ErrInvalidCSVLines{}) {
+		return nil, err
+	}
 
-		// Check CSV header is "domain", return error otherwise
-		if index == 0 {
-			err := checkCSVHeader(line, "domain")
-			if err != nil {
-				return nil, err
-			}
-			continue
-		}
+	// Check we have some results (we consider empty CSVs an error case)
+	if err == nil && len(results) == 0 {
+		return nil, ErrEmptyCSV
+	}
 
-		// Ignore empty lines
-		if line == "" {
-			continue
-		}
+	return results, err
+}
 
-		parsedURL, err := ParseURL(line)
+// ParseCompaniesCSV parses company info, using the schema to map header columns to fields.
+//
+// Only the domain column is required, columns that don't map to
+// a company field are kept in the company attributes.
+func (s *Schema) ParseCompaniesCSV(reader io.Reader) (companies []Company, err error) {
+	err = s.parseCSV(reader, func(mapping *headerMapping, record []string, index int) error {
+		parsedURL, err := NormalizeURL(mapping.column(record, FieldDomain))
 		if err != nil {
-			invalidLines = invalidLines.Append(err, line, index)
-			continue
+			return err
 		}
 
-		results = append(results, Website{Domain: *parsedURL})
-	}
-
-	// Check if we have invalid lines
-	if len(invalidLines) > 0 {
-		return results, invalidLines
-	}
+		companies = append(companies, Company{
+			Domain:            JSONUrl{URL: parsedURL},
+			CommercialName:    strings.TrimSpace(mapping.column(record, FieldCommercialName)),
+			LegalName:         strings.TrimSpace(mapping.column(record, FieldLegalName)),
+			AllAvailableNames: splitAndTrimFields(mapping.column(record, FieldAllAvailableNames), "|"),
+			Attributes:        mapping.collectAttributes(record),
+			Line:              index,
+		})
+		return nil
+	})
 
-	// Check line reader error
-	if scanner.Err() != nil {
-		return results, scanner.Err()
+	if err != nil && !errors.Is(err, ErrInvalidCSVLines{}) {
+		return nil, err
 	}
 
 	// Check we have some results (we consider empty CSVs an error case)
-	if len(results) == 0 {
+	if err == nil && len(companies) == 0 {
 		return nil, ErrEmptyCSV
 	}
 
-	return results, nil
+	return companies, err
 }
 
-var companyCSVHeader = []string{
-	"domain",
-	"company_commercial_name",
-	"company_legal_name",
-	"company_all_available_names",
-}
+type parseRecordFunc func(mapping *headerMapping, record []string, index int) error
 
-func ParseCompaniesCSV(reader io.Reader) (companies []Company, err error) {
+// parseCSV maps the header line columns using the schema,
+// then calls parseRecord for each of the following non blank records.
+//
+// Records with the wrong number of fields and records for which parseRecord
+// returns an error are accumulated, and returned as ErrInvalidCSVLines.
+func (s *Schema) parseCSV(reader io.Reader, parseRecord parseRecordFunc) error {
 	csvReader := csv.NewReader(reader)
 	// Reuse the same slice for each line, to prevent too many allocations
 	csvReader.ReuseRecord = true
@@ -154,67 +183,62 @@ func ParseCompaniesCSV(reader io.Reader) (companies []Company, err error) {
 	// Some CSV lines may be invalid, accumulate them so we can show them in an error message
 	var invalidLines ErrInvalidCSVLines
 
-	// Header lines might appear in any order, so we need to determine the correct field indexes
-	domainIndex, commercialIndex, legalIndex, allRawIndex := 0, 0, 0, 0
+	var mapping *headerMapping
 
 	// Parse each line of the CSV
 	for index := 0; true; index++ {
-		var line []string
-		line, err = csvReader.Read()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-
-			if errors.Is(err, csv.ErrFieldCount) {
-				err = wrapWrongNumFieldsErr(err)
-				rawLine := strings.Join(line, ",")
-				invalidLines = invalidLines.Append(err, rawLine, index)
-				continue
-			}
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
 
-			return companies, fmt.Errorf("%w - %s", ErrParseCSV, err)
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return fmt.Errorf("%w - %s", ErrParseCSV, err)
 		}
 
 		if index == 0 {
-			// Check that we have the expected headers,
+			// Check that we have the required headers,
 			// and determine the order in which the headers appear
-			indexes, err := checkCSVHeaders(line, companyCSVHeader)
+			mapping, err = s.mapHeader(record)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			domainIndex, commercialIndex, legalIndex, allRawIndex = indexes[0], indexes[1], indexes[2], indexes[3]
 			continue
 		}
 
-		// Line length is checked by csvReader,
-		// indexes are determined from the csv header line
-		domain, commercial, legal, allRaw := line[domainIndex], line[commercialIndex], line[legalIndex], line[allRawIndex]
-		parsedURL, err := ParseURL(domain)
+		// Ignore blank lines
+		if isBlank(record) {
+			continue
+		}
+
+		lineNumber, _ := csvReader.FieldPos(0)
+
 		if err != nil {
-			invalidLines = invalidLines.Append(err, strings.TrimSpace(domain), index)
+			err = wrapWrongNumFieldsErr(mapping.numColumns)
+			rawLine := strings.Join(record, ",")
+			invalidLines = invalidLines.Append(err, rawLine, record, index, lineNumber)
 			continue
 		}
 
-		companies = append(companies, Company{
-			Domain:            JSONUrl{URL: parsedURL},
-			CommercialName:    strings.TrimSpace(commercial),
-			LegalName:         strings.TrimSpace(legal),
-			AllAvailableNames: splitAndTrimFields(allRaw, "|"),
-		})
+		// Line length is checked by csvReader,
+		// indexes are determined from the csv header line
+		err = parseRecord(mapping, record, index)
+		if err != nil {
+			invalidLines = invalidLines.Append(err, invalidLineText(mapping, record), record, index, lineNumber)
+		}
 	}
 
 	// Check if we have invalid lines
 	if len(invalidLines) > 0 {
-		return companies, invalidLines
+		return invalidLines
 	}
 
-	// Check we have some results (we consider empty CSVs an error case)
-	if len(companies) == 0 {
-		return nil, ErrEmptyCSV
+	// Check we have a header line (we consider empty CSVs an error case)
+	if mapping == nil {
+		return ErrEmptyCSV
 	}
 
-	return companies, nil
+	return nil
 }
 
 func ParseURL(rawURL string) (*url.URL, error) {
@@ -248,52 +272,43 @@ func ParseURL(rawURL string) (*url.URL, error) {
 
 // Helpers
 
-func wrapWrongNumFieldsErr(err error) error {
-	return fmt.Errorf("%w - expected %d fields", ErrWrongNumberOfFields, len(companyCSVHeader))
+func wrapWrongNumFieldsErr(numFields int) error {
+	return fmt.Errorf("%w - expected %d fields", ErrWrongNumberOfFields, numFields)
 }
 
+// splitAndTrimFields splits text by separator, dropping empty fields.
 func splitAndTrimFields(text string, separator string) []string {
-	fields := strings.Split(text, separator)
+	var fields []string
 
-	for index, field := range fields {
-		fields[index] = strings.TrimSpace(field)
+	for _, field := range strings.Split(text, separator) {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields = append(fields, field)
+		}
 	}
 
 	return fields
 }
 
-func checkCSVHeader(line, expected string) error {
-	if line != expected {
-		return fmt.Errorf("%w: expected '%s'", ErrInvalidCSVHeader, expected)
+// invalidLineText returns the domain of an invalid record,
+// or the whole record for files without a domain column.
+func invalidLineText(mapping *headerMapping, record []string) string {
+	if mapping.has(FieldDomain) {
+		return strings.TrimSpace(mapping.column(record, FieldDomain))
 	}
 
-	return nil
-}
-
-func expectedHeadersErr(actual, expected []string) error {
-	return fmt.Errorf("%w:\n    expected headers %v,\n    got %v instead",
-		ErrInvalidCSVHeader, expected, actual)
+	return strings.Join(record, ",")
 }
 
-// checkCSVHeaders returns an error if the actual headers don't match the expected ones.
-// In case the headers match, we return the index of each header from expected in actual
-func checkCSVHeaders(actual, expected []string) ([]int, error) {
-	if len(actual) != len(expected) {
-		return nil, expectedHeadersErr(actual, expected)
-	}
-
-	indexes := make([]int, 0, len(expected))
-
-	for _, header := range expected {
-		index := indexOf(actual, header)
-		if index < 0 {
-			return nil, expectedHeadersErr(actual, expected)
+// isBlank returns true if every field of the record is blank.
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
 		}
-
-		indexes = append(indexes, index)
 	}
 
-	return indexes, nil
+	return true
 }
 
 func indexOf(values []string, needle string) int {
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -25,7 +27,7 @@ func TestParseDomainsCSV(t *testing.T) {
 				http://example.com
 			`,
 			expected: []csv.Website{
-				{Domain: url.URL{Host: "en.wikipedia.org", Scheme: "https"}},
+				{Domain: url.URL{Host: "wikipedia.org", Scheme: "https"}},
 				{Domain: url.URL{Host: "google.com", Scheme: "https"}},
 				{Domain: url.URL{Host: "example.com", Scheme: "http"}},
 			},
@@ -168,6 +170,108 @@ func TestParseDomainsCSV_invalidLines(t *testing.T) {
 	}
 }
 
+func TestParseDomainsCSV_allInvalidLinesRecorded(t *testing.T) {
+	lines := []string{"domain"}
+	for index := 0; index < csv.MaxInvalidCSVLines+5; index++ {
+		lines = append(lines, "invalid right here", "ftp://example.com", "")
+	}
+
+	_, err := csv.ParseDomainsCSV(strings.NewReader(strings.Join(lines, "\n")))
+	checkErrIs(t, err, csv.ErrInvalidCSVLines{})
+
+	invalidLines, _ := err.(csv.ErrInvalidCSVLines)
+	expectedCount := 2 * (csv.MaxInvalidCSVLines + 5)
+	if len(invalidLines) != expectedCount {
+		t.Fatalf("Expected %d invalid lines, got %d instead", expectedCount, len(invalidLines))
+	}
+
+	last := invalidLines[len(invalidLines)-1]
+	if last.LineNumber != len(lines)-1 {
+		t.Errorf("Expected last invalid line number %d, got %d instead", len(lines)-1, last.LineNumber)
+	}
+
+	expectedCounts := []csv.CategoryCount{
+		{Category: csv.CategoryInvalidURL, Count: csv.MaxInvalidCSVLines + 5},
+		{Category: csv.CategoryBadScheme, Count: csv.MaxInvalidCSVLines + 5},
+	}
+
+	counts := invalidLines.CountByCategory()
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("Expected counts %+v, got %+v instead", expectedCounts, counts)
+	}
+}
+
+func TestWriteRejectsCSV(t *testing.T) {
+	body := `domain,company_commercial_name,company_legal_name,company_all_available_names
+		bostonzen.org,Greater Boston Zen Center,,Greater Boston Zen Center
+
+		https://,Nowhere,,Nowhere
+		acme.com,too,many,fields,here`
+
+	_, err := csv.ParseCompaniesCSV(strings.NewReader(body))
+	invalidLines, _ := err.(csv.ErrInvalidCSVLines)
+
+	var out strings.Builder
+	err = csv.WriteRejectsCSV(&out, csv.NewRejects(invalidLines))
+	checkNoErr(t, err)
+
+	// The content is the whole line, including its indentation
+	expected := "line,content,category,error\n" +
+		"4,\"\"\"\t\thttps://\"\",Nowhere,,Nowhere\",missing host,missing URL host: https://\n" +
+		"5,\"\"\"\t\tacme.com\"\",too,many,fields,here\",wrong field count,wrong number of fields - expected 4 fields\n"
+
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q instead", expected, out.String())
+	}
+}
+
+func TestSaveRejectsToFile(t *testing.T) {
+	body := "domain,company_commercial_name,company_legal_name,company_all_available_names\n" +
+		"bostonzen.org,Greater Boston Zen Center,,Greater Boston Zen Center\n" +
+		"https://,\"Nowhere, Inc\",\"Nowhere \"\"NW\"\"\",Nowhere\n"
+
+	_, err := csv.ParseCompaniesCSV(strings.NewReader(body))
+	invalidLines, _ := err.(csv.ErrInvalidCSVLines)
+
+	// Every column of the line is kept, quoted like in the original file
+	expectedContent := `https://,"Nowhere, Inc","Nowhere ""NW""",Nowhere`
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{
+			name: "rejects.csv",
+			expected: "line,content,category,error\n" +
+				`3,"https://,""Nowhere, Inc"",""Nowhere """"NW"""""",Nowhere",missing host,missing URL host: https://` + "\n",
+		},
+		{
+			name:     "rejects.json",
+			expected: `"content": "https://,\"Nowhere, Inc\",\"Nowhere \"\"NW\"\"\",Nowhere"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name)
+			err := csv.SaveRejectsToFile(path, invalidLines)
+			checkNoErr(t, err)
+
+			content, err := os.ReadFile(path)
+			checkNoErr(t, err)
+
+			if !strings.Contains(string(content), tc.expected) {
+				t.Errorf("Expected %q in the rejects, got %q instead", tc.expected, content)
+			}
+		})
+	}
+
+	rejects := csv.NewRejects(invalidLines)
+	if len(rejects) != 1 || rejects[0].Content != expectedContent {
+		t.Errorf("Expected content %q, got %+v instead", expectedContent, rejects)
+	}
+}
+
 func TestParseCompaniesCSV(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -266,6 +370,192 @@ func TestParseCompaniesCSV(t *testing.T) {
 	}
 }
 
+func TestParseCompaniesCSV_schema(t *testing.T) {
+	body := "\ufeffWebsite , Company Name,Country,Internal-ID\n" +
+		"WWW.Acme.com/about,Acme,US,42\n" +
+		"beta.io,Beta,RO,\n"
+
+	results, err := csv.ParseCompaniesCSV(strings.NewReader(body))
+	checkNoErr(t, err)
+
+	expected := []csv.Company{
+		{
+			Domain:         companyDomainUrl("acme.com"),
+			CommercialName: "Acme",
+			Attributes:     map[string]string{"country": "US", "internal_id": "42"},
+		},
+		{
+			Domain:         companyDomainUrl("beta.io"),
+			CommercialName: "Beta",
+			Attributes:     map[string]string{"country": "RO"},
+		},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, received %d instead", len(expected), len(results))
+	}
+
+	for index, result := range results {
+		checkDomainUrl(t, result.Domain.URL, expected[index].Domain.URL, index)
+		checkCompanyNames(t, &result, &expected[index], index)
+
+		if !reflect.DeepEqual(result.Attributes, expected[index].Attributes) {
+			t.Errorf("Expected attributes %v, got %v instead (index %d)",
+				expected[index].Attributes, result.Attributes, index)
+		}
+	}
+}
+
+func TestSchemaAddAliases(t *testing.T) {
+	schema := csv.DefaultSchema()
+	err := schema.AddAliases(csv.FieldDomain, "Home Page")
+	checkNoErr(t, err)
+
+	body := `home-page,notes
+		example.com,first
+		example.org,second`
+
+	results, err := schema.ParseDomainsCSV(strings.NewReader(body))
+	checkNoErr(t, err)
+
+	expected := []url.URL{domainUrl("example.com"), domainUrl("example.org")}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, received %d instead", len(expected), len(results))
+	}
+
+	for index, result := range results {
+		checkDomainUrl(t, &result.Domain, &expected[index], index)
+	}
+
+	err = schema.AddAliases("phone", "tel")
+	checkErrIs(t, err, csv.ErrInvalidSchema)
+}
+
+func TestParseMatchRecordsCSV(t *testing.T) {
+	body := "\ufeffCompany Name,Phone Number,Facebook,notes\n" +
+		"Acme, (617) 491-1000 ,facebook.com/acme,first\n" +
+		",,,only notes\n" +
+		"Beta,,,second\n"
+
+	results, err := csv.ParseMatchRecordsCSV(strings.NewReader(body))
+	checkErrIs(t, err, csv.ErrInvalidCSVLines{})
+
+	expectedHeader := []string{"Company Name", "Phone Number", "Facebook", "notes"}
+	if !reflect.DeepEqual(results.Header, expectedHeader) {
+		t.Errorf("Expected header %v, got %v instead", expectedHeader, results.Header)
+	}
+
+	expected := []csv.MatchRecord{
+		{
+			Name:     "Acme",
+			Phone:    "(617) 491-1000",
+			Facebook: "facebook.com/acme",
+			Columns:  []string{"Acme", " (617) 491-1000 ", "facebook.com/acme", "first"},
+			Line:     1,
+		},
+		{
+			Name:    "Beta",
+			Columns: []string{"Beta", "", "", "second"},
+			Line:    3,
+		},
+	}
+	if !reflect.DeepEqual(results.Records, expected) {
+		t.Errorf("Expected %+v, got %+v instead", expected, results.Records)
+	}
+
+	var invalidLines csv.ErrInvalidCSVLines
+	if errors.As(err, &invalidLines) && len(invalidLines) != 1 {
+		t.Errorf("Expected 1 invalid line, got %d instead", len(invalidLines))
+	}
+	checkErrIs(t, invalidLines[0].Err, csv.ErrMissingMatchFields)
+
+	// At least one column must map to a match field
+	_, err = csv.ParseMatchRecordsCSV(strings.NewReader("first_name,address\nDaniel,Someplace\n"))
+	checkErrIs(t, err, csv.ErrInvalidCSVHeader)
+}
+
+func TestWriteMatchResultsCSV(t *testing.T) {
+	header := []string{"name", "phone"}
+	records := []csv.MatchRecord{
+		{Name: "Acme", Columns: []string{"Acme", ""}},
+		{Name: "Nobody", Columns: []string{"Nobody", ""}},
+		{Phone: "12", Columns: []string{"", "12"}},
+	}
+	outcomes := []csv.MatchOutcome{
+		{Domain: "acme.com", Name: "Acme Inc", Score: 7.25, Status: csv.MatchStatusMatch},
+		{Status: csv.MatchStatusNoMatch},
+		{Status: csv.MatchStatusError, Error: "invalid phone"},
+	}
+
+	var out strings.Builder
+	err := csv.WriteMatchResultsCSV(&out, header, records, outcomes)
+	checkNoErr(t, err)
+
+	expected := "name,phone,matched_domain,matched_name,match_score,match_status,match_error\n" +
+		"Acme,,acme.com,Acme Inc,7.250,match,\n" +
+		"Nobody,,,,,no_match,\n" +
+		",12,,,,error,invalid phone\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	summary := csv.NewMatchSummary(outcomes)
+	expectedSummary := csv.MatchSummary{Total: 3, Matched: 1, NoMatch: 1, Errors: 1, MatchRate: 100.0 / 3}
+	if summary != expectedSummary {
+		t.Errorf("Expected %+v, got %+v instead", expectedSummary, summary)
+	}
+}
+
+func TestMatchRecordsWithInvalidLines(t *testing.T) {
+	body := "name,phone,notes\n" +
+		",,first\n" +
+		"Acme,,\n" +
+		"Beta,12,second,extra\n" +
+		"Nobody,,\n" +
+		",,last\n"
+
+	records, err := csv.ParseMatchRecordsCSV(strings.NewReader(body))
+	var invalidLines csv.ErrInvalidCSVLines
+	if !errors.As(err, &invalidLines) || len(invalidLines) != 3 {
+		t.Fatalf("Expected 3 invalid lines, got %v instead", err)
+	}
+
+	outcomes := []csv.MatchOutcome{
+		{Domain: "acme.com", Name: "Acme Inc", Score: 7.25, Status: csv.MatchStatusMatch},
+		{Status: csv.MatchStatusNoMatch},
+	}
+	rows, rowOutcomes := records.WithInvalidLines(outcomes, invalidLines)
+
+	var out strings.Builder
+	err = csv.WriteMatchResultsCSV(&out, records.Header, rows, rowOutcomes)
+	checkNoErr(t, err)
+
+	// Every line is answered in order, lines with extra fields are fitted to the header
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	expectedPrefixes := []string{
+		"name,phone,notes,matched_domain",
+		",,first,,,,error,",
+		"Acme,,,acme.com,Acme Inc,7.250,match,",
+		"Beta,12,second,,,,error,",
+		"Nobody,,,,,,no_match,",
+		",,last,,,,error,",
+	}
+	if len(lines) != len(expectedPrefixes) {
+		t.Fatalf("Expected %d lines, got:\n%s", len(expectedPrefixes), out.String())
+	}
+	for index, prefix := range expectedPrefixes {
+		if !strings.HasPrefix(lines[index], prefix) {
+			t.Errorf("Expected line %d to start with %q, got %q instead", index, prefix, lines[index])
+		}
+	}
+
+	summary := csv.NewMatchSummary(rowOutcomes)
+	expectedSummary := csv.MatchSummary{Total: 5, Matched: 1, NoMatch: 1, Errors: 3, MatchRate: 20}
+	if summary != expectedSummary {
+		t.Errorf("Expected %+v, got %+v instead", expectedSummary, summary)
+	}
+}
+
 func TestParseCompaniesCSV_failure(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -454,6 +744,132 @@ func TestParseURL_failure(t *testing.T) {
 	}
 }
 
+func TestNormalizeURL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url      string
+		expected url.URL
+	}{
+		{
+			name:     "mixed case host",
+			url:      "Example.com",
+			expected: domainUrl("example.com"),
+		},
+		{
+			name:     "www subdomain with trailing slash",
+			url:      "www.example.com/",
+			expected: domainUrl("example.com"),
+		},
+		{
+			name:     "http URL with path",
+			url:      "http://example.com/index.html",
+			expected: domainUrl("example.com", "http"),
+		},
+		{
+			name:     "multi label public suffix",
+			url:      "https://shop.Example.co.uk:8080/contact?lang=en",
+			expected: domainUrl("example.co.uk"),
+		},
+		{
+			name:     "internationalized domain name",
+			url:      "bücher.de",
+			expected: domainUrl("xn--bcher-kva.de"),
+		},
+		{
+			name:     "IP address",
+			url:      "http://127.0.0.1:8080/",
+			expected: domainUrl("127.0.0.1", "http"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := csv.NormalizeURL(tc.url)
+			checkNoErr(t, err)
+
+			if *result != tc.expected {
+				t.Errorf("Expected %+v, got %+v instead", tc.expected, *result)
+			}
+		})
+	}
+}
+
+func TestNormalizeURL_failure(t *testing.T) {
+	testCases := []struct {
+		name        string
+		url         string
+		expectedErr error
+	}{
+		{
+			name:        "public suffix",
+			url:         "co.uk",
+			expectedErr: csv.ErrInvalidDomain,
+		},
+		{
+			name:        "single label host",
+			url:         "http://localhost",
+			expectedErr: csv.ErrInvalidDomain,
+		},
+		{
+			name:        "invalid URL scheme",
+			url:         "ftp://example.com",
+			expectedErr: csv.ErrInvalidURLScheme,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := csv.NormalizeURL(tc.url)
+			checkErrIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestDedupCompanies(t *testing.T) {
+	body := `domain,company_commercial_name,company_legal_name,company_all_available_names
+		bostonzen.org,Greater Boston Zen Center,,Greater Boston Zen Center
+		melatee.com,Melatee,,Melatee
+		https://www.BostonZen.org/about,Boston Zen,,Boston Zen | Greater Boston Zen Center`
+
+	companies, err := csv.ParseCompaniesCSV(strings.NewReader(body))
+	checkNoErr(t, err)
+
+	unique, duplicates := csv.DedupCompanies(companies)
+
+	expected := []csv.Company{
+		{
+			Domain:         companyDomainUrl("bostonzen.org"),
+			CommercialName: "Greater Boston Zen Center",
+			AllAvailableNames: []string{
+				"Greater Boston Zen Center",
+				"Boston Zen",
+			},
+		},
+		{
+			Domain:            companyDomainUrl("melatee.com"),
+			CommercialName:    "Melatee",
+			AllAvailableNames: []string{"Melatee"},
+		},
+	}
+
+	if len(unique) != len(expected) {
+		t.Fatalf("Expected %d results, received %d instead", len(expected), len(unique))
+	}
+
+	for index, result := range unique {
+		checkDomainUrl(t, result.Domain.URL, expected[index].Domain.URL, index)
+		checkCompanyNames(t, &result, &expected[index], index)
+	}
+
+	expectedDuplicates := []csv.DuplicateCSVLine{
+		{Index: 3, Domain: "bostonzen.org", FirstIndex: 1},
+	}
+
+	if !reflect.DeepEqual(duplicates, expectedDuplicates) {
+		t.Errorf("Expected duplicates %+v, got %+v instead", expectedDuplicates, duplicates)
+	}
+}
+
 func TestMarshalCompany(t *testing.T) {
 	company := csv.Company{
 		Domain:         companyDomainUrl("bostonzen.org"),
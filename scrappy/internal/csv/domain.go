@@ -0,0 +1,142 @@
+package csv
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// IDN profile used to map hosts to punycode.
+//
+// Unlike idna.Lookup, underscores are allowed in host labels,
+// since some of the company domains we import contain them.
+var domainProfile = idna.New(
+	idna.MapForLookup(),
+	idna.StrictDomainName(false),
+	idna.Transitional(false),
+)
+
+// NormalizeURL parses rawURL and reduces it to the registrable domain of its host.
+//
+// The host is lowercased, mapped to punycode and trimmed down to its public suffix
+// plus one label, while the path, query and port are dropped.
+// The scheme is kept, so "http://WWW.Example.co.uk/index.html"
+// becomes "http://example.co.uk".
+func NormalizeURL(rawURL string) (*url.URL, error) {
+	parsedURL, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := RegistrableDomain(parsedURL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	return &url.URL{Scheme: parsedURL.Scheme, Host: domain}, nil
+}
+
+// RegistrableDomain returns the registrable domain (eTLD+1) of host, in punycode.
+//
+// IP addresses are returned as they are.
+func RegistrableDomain(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if host == "" {
+		return "", ErrMissingURLHost
+	}
+
+	asciiHost, err := domainProfile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDomain, err)
+	}
+
+	if net.ParseIP(asciiHost) != nil {
+		return asciiHost, nil
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(asciiHost)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDomain, err)
+	}
+
+	return domain, nil
+}
+
+// DuplicateCSVLine represents a CSV line whose domain normalizes to the
+// same registrable domain as an earlier line, and was collapsed into it.
+type DuplicateCSVLine struct {
+	Index      int
+	Domain     string
+	FirstIndex int
+}
+
+// DedupWebsites removes websites whose domain was already seen,
+// keeping the first occurrence.
+func DedupWebsites(websites []Website) (unique []Website, duplicates []DuplicateCSVLine) {
+	seen := map[string]int{}
+
+	for _, website := range websites {
+		domain := website.Domain.Hostname()
+
+		firstIndex, found := seen[domain]
+		if found {
+			duplicates = append(duplicates, DuplicateCSVLine{
+				Index:      website.Line,
+				Domain:     domain,
+				FirstIndex: firstIndex,
+			})
+			continue
+		}
+
+		seen[domain] = website.Line
+		unique = append(unique, website)
+	}
+
+	return unique, duplicates
+}
+
+// DedupCompanies removes companies whose domain was already seen,
+// keeping the first occurrence.
+//
+// Names of the collapsed companies are merged into the
+// AllAvailableNames of the first occurrence.
+func DedupCompanies(companies []Company) (unique []Company, duplicates []DuplicateCSVLine) {
+	seen := map[string]int{}
+
+	for _, company := range companies {
+		domain := company.Domain.Hostname()
+
+		position, found := seen[domain]
+		if found {
+			first := &unique[position]
+			first.AllAvailableNames = mergeNames(first.AllAvailableNames, company.AllAvailableNames)
+
+			duplicates = append(duplicates, DuplicateCSVLine{
+				Index:      company.Line,
+				Domain:     domain,
+				FirstIndex: first.Line,
+			})
+			continue
+		}
+
+		seen[domain] = len(unique)
+		unique = append(unique, company)
+	}
+
+	return unique, duplicates
+}
+
+// mergeNames appends the names not already present in names.
+func mergeNames(names []string, other []string) []string {
+	for _, name := range other {
+		if name != "" && indexOf(names, name) < 0 {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -10,20 +10,58 @@ var (
 	ErrEmptyCSV            = errors.New("empty CSV")
 	ErrParseCSV            = errors.New("failed to parse line")
 	ErrWrongNumberOfFields = errors.New("wrong number of fields")
+	ErrInvalidSchema       = errors.New("invalid CSV schema")
 
 	ErrInvalidURL       = errors.New("invalid URL")
 	ErrMissingURLHost   = errors.New("missing URL host")
 	ErrInvalidURLScheme = errors.New("invalid url scheme")
+	ErrInvalidDomain    = errors.New("invalid domain")
+
+	ErrMissingMatchFields = errors.New("missing name, phone, website and facebook")
 )
 
-// We don't want to spam stdout with more than maxInvalidLines in case too many URLs
+// We don't want to spam stdout with more than MaxInvalidCSVLines in case too many URLs
 // from the CSV are invalid, so only this many errors will be shown.
+//
+// All invalid lines are still recorded, so they can be written to a rejects file.
 const MaxInvalidCSVLines = 20
 
+// Error categories used to group invalid CSV lines
+const (
+	CategoryMissingHost     = "missing host"
+	CategoryBadScheme       = "bad scheme"
+	CategoryWrongFieldCount = "wrong field count"
+	CategoryInvalidURL      = "invalid url"
+	CategoryInvalidDomain   = "invalid domain"
+	CategoryOther           = "other"
+)
+
 type InvalidCSVLine struct {
 	Index int
-	Line  string
-	Err   error
+	// Line number in the CSV file (starting from 1, header included)
+	LineNumber int
+	Line       string
+	Err        error
+	// Values of every CSV column, as many as the line has
+	Columns []string
+}
+
+// Category returns the error category of the invalid line.
+func (l *InvalidCSVLine) Category() string {
+	switch {
+	case errors.Is(l.Err, ErrMissingURLHost):
+		return CategoryMissingHost
+	case errors.Is(l.Err, ErrInvalidURLScheme):
+		return CategoryBadScheme
+	case errors.Is(l.Err, ErrWrongNumberOfFields):
+		return CategoryWrongFieldCount
+	case errors.Is(l.Err, ErrInvalidURL):
+		return CategoryInvalidURL
+	case errors.Is(l.Err, ErrInvalidDomain):
+		return CategoryInvalidDomain
+	default:
+		return CategoryOther
+	}
 }
 
 type ErrInvalidCSVLines []InvalidCSVLine
@@ -38,11 +76,37 @@ func (e ErrInvalidCSVLines) Is(target error) bool {
 	return ok
 }
 
-// Gather invalid lines, but only the first MaxInvalidCSVLines
-func (e ErrInvalidCSVLines) Append(err error, line string, index int) ErrInvalidCSVLines {
-	if len(e) >= MaxInvalidCSVLines {
-		return e
+// Append gathers an invalid line, along with its columns.
+func (e ErrInvalidCSVLines) Append(err error, line string, record []string, index int, lineNumber int) ErrInvalidCSVLines {
+	// Records are reused by the CSV reader, copy the columns
+	columns := append([]string(nil), record...)
+	return append(e, InvalidCSVLine{Err: err, Line: line, Columns: columns, Index: index, LineNumber: lineNumber})
+}
+
+// CategoryCount represents the number of invalid lines for an error category.
+type CategoryCount struct {
+	Category string
+	Count    int
+}
+
+// CountByCategory returns the number of invalid lines for each error category,
+// in the order in which the categories were first seen.
+func (e ErrInvalidCSVLines) CountByCategory() []CategoryCount {
+	var counts []CategoryCount
+	positions := map[string]int{}
+
+	for index := range e {
+		category := e[index].Category()
+
+		position, found := positions[category]
+		if !found {
+			position = len(counts)
+			positions[category] = position
+			counts = append(counts, CategoryCount{Category: category})
+		}
+
+		counts[position].Count++
 	}
 
-	return append(e, InvalidCSVLine{Err: err, Line: line, Index: index})
+	return counts
 }
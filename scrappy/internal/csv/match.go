@@ -0,0 +1,214 @@
+package csv
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MatchRecord is a partial company record, to be matched against the indexed companies.
+type MatchRecord struct {
+	Name     string
+	Phone    string
+	Website  string
+	Facebook string
+
+	// Values of every CSV column, in header order
+	Columns []string
+
+	// Index of the CSV line the record was parsed from
+	Line int
+}
+
+// MatchRecords holds the partial company records of a CSV file, along with its header.
+type MatchRecords struct {
+	Header  []string
+	Records []MatchRecord
+}
+
+// Status of a matched record
+const (
+	MatchStatusMatch   = "match"
+	MatchStatusNoMatch = "no_match"
+	MatchStatusError   = "error"
+)
+
+// Columns appended to each record of a match results CSV
+var matchResultsColumns = []string{"matched_domain", "matched_name", "match_score", "match_status", "match_error"}
+
+// MatchOutcome is the result of matching a partial company record.
+type MatchOutcome struct {
+	Domain string  `json:"matched_domain,omitempty"`
+	Name   string  `json:"matched_name,omitempty"`
+	Score  float64 `json:"match_score"`
+	Status string  `json:"match_status"`
+	Error  string  `json:"match_error,omitempty"`
+}
+
+// MatchSummary counts the outcomes of matching a file of partial company records.
+type MatchSummary struct {
+	Total   int `json:"total"`
+	Matched int `json:"matched"`
+	NoMatch int `json:"no_match"`
+	Errors  int `json:"errors"`
+	// Percentage of records that matched a company
+	MatchRate float64 `json:"match_rate"`
+}
+
+// NewMatchSummary counts the outcomes by status.
+func NewMatchSummary(outcomes []MatchOutcome) MatchSummary {
+	summary := MatchSummary{Total: len(outcomes)}
+
+	for _, outcome := range outcomes {
+		switch outcome.Status {
+		case MatchStatusMatch:
+			summary.Matched++
+		case MatchStatusNoMatch:
+			summary.NoMatch++
+		default:
+			summary.Errors++
+		}
+	}
+
+	if summary.Total > 0 {
+		summary.MatchRate = 100 * float64(summary.Matched) / float64(summary.Total)
+	}
+
+	return summary
+}
+
+// WriteMatchResultsCSV writes each record with its outcome appended, including a header line.
+//
+// records and outcomes must have the same length.
+func WriteMatchResultsCSV(w io.Writer, header []string, records []MatchRecord, outcomes []MatchOutcome) error {
+	csvWriter := csv.NewWriter(w)
+
+	err := csvWriter.Write(append(append([]string(nil), header...), matchResultsColumns...))
+	if err != nil {
+		return err
+	}
+
+	for index := range records {
+		outcome := &outcomes[index]
+
+		score := ""
+		if outcome.Status == MatchStatusMatch || outcome.Score > 0 {
+			score = strconv.FormatFloat(outcome.Score, 'f', 3, 64)
+		}
+
+		record := append(append([]string(nil), records[index].Columns...),
+			outcome.Domain, outcome.Name, score, outcome.Status, outcome.Error)
+
+		err = csvWriter.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// WithInvalidLines inserts the invalid lines among the records, in line order,
+// each with an error outcome, so every line of the CSV is answered.
+//
+// Outcomes are those of the records, in the same order.
+func (r *MatchRecords) WithInvalidLines(outcomes []MatchOutcome, invalidLines ErrInvalidCSVLines) ([]MatchRecord, []MatchOutcome) {
+	if len(invalidLines) == 0 {
+		return r.Records, outcomes
+	}
+
+	numRows := len(r.Records) + len(invalidLines)
+	rows := make([]MatchRecord, 0, numRows)
+	rowOutcomes := make([]MatchOutcome, 0, numRows)
+
+	appendInvalidLine := func(line *InvalidCSVLine) {
+		// Lines with the wrong number of fields are fitted to the header
+		columns := make([]string, len(r.Header))
+		copy(columns, line.Columns)
+
+		rows = append(rows, MatchRecord{Columns: columns, Line: line.Index})
+		rowOutcomes = append(rowOutcomes, MatchOutcome{Status: MatchStatusError, Error: line.Err.Error()})
+	}
+
+	next := 0
+	for index := range r.Records {
+		for ; next < len(invalidLines) && invalidLines[next].Index < r.Records[index].Line; next++ {
+			appendInvalidLine(&invalidLines[next])
+		}
+
+		rows = append(rows, r.Records[index])
+		rowOutcomes = append(rowOutcomes, outcomes[index])
+	}
+	for ; next < len(invalidLines); next++ {
+		appendInvalidLine(&invalidLines[next])
+	}
+
+	return rows, rowOutcomes
+}
+
+func LoadMatchRecordsFromFile(path string) (*MatchRecords, error) {
+	return MatchSchema().LoadMatchRecordsFromFile(path)
+}
+
+func ParseMatchRecordsCSV(reader io.Reader) (*MatchRecords, error) {
+	return MatchSchema().ParseMatchRecordsCSV(reader)
+}
+
+func (s *Schema) LoadMatchRecordsFromFile(path string) (*MatchRecords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	results, err := s.ParseMatchRecordsCSV(file)
+	return results, wrapWithPathInfo(err, path)
+}
+
+// ParseMatchRecordsCSV parses partial company records, using the schema to map header columns to fields.
+//
+// Values are only trimmed, they are validated when matching,
+// so records with an invalid phone number can still be matched by name.
+// Records without any value for the mapped fields are invalid.
+func (s *Schema) ParseMatchRecordsCSV(reader io.Reader) (*MatchRecords, error) {
+	var results MatchRecords
+
+	err := s.parseCSV(reader, func(mapping *headerMapping, record []string, index int) error {
+		if results.Header == nil {
+			results.Header = mapping.header
+		}
+
+		matchRecord := MatchRecord{
+			Name:     strings.TrimSpace(mapping.column(record, FieldName)),
+			Phone:    strings.TrimSpace(mapping.column(record, FieldPhone)),
+			Website:  strings.TrimSpace(mapping.column(record, FieldWebsite)),
+			Facebook: strings.TrimSpace(mapping.column(record, FieldFacebook)),
+			// Records are reused by the CSV reader, copy the columns
+			Columns: append([]string(nil), record...),
+			Line:    index,
+		}
+
+		if matchRecord.Name == "" && matchRecord.Phone == "" &&
+			matchRecord.Website == "" && matchRecord.Facebook == "" {
+			return ErrMissingMatchFields
+		}
+
+		results.Records = append(results.Records, matchRecord)
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, ErrInvalidCSVLines{}) {
+		return nil, err
+	}
+
+	// Check we have some results (we consider empty CSVs an error case)
+	if err == nil && len(results.Records) == 0 {
+		return nil, ErrEmptyCSV
+	}
+
+	return &results, err
+}
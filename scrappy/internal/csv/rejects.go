@@ -0,0 +1,112 @@
+package csv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Reject represents an invalid CSV line, as written to a rejects file.
+type Reject struct {
+	LineNumber int `json:"line"`
+	// The whole CSV line, so every column can be fixed
+	Content  string `json:"content"`
+	Category string `json:"category"`
+	Error    string `json:"error"`
+}
+
+var rejectsCSVHeader = []string{"line", "content", "category", "error"}
+
+// NewRejects converts invalid CSV lines into rejects.
+func NewRejects(invalidLines ErrInvalidCSVLines) []Reject {
+	rejects := make([]Reject, 0, len(invalidLines))
+
+	for index := range invalidLines {
+		invalidLine := &invalidLines[index]
+
+		content := invalidLine.Line
+		if invalidLine.Columns != nil {
+			content = encodeRecord(invalidLine.Columns)
+		}
+
+		rejects = append(rejects, Reject{
+			LineNumber: invalidLine.LineNumber,
+			Content:    content,
+			Category:   invalidLine.Category(),
+			Error:      invalidLine.Err.Error(),
+		})
+	}
+
+	return rejects
+}
+
+// SaveRejectsToFile writes every invalid line to the file at path.
+//
+// Files with a ".json" extension are written as a JSON array,
+// anything else is written as CSV.
+func SaveRejectsToFile(path string, invalidLines ErrInvalidCSVLines) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rejects := NewRejects(invalidLines)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = WriteRejectsJSON(file, rejects)
+	} else {
+		err = WriteRejectsCSV(file, rejects)
+	}
+	if err != nil {
+		return wrapWithPathInfo(err, path)
+	}
+
+	return wrapWithPathInfo(file.Close(), path)
+}
+
+// WriteRejectsCSV writes rejects as CSV, including a header line.
+func WriteRejectsCSV(w io.Writer, rejects []Reject) error {
+	csvWriter := csv.NewWriter(w)
+
+	err := csvWriter.Write(rejectsCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, reject := range rejects {
+		err = csvWriter.Write([]string{
+			strconv.Itoa(reject.LineNumber),
+			reject.Content,
+			reject.Category,
+			reject.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// encodeRecord returns the CSV line of a record, quoting its fields as needed.
+func encodeRecord(record []string) string {
+	var line strings.Builder
+
+	csvWriter := csv.NewWriter(&line)
+	csvWriter.Write(record)
+	csvWriter.Flush()
+
+	return strings.TrimSuffix(line.String(), "\n")
+}
+
+// WriteRejectsJSON writes rejects as an indented JSON array.
+func WriteRejectsJSON(w io.Writer, rejects []Reject) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rejects)
+}
@@ -0,0 +1,221 @@
+package csv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Company fields that can be mapped from CSV header columns
+const (
+	FieldDomain            = "domain"
+	FieldCommercialName    = "commercial_name"
+	FieldLegalName         = "legal_name"
+	FieldAllAvailableNames = "all_available_names"
+)
+
+// Partial company record fields, that can be mapped from the CSV header columns of files to match
+const (
+	FieldName     = "name"
+	FieldPhone    = "phone"
+	FieldWebsite  = "website"
+	FieldFacebook = "facebook"
+)
+
+// Fields in the order in which header names are matched against their aliases
+var schemaFields = []string{FieldDomain, FieldCommercialName, FieldLegalName, FieldAllAvailableNames}
+
+// Partial company record fields, in the order in which header names are matched against their aliases
+var matchSchemaFields = []string{FieldWebsite, FieldName, FieldPhone, FieldFacebook}
+
+// Byte order mark some spreadsheet tools prepend to exported CSV files
+const byteOrderMark = "\ufeff"
+
+// Schema describes how CSV header columns map to company fields.
+//
+// Header names are matched case and whitespace insensitively,
+// columns that don't match any field are kept as company attributes.
+type Schema struct {
+	// Fields in the order in which header names are matched against their aliases
+	fields []string
+	// Fields which must have a column
+	required []string
+	// Header names accepted for each field, in normalized form
+	aliases map[string][]string
+}
+
+// DefaultSchema returns a schema accepting the default header names for each field.
+func DefaultSchema() *Schema {
+	return &Schema{
+		fields:   schemaFields,
+		required: []string{FieldDomain},
+		aliases: map[string][]string{
+			FieldDomain: {
+				"domain", "website", "url", "company_domain", "company_website",
+			},
+			FieldCommercialName: {
+				"company_commercial_name", "commercial_name", "company_name", "name",
+			},
+			FieldLegalName: {
+				"company_legal_name", "legal_name",
+			},
+			FieldAllAvailableNames: {
+				"company_all_available_names", "all_available_names", "names",
+			},
+		},
+	}
+}
+
+// MatchSchema returns a schema accepting the default header names
+// for each field of the partial company records to match.
+//
+// No field is required, but at least one column has to map to a field.
+func MatchSchema() *Schema {
+	return &Schema{
+		fields: matchSchemaFields,
+		aliases: map[string][]string{
+			FieldWebsite: {
+				"website", "domain", "url", "company_website", "company_domain",
+			},
+			FieldName: {
+				"name", "company_name", "commercial_name", "company_commercial_name",
+				"legal_name", "company_legal_name",
+			},
+			FieldPhone: {
+				"phone", "phone_number", "telephone", "tel", "company_phone",
+			},
+			FieldFacebook: {
+				"facebook", "facebook_url", "facebook_page", "company_facebook",
+			},
+		},
+	}
+}
+
+// AddAliases adds header names accepted for field.
+func (s *Schema) AddAliases(field string, aliases ...string) error {
+	if _, found := s.aliases[field]; !found {
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidSchema, field)
+	}
+
+	for _, alias := range aliases {
+		s.aliases[field] = append(s.aliases[field], normalizeHeader(alias))
+	}
+
+	return nil
+}
+
+// headerMapping holds the column index of each field,
+// and the names of the columns kept as attributes.
+type headerMapping struct {
+	fields     map[string]int
+	attributes map[int]string
+	numColumns int
+	// Header line, as it was read
+	header []string
+}
+
+// has returns true if field has a column.
+func (m *headerMapping) has(field string) bool {
+	_, found := m.fields[field]
+	return found
+}
+
+// column returns the value of field from record, or "" if the field has no column.
+func (m *headerMapping) column(record []string, field string) string {
+	index, found := m.fields[field]
+	if !found {
+		return ""
+	}
+
+	return record[index]
+}
+
+// collectAttributes returns the non empty values of the attribute columns.
+func (m *headerMapping) collectAttributes(record []string) map[string]string {
+	var attributes map[string]string
+
+	for index, name := range m.attributes {
+		value := strings.TrimSpace(record[index])
+		if value == "" {
+			continue
+		}
+
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+		attributes[name] = value
+	}
+
+	return attributes
+}
+
+// mapHeader determines the column of each field from the CSV header line.
+//
+// Columns are assigned to the first field whose aliases contain their normalized name,
+// the remaining columns are kept as attributes.
+// An error is returned if a required field has no column, or if no column maps to a field.
+func (s *Schema) mapHeader(header []string) (*headerMapping, error) {
+	mapping := headerMapping{
+		fields:     map[string]int{},
+		attributes: map[int]string{},
+		numColumns: len(header),
+		// The CSV reader reuses records, copy the header
+		header: append([]string(nil), header...),
+	}
+
+	if len(mapping.header) > 0 {
+		mapping.header[0] = strings.TrimPrefix(mapping.header[0], byteOrderMark)
+	}
+
+	for index, name := range header {
+		name = normalizeHeader(name)
+		if name == "" {
+			continue
+		}
+
+		field := s.fieldFor(name)
+		if _, taken := mapping.fields[field]; field != "" && !taken {
+			mapping.fields[field] = index
+			continue
+		}
+
+		mapping.attributes[index] = name
+	}
+
+	for _, field := range s.required {
+		if !mapping.has(field) {
+			return nil, fmt.Errorf("%w: missing %s column (accepted names %v), got %v",
+				ErrInvalidCSVHeader, field, s.aliases[field], header)
+		}
+	}
+
+	if len(mapping.fields) == 0 {
+		return nil, fmt.Errorf("%w: expected one of the %v columns, got %v",
+			ErrInvalidCSVHeader, s.fields, header)
+	}
+
+	return &mapping, nil
+}
+
+// fieldFor returns the field accepting the normalized header name, or "" if there is none.
+func (s *Schema) fieldFor(name string) string {
+	for _, field := range s.fields {
+		if indexOf(s.aliases[field], name) >= 0 {
+			return field
+		}
+	}
+
+	return ""
+}
+
+// normalizeHeader lowercases a header name, strips the byte order mark,
+// and replaces inner whitespace and dashes with underscores.
+//
+// "Company Legal-Name" becomes "company_legal_name"
+func normalizeHeader(name string) string {
+	name = strings.TrimPrefix(name, byteOrderMark)
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '-' || r == '_'
+	}), "_")
+}
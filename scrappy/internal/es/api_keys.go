@@ -0,0 +1,213 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"examples/scrappy/internal/auth"
+)
+
+// API keys of the server clients can be stored in ES, instead of a keys file,
+// so they can be managed without restarting the server.
+//
+// Keys are stored by their digest, the key itself is only known to the client.
+
+// Index holding the API keys
+const apiKeysIndex = "scrappy-api-keys"
+
+// Maximum number of keys returned by ListAPIKeys
+const maxListedAPIKeys = 1000
+
+// APIKeyRecord is an API key stored in ES.
+type APIKeyRecord struct {
+	auth.APIKey
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateAPIKey stores a new key, creating the keys index if needed.
+//
+// Key names must be unique, ErrInvalidParams is returned if the name is taken.
+func (c *Client) CreateAPIKey(ctx context.Context, key *auth.APIKey) (*APIKeyRecord, error) {
+	err := key.Validate()
+	if err != nil {
+		return nil, InvalidParams(err)
+	}
+
+	err = c.createAPIKeysIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API keys index: %w", err)
+	}
+
+	existing, err := c.findAPIKeys(ctx, h{"term": h{"name": key.Name}})
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("%w: API key %q already exists", ErrInvalidParams, key.Name)
+	}
+
+	record := APIKeyRecord{APIKey: *key, CreatedAt: time.Now().UTC()}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for the key to be searchable, so the name is reserved
+	res, err := c.client.Create(apiKeysIndex, key.Hash, bytes.NewReader(body),
+		c.client.Create.WithRefresh("wait_for"),
+		c.client.Create.WithContext(ctx),
+	)
+
+	err = handleResponse(res, err, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// LookupKey gets a key by digest, implementing auth.KeyProvider.
+func (c *Client) LookupKey(ctx context.Context, hash string) (*auth.APIKey, error) {
+	res, err := c.client.Get(apiKeysIndex, hash,
+		c.client.Get.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, requestFailed(ErrFailedRequest, err)
+	}
+	defer res.Body.Close()
+
+	// Missing keys, and a missing keys index, are reported with a 404 status
+	if res.StatusCode == http.StatusNotFound {
+		return nil, auth.ErrUnknownKey
+	}
+	if res.IsError() {
+		return nil, errorFromResponse(res)
+	}
+
+	var envelope struct {
+		Source APIKeyRecord `json:"_source"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&envelope)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+	}
+
+	return &envelope.Source.APIKey, nil
+}
+
+// ListAPIKeys returns the stored keys, sorted by name.
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKeyRecord, error) {
+	return c.findAPIKeys(ctx, h{"match_all": h{}})
+}
+
+// DeleteAPIKey revokes the key with the given name, returning ErrNotFound if it doesn't exist.
+//
+// Servers caching keys accept the key until their cache expires.
+func (c *Client) DeleteAPIKey(ctx context.Context, name string) error {
+	body, _ := json.Marshal(h{"query": h{"term": h{"name": name}}})
+
+	res, err := c.client.DeleteByQuery([]string{apiKeysIndex}, bytes.NewReader(body),
+		c.client.DeleteByQuery.WithAllowNoIndices(true),
+		c.client.DeleteByQuery.WithIgnoreUnavailable(true),
+		c.client.DeleteByQuery.WithRefresh(true),
+		c.client.DeleteByQuery.WithContext(ctx),
+	)
+
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	err = handleResponse(res, err, &result)
+	if err != nil {
+		return err
+	}
+
+	if result.Deleted == 0 {
+		return fmt.Errorf("%w: API key %q", ErrNotFound, name)
+	}
+
+	return nil
+}
+
+// findAPIKeys searches the stored keys, no keys are found before the index is created.
+func (c *Client) findAPIKeys(ctx context.Context, query h) ([]APIKeyRecord, error) {
+	body, _ := json.Marshal(h{
+		"size":  maxListedAPIKeys,
+		"query": query,
+		"sort":  a{h{"name": "asc"}},
+	})
+
+	res, err := c.client.Search(
+		c.client.Search.WithIndex(apiKeysIndex),
+		c.client.Search.WithBody(bytes.NewReader(body)),
+		c.client.Search.WithAllowNoIndices(true),
+		c.client.Search.WithIgnoreUnavailable(true),
+		c.client.Search.WithContext(ctx),
+	)
+
+	var envelope struct {
+		Hits struct {
+			Hits []struct {
+				Source APIKeyRecord `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = handleResponse(res, err, &envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]APIKeyRecord, 0, len(envelope.Hits.Hits))
+	for _, hit := range envelope.Hits.Hits {
+		records = append(records, hit.Source)
+	}
+
+	return records, nil
+}
+
+// createAPIKeysIndex creates the keys index, unless it exists.
+func (c *Client) createAPIKeysIndex(ctx context.Context) error {
+	res, err := c.client.Indices.Exists([]string{apiKeysIndex},
+		c.client.Indices.Exists.WithContext(ctx),
+	)
+	if err != nil {
+		return requestFailed(ErrFailedRequest, err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := json.Marshal(apiKeysIndexBody())
+	res, err = c.client.Indices.Create(apiKeysIndex,
+		c.client.Indices.Create.WithBody(bytes.NewReader(body)),
+		c.client.Indices.Create.WithContext(ctx),
+	)
+
+	return handleResponse(res, err, nil)
+}
+
+func apiKeysIndexBody() h {
+	return h{
+		"settings": h{
+			"number_of_shards": 1,
+			// Keys are few, and looked up by every server
+			"auto_expand_replicas": "0-all",
+		},
+		"mappings": h{
+			"dynamic": "strict",
+			"properties": h{
+				"name":       h{"type": "keyword"},
+				"hash":       h{"type": "keyword"},
+				"scopes":     h{"type": "keyword"},
+				"rate_limit": h{"type": "float"},
+				"burst":      h{"type": "integer"},
+				"created_at": h{"type": "date"},
+			},
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/auth"
+)
+
+func TestAPIKeysMapping(t *testing.T) {
+	// The mapping is strict, every field of a record must be mapped
+	record := APIKeyRecord{
+		APIKey: auth.APIKey{
+			Name:      "reports",
+			Hash:      auth.HashKey("scrappy_reports"),
+			Scopes:    []auth.Scope{auth.ScopeRead},
+			RateLimit: 2,
+			Burst:     4,
+		},
+		CreatedAt: time.Now(),
+	}
+
+	body, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var fields map[string]any
+	json.Unmarshal(body, &fields)
+
+	properties := apiKeysIndexBody()["mappings"].(h)["properties"].(h)
+	for field := range fields {
+		if _, found := properties[field]; !found {
+			t.Errorf("Expected field %q to be mapped", field)
+		}
+	}
+}
+
+func TestLookupKey(t *testing.T) {
+	hash := auth.HashKey("scrappy_reports")
+
+	testCases := []struct {
+		name          string
+		status        int
+		body          string
+		expectedName  string
+		expectedError error
+	}{
+		{
+			name:   "found",
+			status: http.StatusOK,
+			body: `{"_index": "scrappy-api-keys", "found": true, "_source": {"name": "reports", "hash": "` + hash + `",
+				"scopes": ["read"], "rate_limit": 2, "created_at": "2022-12-01T10:00:00Z"}}`,
+			expectedName: "reports",
+		},
+		{
+			name:          "missing key",
+			status:        http.StatusNotFound,
+			body:          `{"_index": "scrappy-api-keys", "found": false}`,
+			expectedError: auth.ErrUnknownKey,
+		},
+		{
+			name:          "missing index",
+			status:        http.StatusNotFound,
+			body:          `{"error": {"type": "index_not_found_exception"}, "status": 404}`,
+			expectedError: auth.ErrUnknownKey,
+		},
+		{
+			name:          "forbidden",
+			status:        http.StatusForbidden,
+			body:          `{"error": {"type": "security_exception"}, "status": 403}`,
+			expectedError: ErrFailedRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/scrappy-api-keys/_doc/"+hash {
+					t.Errorf("Unexpected request path %q", r.URL.Path)
+				}
+
+				w.Header().Set("X-Elastic-Product", "Elasticsearch")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client, err := NewClient(&Config{Addresses: []string{server.URL}})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			key, err := client.LookupKey(context.Background(), hash)
+			if tc.expectedError != nil {
+				if !errors.Is(err, tc.expectedError) {
+					t.Errorf("Expected error %v, got %v instead", tc.expectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if key.Name != tc.expectedName || !key.Allows(auth.ScopeRead) || key.RateLimit != 2 {
+				t.Errorf("Expected read key %q, got %+v instead", tc.expectedName, key)
+			}
+		})
+	}
+}
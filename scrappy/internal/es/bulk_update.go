@@ -0,0 +1,276 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// Number of times failed bulk items are retried, unless configured otherwise
+const DefaultBulkRetries = 3
+
+// Delay before the first retry of failed bulk items, doubled on each retry
+const bulkRetryBackoff = 500 * time.Millisecond
+
+// PhoneNumbersWriterOptions configures the bulk indexer used by a PhoneNumbersWriter.
+//
+// Zero values use the defaults of the bulk indexer
+// (runtime.NumCPU() workers, 5MB flush bytes, 30s flush interval).
+type PhoneNumbersWriterOptions struct {
+	NumWorkers    int
+	FlushBytes    int
+	FlushInterval time.Duration
+	// Number of times failed items are retried, 0 uses DefaultBulkRetries, negative disables retries
+	MaxRetries int
+	// Numbers not seen for this long are marked stale, 0 uses DefaultPhoneStaleAfter
+	StaleAfter time.Duration
+}
+
+// BulkUpdateStats counts the companies by the outcome of their bulk update.
+type BulkUpdateStats struct {
+	Updated   int
+	Unchanged int
+	// Companies missing from the index
+	NotFound int
+	Failed   int
+	// Number of items sent again after failing
+	Retried int
+	// Updates which couldn't be written, with the reason
+	FailedItems []FailedItem
+}
+
+type bulkUpdateCounters struct {
+	updated   atomic.Int64
+	unchanged atomic.Int64
+	notFound  atomic.Int64
+	failed    atomic.Int64
+	retried   atomic.Int64
+}
+
+// bulkUpdateItem is an item kept around so it can be retried.
+type bulkUpdateItem struct {
+	id   string
+	body []byte
+	// Failure of the last attempt, saved if the item is given up on
+	lastFailure FailedItem
+}
+
+// PhoneNumbersWriter merges the phone numbers found by scrapes into the companies index,
+// like MergePhoneNumbers, but sends the updates in bulk requests.
+//
+// Items failing with a retryable error (conflicts, rejected or failed requests)
+// are retried once the writer is closed, with an increasing backoff.
+type PhoneNumbersWriter struct {
+	client     *Client
+	options    PhoneNumbersWriterOptions
+	maxRetries int
+	staleAfter time.Duration
+
+	indexer  esutil.BulkIndexer
+	counters bulkUpdateCounters
+	failed   failedItems
+
+	// Items to retry, collected by the failure callbacks of the bulk indexer
+	mu      sync.Mutex
+	retries []bulkUpdateItem
+}
+
+// NewPhoneNumbersWriter returns a writer for the phone numbers found by scrapes,
+// which must be closed once every result was added.
+func (c *Client) NewPhoneNumbersWriter(options *PhoneNumbersWriterOptions) (*PhoneNumbersWriter, error) {
+	writer := &PhoneNumbersWriter{
+		client:     c,
+		maxRetries: DefaultBulkRetries,
+		staleAfter: DefaultPhoneStaleAfter,
+	}
+
+	if options != nil {
+		writer.options = *options
+		if options.MaxRetries != 0 {
+			writer.maxRetries = options.MaxRetries
+		}
+		if options.StaleAfter > 0 {
+			writer.staleAfter = options.StaleAfter
+		}
+	}
+
+	indexer, err := writer.newIndexer()
+	if err != nil {
+		return nil, err
+	}
+
+	writer.indexer = indexer
+	return writer, nil
+}
+
+// Add queues the merge of the phone numbers found by a scrape of the company with the given url,
+// which visited the given pages.
+//
+// The update is sent with the next bulk request, its outcome is counted in the stats returned by Close.
+// Updates the bulk indexer doesn't accept are counted as failed, and listed in the failed items.
+func (w *PhoneNumbersWriter) Add(ctx context.Context, url string, sightings []PhoneSighting, visited []string) error {
+	id, err := urlToId(url)
+	if err != nil {
+		return err
+	}
+
+	body, err := mergePhoneNumbersBody(sightings, visited, time.Now(), w.staleAfter)
+	if err != nil {
+		return err
+	}
+
+	item := bulkUpdateItem{id: id, body: body}
+	err = w.add(ctx, w.indexer, item)
+	if err != nil {
+		log.Printf("es update error for company: %q: %s\n", id, err)
+		w.counters.failed.Add(1)
+		w.failed.add(w.newFailedItem(item, esutil.BulkIndexerResponseItem{}, err))
+	}
+
+	return nil
+}
+
+// Close flushes the queued updates, retries the failed ones, and returns the stats of the run.
+//
+// Items still failing after the last retry are counted as failed.
+func (w *PhoneNumbersWriter) Close(ctx context.Context) (*BulkUpdateStats, error) {
+	err := w.indexer.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := bulkRetryBackoff
+	for retry := 0; retry < w.maxRetries; retry++ {
+		retries := w.takeRetries()
+		if len(retries) == 0 {
+			break
+		}
+
+		log.Printf("es retrying %d failed update(s) in %s\n", len(retries), backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		indexer, err := w.newIndexer()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range retries {
+			w.counters.retried.Add(1)
+			err := w.add(ctx, indexer, item)
+			if err != nil {
+				log.Printf("es update error for company: %q: %s\n", item.id, err)
+				w.counters.failed.Add(1)
+				w.failed.add(w.newFailedItem(item, esutil.BulkIndexerResponseItem{}, err))
+			}
+		}
+
+		err = indexer.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Anything left failed on the last attempt
+	for _, item := range w.takeRetries() {
+		log.Printf("es giving up on update of company %q\n", item.id)
+		w.counters.failed.Add(1)
+		w.failed.add(item.lastFailure)
+	}
+
+	return &BulkUpdateStats{
+		Updated:   int(w.counters.updated.Load()),
+		Unchanged: int(w.counters.unchanged.Load()),
+		NotFound:  int(w.counters.notFound.Load()),
+		Failed:    int(w.counters.failed.Load()),
+		Retried:   int(w.counters.retried.Load()),
+
+		FailedItems: w.failed.list(),
+	}, nil
+}
+
+func (w *PhoneNumbersWriter) newIndexer() (esutil.BulkIndexer, error) {
+	return esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        w.client.client,
+		Index:         w.client.companiesIndex,
+		NumWorkers:    w.options.NumWorkers,
+		FlushBytes:    w.options.FlushBytes,
+		FlushInterval: w.options.FlushInterval,
+		OnError: func(ctx context.Context, err error) {
+			log.Printf("es bulk update error: %s\n", err)
+		},
+	})
+}
+
+func (w *PhoneNumbersWriter) add(ctx context.Context, indexer esutil.BulkIndexer, item bulkUpdateItem) error {
+	retryOnConflict := updateRetryOnConflict
+
+	return indexer.Add(ctx, esutil.BulkIndexerItem{
+		Action:          "update",
+		DocumentID:      item.id,
+		Body:            bytes.NewReader(item.body),
+		RetryOnConflict: &retryOnConflict,
+		OnSuccess: func(ctx context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+			if res.Result == bulkResultNoop {
+				w.counters.unchanged.Add(1)
+			} else {
+				w.counters.updated.Add(1)
+			}
+		},
+		OnFailure: func(ctx context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			w.handleFailure(item, res, err)
+		},
+	})
+}
+
+func (w *PhoneNumbersWriter) handleFailure(item bulkUpdateItem, res esutil.BulkIndexerResponseItem, err error) {
+	switch {
+	case err == nil && res.Status == http.StatusNotFound:
+		w.counters.notFound.Add(1)
+	case isRetryableBulkFailure(res, err):
+		item.lastFailure = w.newFailedItem(item, res, err)
+		w.mu.Lock()
+		w.retries = append(w.retries, item)
+		w.mu.Unlock()
+	default:
+		handleBulkIndexFailure(context.Background(), esutil.BulkIndexerItem{DocumentID: item.id}, res, err)
+		w.client.observeBulkFailure("update")
+		w.counters.failed.Add(1)
+		w.failed.add(w.newFailedItem(item, res, err))
+	}
+}
+
+func (w *PhoneNumbersWriter) newFailedItem(item bulkUpdateItem, res esutil.BulkIndexerResponseItem, err error) FailedItem {
+	return newFailedItem(w.client.companiesIndex, "update", item.id, item.body, res, err)
+}
+
+func (w *PhoneNumbersWriter) takeRetries() []bulkUpdateItem {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	retries := w.retries
+	w.retries = nil
+	return retries
+}
+
+// isRetryableBulkFailure reports whether a failed bulk item may succeed if sent again:
+// failed requests, version conflicts, rejections (429) and server errors.
+func isRetryableBulkFailure(res esutil.BulkIndexerResponseItem, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return res.Status == http.StatusConflict ||
+		res.Status == http.StatusTooManyRequests ||
+		res.Status >= http.StatusInternalServerError
+}
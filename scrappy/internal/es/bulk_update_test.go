@@ -0,0 +1,103 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+func TestPhoneNumbersWriterHandleFailure(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		err      error
+		expected BulkUpdateStats
+		retried  bool
+	}{
+		{name: "missing company", status: http.StatusNotFound, expected: BulkUpdateStats{NotFound: 1}},
+		{name: "invalid update", status: http.StatusBadRequest, expected: BulkUpdateStats{Failed: 1}},
+		{name: "version conflict", status: http.StatusConflict, retried: true},
+		{name: "rejected", status: http.StatusTooManyRequests, retried: true},
+		{name: "server error", status: http.StatusServiceUnavailable, retried: true},
+		{name: "failed request", err: errors.New("connection reset"), retried: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			writer := PhoneNumbersWriter{client: &Client{companiesIndex: "companies"}}
+			item := bulkUpdateItem{id: "example.com", body: []byte("{}")}
+
+			writer.handleFailure(item, esutil.BulkIndexerResponseItem{Status: tc.status}, tc.err)
+
+			stats := BulkUpdateStats{
+				NotFound: int(writer.counters.notFound.Load()),
+				Failed:   int(writer.counters.failed.Load()),
+			}
+			if !reflect.DeepEqual(stats, tc.expected) {
+				t.Errorf("Expected stats %+v, got %+v instead", tc.expected, stats)
+			}
+
+			// Failed items are saved to the dead-letter file, with their reason
+			failedItems := writer.failed.list()
+			if len(failedItems) != tc.expected.Failed {
+				t.Errorf("Expected %d failed items, got %d instead", tc.expected.Failed, len(failedItems))
+			}
+			for _, failed := range failedItems {
+				if failed.ID != item.id || failed.Action != "update" || failed.Index != "companies" {
+					t.Errorf("Expected failed update of %q, got %+v instead", item.id, failed)
+				}
+			}
+
+			retries := writer.takeRetries()
+			if tc.retried != (len(retries) == 1) {
+				t.Errorf("Expected retried to be %t, got %d retries", tc.retried, len(retries))
+			}
+			// Retried items keep their failure, in case they are given up on
+			for _, retry := range retries {
+				if retry.lastFailure.ID != item.id {
+					t.Errorf("Expected the last failure of %q to be kept, got %+v instead", item.id, retry.lastFailure)
+				}
+			}
+			if len(writer.takeRetries()) != 0 {
+				t.Errorf("Expected retries to be cleared once taken")
+			}
+		})
+	}
+}
+
+// failingIndexer rejects every item, like a bulk indexer whose context is done.
+type failingIndexer struct {
+	esutil.BulkIndexer
+}
+
+func (failingIndexer) Add(context.Context, esutil.BulkIndexerItem) error {
+	return context.Canceled
+}
+
+func TestPhoneNumbersWriterAddFailure(t *testing.T) {
+	writer := PhoneNumbersWriter{
+		client:     &Client{companiesIndex: "companies"},
+		indexer:    failingIndexer{},
+		staleAfter: DefaultPhoneStaleAfter,
+	}
+
+	err := writer.Add(context.Background(), "https://mazautoglass.com", []PhoneSighting{{Number: "+14155550100"}}, nil)
+	if err != nil {
+		t.Fatalf("Expected the failure to be recorded, got %s", err)
+	}
+
+	if failed := writer.counters.failed.Load(); failed != 1 {
+		t.Errorf("Expected 1 failed update, got %d instead", failed)
+	}
+
+	// The update can be replayed from the dead-letter file
+	failedItems := writer.failed.list()
+	if len(failedItems) != 1 || failedItems[0].ID != "mazautoglass.com" || failedItems[0].Action != "update" ||
+		len(failedItems[0].Body) == 0 {
+		t.Errorf("Expected failed update of %q, got %+v instead", "mazautoglass.com", failedItems)
+	}
+}
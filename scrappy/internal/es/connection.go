@@ -0,0 +1,191 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClusterInfo describes the node answering a connection check.
+type ClusterInfo struct {
+	Name        string `json:"name"`
+	ClusterName string `json:"cluster_name"`
+	Version     struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+// validate checks the config is complete, and doesn't mix authentication or trust options.
+func (config *Config) validate() error {
+	if len(config.Addresses) == 0 {
+		return fmt.Errorf("%w: missing cluster address", ErrInvalidConfig)
+	}
+
+	methods := 0
+	if config.Username != "" || config.Password != "" {
+		if config.Username == "" || config.Password == "" {
+			return fmt.Errorf("%w: username and password must be set together", ErrInvalidConfig)
+		}
+		methods++
+	}
+	if config.APIKey != "" {
+		methods++
+	}
+	if config.BearerToken != "" {
+		methods++
+	}
+	if methods > 1 {
+		return fmt.Errorf("%w: use only one of username and password, API key or bearer token", ErrInvalidConfig)
+	}
+
+	if len(config.CACert) > 0 && config.CertificateFingerprint != "" {
+		return fmt.Errorf("%w: use either a CA certificate or a CA fingerprint", ErrInvalidConfig)
+	}
+
+	if (len(config.ClientCert) > 0) != (len(config.ClientKey) > 0) {
+		return fmt.Errorf("%w: client certificate and key must be set together", ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+// newTransport returns the HTTP transport used to connect to the cluster, configured for TLS.
+//
+// The transport is set up here, rather than by the go-elasticsearch client,
+// since the client sets the fingerprint check on the shared http.DefaultTransport,
+// and ignores client certificates when checking fingerprints.
+func newTransport(config *Config) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.Insecure,
+	}
+
+	if len(config.CACert) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(config.CACert) {
+			return nil, fmt.Errorf("%w: no certificate found in CA certificate", ErrInvalidConfig)
+		}
+	}
+
+	if config.CertificateFingerprint != "" && !config.Insecure {
+		fingerprint, err := parseFingerprint(config.CertificateFingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		// The certificate chain is checked by the fingerprint, instead of the CA pool
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = fingerprintVerifier(fingerprint)
+	}
+
+	if len(config.ClientCert) > 0 {
+		certificate, err := tls.X509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: client certificate: %s", ErrInvalidConfig, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// parseFingerprint decodes a SHA256 fingerprint, either plain hex or colon separated,
+// as printed by ES ("B7:1E:...") or openssl.
+func parseFingerprint(value string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(value), ":", ""))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("%w: CA fingerprint must be a hex encoded SHA256 digest", ErrInvalidConfig)
+	}
+
+	return fingerprint, nil
+}
+
+// fingerprintVerifier accepts the certificates presented by the cluster
+// if one of them has the given SHA256 fingerprint.
+func fingerprintVerifier(fingerprint []byte) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		for _, rawCert := range rawCerts {
+			digest := sha256.Sum256(rawCert)
+			if bytes.Equal(digest[:], fingerprint) {
+				return nil
+			}
+		}
+
+		return errFingerprintMismatch
+	}
+}
+
+var errFingerprintMismatch = errors.New("no certificate presented by the cluster matches the CA fingerprint")
+
+// CheckConnection sends an info request to the cluster,
+// failures are explained using a diagnostic of the likely cause.
+func (c *Client) CheckConnection(ctx context.Context) (*ClusterInfo, error) {
+	res, err := c.client.Info(c.client.Info.WithContext(ctx))
+
+	var info ClusterInfo
+	err = handleResponse(res, err, &info)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %s\n%s", ErrConnection,
+			strings.Join(c.addresses, ", "), err, diagnoseConnectionError(err))
+	}
+
+	return &info, nil
+}
+
+// diagnoseConnectionError returns a hint about the likely cause of a failed request.
+func diagnoseConnectionError(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var dnsError *net.DNSError
+	var netError net.Error
+
+	message := err.Error()
+	switch {
+	case errors.Is(err, errFingerprintMismatch) || strings.Contains(message, errFingerprintMismatch.Error()):
+		return "The cluster certificate doesn't match es_ca_fingerprint, check the fingerprint printed by ES on first launch."
+	case errors.As(err, &unknownAuthority) || strings.Contains(message, "certificate signed by unknown authority"):
+		return "The cluster certificate isn't trusted, set es_cacert or es_ca_fingerprint, or use --insecure for local clusters."
+	case errors.As(err, &hostnameError) || strings.Contains(message, "certificate is valid for"):
+		return "The cluster certificate doesn't match the host in es_url, connect using a host name listed in the certificate."
+	case strings.Contains(message, "server gave HTTP response to HTTPS client"):
+		return "The cluster doesn't use TLS, use an http:// address in es_url."
+	case strings.Contains(message, "malformed HTTP response"):
+		return "The cluster uses TLS, use an https:// address in es_url."
+	case errors.As(err, &dnsError) || strings.Contains(message, "no such host"):
+		return "The host in es_url can't be resolved, check the address."
+	case strings.Contains(message, "connection refused"):
+		return "Nothing is listening at es_url, check the cluster is running and the port is correct."
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netError) && netError.Timeout()) ||
+		strings.Contains(message, "timeout"):
+		return "The cluster didn't answer in time, check the address and any firewall in between."
+	case strings.Contains(message, "401 Unauthorized"):
+		return "Authentication failed, check es_username and es_password, es_api_key or es_bearer_token."
+	case strings.Contains(message, "403 Forbidden"):
+		return "The credentials are valid, but lack the privileges needed, check the user or API key roles."
+	default:
+		return "Check es_url and the cluster credentials."
+	}
+}
+
+// CheckReady checks the cluster is reachable, and the companies index, or alias, exists.
+//
+// ErrNotFound is returned if the cluster has no companies index.
+func (c *Client) CheckReady(ctx context.Context) error {
+	_, err := c.CheckConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.CurrentCompanyIndex(ctx)
+	return err
+}
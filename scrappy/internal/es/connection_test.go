@@ -0,0 +1,136 @@
+package es
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestCluster starts a TLS server answering info requests like an ES node.
+func newTestCluster(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Checked by the go-elasticsearch client
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "es01", "cluster_name": "docker-cluster", "version": {"number": "8.5.3"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCheckConnection(t *testing.T) {
+	server := newTestCluster(t)
+	certificate := server.Certificate()
+
+	digest := sha256.Sum256(certificate.Raw)
+	fingerprint := hex.EncodeToString(digest[:])
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+
+	testCases := []struct {
+		name          string
+		config        Config
+		expectedHint  string
+		expectedError bool
+	}{
+		{name: "CA certificate", config: Config{CACert: caCert}},
+		{name: "fingerprint", config: Config{CertificateFingerprint: fingerprint}},
+		{name: "colon separated fingerprint", config: Config{
+			CertificateFingerprint: strings.ToUpper(colonSeparated(fingerprint)),
+		}},
+		{name: "insecure", config: Config{Insecure: true}},
+		{
+			name:          "untrusted certificate",
+			config:        Config{},
+			expectedError: true,
+			expectedHint:  "isn't trusted",
+		},
+		{
+			name:          "fingerprint mismatch",
+			config:        Config{CertificateFingerprint: strings.Repeat("ab", sha256.Size)},
+			expectedError: true,
+			expectedHint:  "doesn't match es_ca_fingerprint",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			config.Addresses = []string{server.URL}
+			config.APIKey = "a2V5OnNlY3JldA=="
+
+			client, err := NewClient(&config)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			info, err := client.CheckConnection(context.Background())
+			if tc.expectedError {
+				if !errors.Is(err, ErrConnection) || !strings.Contains(err.Error(), tc.expectedHint) {
+					t.Errorf("Expected %v with hint %q, got %v instead", ErrConnection, tc.expectedHint, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if info.ClusterName != "docker-cluster" || info.Version.Number != "8.5.3" {
+				t.Errorf("Unexpected cluster info %+v", info)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	addresses := []string{"https://localhost:9200"}
+
+	testCases := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{name: "basic auth", config: Config{Addresses: addresses, Username: "elastic", Password: "secret"}, valid: true},
+		{name: "API key", config: Config{Addresses: addresses, APIKey: "a2V5OnNlY3JldA=="}, valid: true},
+		{name: "no auth", config: Config{Addresses: addresses, Insecure: true}, valid: true},
+		{name: "missing address", config: Config{APIKey: "a2V5OnNlY3JldA=="}},
+		{name: "missing password", config: Config{Addresses: addresses, Username: "elastic"}},
+		{name: "several auth methods", config: Config{Addresses: addresses, APIKey: "key", BearerToken: "token"}},
+		{name: "CA and fingerprint", config: Config{Addresses: addresses, CACert: []byte("ca"), CertificateFingerprint: "ab"}},
+		{name: "client certificate without key", config: Config{Addresses: addresses, ClientCert: []byte("cert")}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.validate()
+			if tc.valid && err != nil {
+				t.Errorf("Unexpected error %s", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected %v, got %v instead", ErrInvalidConfig, err)
+			}
+		})
+	}
+
+	_, err := NewClient(&Config{Addresses: addresses, CertificateFingerprint: "not hex"})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected %v for an invalid fingerprint, got %v instead", ErrInvalidConfig, err)
+	}
+}
+
+func colonSeparated(value string) string {
+	var pairs []string
+	for index := 0; index < len(value); index += 2 {
+		pairs = append(pairs, value[index:index+2])
+	}
+
+	return strings.Join(pairs, ":")
+}
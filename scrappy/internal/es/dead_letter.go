@@ -0,0 +1,295 @@
+package es
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"examples/scrappy/internal/csv"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// Bulk items which couldn't be written are saved to a dead-letter JSON Lines file,
+// one item per line, with the reason of the failure,
+// so they can be inspected, and resubmitted using RetryFailedItems.
+
+// Bulk actions with a body, which can be resubmitted
+var bulkActions = map[string]bool{"index": true, "create": true, "update": true}
+
+// FailedItem is a bulk item which couldn't be written.
+type FailedItem struct {
+	ID string `json:"id"`
+	// Index or alias the item was written to, the companies index if empty
+	Index  string          `json:"index,omitempty"`
+	Action string          `json:"action"`
+	Body   json.RawMessage `json:"body"`
+	// HTTP status of the item, 0 if the request failed
+	Status    int       `json:"status,omitempty"`
+	ErrorType string    `json:"error_type,omitempty"`
+	Reason    string    `json:"reason"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// RetryStats counts the resubmitted items by outcome.
+type RetryStats struct {
+	Succeeded int
+	Failed    int
+	// Items failing again, with their new reason
+	FailedItems []FailedItem
+}
+
+// failedItems collects the failed items, the bulk indexer calls OnFailure from several goroutines.
+type failedItems struct {
+	mu    sync.Mutex
+	items []FailedItem
+}
+
+func (f *failedItems) add(item FailedItem) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.items = append(f.items, item)
+}
+
+func (f *failedItems) list() []FailedItem {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FailedItem(nil), f.items...)
+}
+
+// newFailedItem describes a failed bulk item, using either the transport error,
+// or the error returned by ES for the item.
+func newFailedItem(index string, action string, id string, body []byte,
+	res esutil.BulkIndexerResponseItem, err error) FailedItem {
+
+	item := FailedItem{
+		ID:       id,
+		Index:    index,
+		Action:   action,
+		Body:     json.RawMessage(body),
+		FailedAt: time.Now().UTC(),
+	}
+
+	if err != nil {
+		item.Reason = err.Error()
+		return item
+	}
+
+	item.Status = res.Status
+	item.ErrorType = res.Error.Type
+	item.Reason = res.Error.Reason
+	return item
+}
+
+// NewFailedCompanyItem describes a company import which failed,
+// using the same bulk action as BulkIndexCompanies, so it can be resubmitted.
+func NewFailedCompanyItem(company *csv.Company, options *BulkIndexOptions, reason string) (FailedItem, error) {
+	overwrite := options != nil && options.Overwrite
+
+	action, payload, err := companyBulkAction(company, overwrite)
+	if err != nil {
+		return FailedItem{}, err
+	}
+
+	return FailedItem{
+		ID:       company.Domain.Hostname(),
+		Action:   action,
+		Body:     json.RawMessage(payload),
+		Reason:   reason,
+		FailedAt: time.Now().UTC(),
+	}, nil
+}
+
+// NewFailedPhoneNumbersItem describes a phone numbers merge which failed,
+// using the same update as PhoneNumbersWriter, so it can be resubmitted.
+func NewFailedPhoneNumbersItem(url string, sightings []PhoneSighting, visited []string, staleAfter time.Duration, reason string) (FailedItem, error) {
+	id, err := urlToId(url)
+	if err != nil {
+		return FailedItem{}, err
+	}
+
+	body, err := mergePhoneNumbersBody(sightings, visited, time.Now(), staleAfter)
+	if err != nil {
+		return FailedItem{}, err
+	}
+
+	return FailedItem{
+		ID:       id,
+		Action:   "update",
+		Body:     json.RawMessage(body),
+		Reason:   reason,
+		FailedAt: time.Now().UTC(),
+	}, nil
+}
+
+// SaveFailedItemsToFile writes the failed items to a JSON Lines file, replacing its content.
+func SaveFailedItemsToFile(path string, items []FailedItem) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = WriteFailedItems(file, items)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+// AppendFailedItemsToFile appends the failed items to a JSON Lines file, creating it if needed.
+func AppendFailedItemsToFile(path string, items []FailedItem) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = WriteFailedItems(file, items)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+// WriteFailedItems writes the failed items as JSON Lines.
+func WriteFailedItems(w io.Writer, items []FailedItem) error {
+	encoder := json.NewEncoder(w)
+
+	for index := range items {
+		err := encoder.Encode(&items[index])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadFailedItemsFromFile reads the failed items of a dead-letter file.
+func LoadFailedItemsFromFile(path string) ([]FailedItem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	items, err := ReadFailedItems(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return items, nil
+}
+
+// ReadFailedItems reads failed items written as JSON Lines, skipping blank lines.
+func ReadFailedItems(r io.Reader) ([]FailedItem, error) {
+	var items []FailedItem
+
+	scanner := bufio.NewScanner(r)
+	// Company documents may be larger than the default 64KB line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var item FailedItem
+		err := json.Unmarshal(line, &item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrInvalidParams, lineNumber, err)
+		}
+
+		if item.ID == "" || len(item.Body) == 0 {
+			return nil, fmt.Errorf("%w: line %d: missing id or body", ErrInvalidParams, lineNumber)
+		}
+		if !bulkActions[item.Action] {
+			return nil, fmt.Errorf("%w: line %d: unsupported action %q", ErrInvalidParams, lineNumber, item.Action)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
+
+// RetryFailedItems resubmits failed items using a bulk request.
+//
+// Items without an index are written to the companies index.
+func (c *Client) RetryFailedItems(ctx context.Context, items []FailedItem) (*RetryStats, error) {
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client: c.client,
+		Index:  c.companiesIndex,
+		OnError: func(ctx context.Context, err error) {
+			log.Printf("es bulk retry error: %s\n", err)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var counters bulkIndexCounters
+	var failed failedItems
+
+	for _, item := range items {
+		item := item
+		if item.Index == "" {
+			item.Index = c.companiesIndex
+		}
+
+		bulkItem := esutil.BulkIndexerItem{
+			Action:     item.Action,
+			Index:      item.Index,
+			DocumentID: item.ID,
+			Body:       bytes.NewReader(item.Body),
+			OnSuccess: func(ctx context.Context, _ esutil.BulkIndexerItem, _ esutil.BulkIndexerResponseItem) {
+				counters.updated.Add(1)
+			},
+			OnFailure: func(ctx context.Context, bulkItem esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+				handleBulkIndexFailure(ctx, bulkItem, res, err)
+				c.observeBulkFailure(item.Action)
+				counters.failed.Add(1)
+				failed.add(newFailedItem(item.Index, item.Action, item.ID, item.Body, res, err))
+			},
+		}
+
+		if item.Action == "update" {
+			retryOnConflict := updateRetryOnConflict
+			bulkItem.RetryOnConflict = &retryOnConflict
+		}
+
+		err = indexer.Add(ctx, bulkItem)
+		if err != nil {
+			log.Printf("es retry error for document %q: %s\n", item.ID, err)
+			counters.failed.Add(1)
+			failed.add(newFailedItem(item.Index, item.Action, item.ID, item.Body, esutil.BulkIndexerResponseItem{}, err))
+		}
+	}
+
+	err = indexer.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RetryStats{
+		Succeeded:   int(counters.updated.Load()),
+		Failed:      int(counters.failed.Load()),
+		FailedItems: failed.list(),
+	}, nil
+}
@@ -0,0 +1,113 @@
+package es
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+func TestFailedItemsRoundTrip(t *testing.T) {
+	var res esutil.BulkIndexerResponseItem
+	res.Status = 400
+	res.Error.Type = "mapper_parsing_exception"
+	res.Error.Reason = "failed to parse field [domain]"
+
+	items := []FailedItem{
+		newFailedItem("companies", "update", "example.com", []byte(`{"doc":{"domain":1}}`), res, nil),
+		newFailedItem("companies", "index", "example.org", []byte(`{"domain":"https://example.org"}`),
+			esutil.BulkIndexerResponseItem{}, errors.New("connection reset")),
+	}
+
+	if items[0].Status != 400 || items[0].ErrorType != res.Error.Type || items[0].Reason != res.Error.Reason {
+		t.Errorf("Expected the item error to be kept, got %+v instead", items[0])
+	}
+	// Failed requests have no status, the transport error is the reason
+	if items[1].Status != 0 || items[1].Reason != "connection reset" {
+		t.Errorf("Expected the request error to be kept, got %+v instead", items[1])
+	}
+
+	var buffer bytes.Buffer
+	err := WriteFailedItems(&buffer, items)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if lines := strings.Count(buffer.String(), "\n"); lines != len(items) {
+		t.Errorf("Expected %d lines, got %d instead", len(items), lines)
+	}
+
+	decoded, err := ReadFailedItems(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	// Times are compared separately, the monotonic clock reading is lost in JSON
+	for index := range decoded {
+		if !decoded[index].FailedAt.Equal(items[index].FailedAt) {
+			t.Errorf("Expected failed_at %s, got %s instead", items[index].FailedAt, decoded[index].FailedAt)
+		}
+		decoded[index].FailedAt = time.Time{}
+		items[index].FailedAt = time.Time{}
+	}
+
+	if !reflect.DeepEqual(decoded, items) {
+		t.Errorf("Expected items %+v, got %+v instead", items, decoded)
+	}
+}
+
+func TestReadFailedItemsErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{name: "invalid json", input: "{\"id\": \n"},
+		{name: "missing body", input: `{"id": "example.com", "action": "update"}`},
+		{name: "missing id", input: `{"action": "update", "body": {}}`},
+		{name: "unsupported action", input: `{"id": "example.com", "action": "delete", "body": {}}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadFailedItems(strings.NewReader("\n" + tc.input))
+			if !errors.Is(err, ErrInvalidParams) {
+				t.Fatalf("Expected %v, got %v instead", ErrInvalidParams, err)
+			}
+			if !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("Expected the error to report line 2, got %q instead", err)
+			}
+		})
+	}
+}
+
+func TestAppendFailedItemsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.jsonl")
+
+	first := []FailedItem{{ID: "example.com", Action: "update", Body: []byte(`{"doc":{}}`)}}
+	second := []FailedItem{{ID: "example.org", Action: "index", Body: []byte(`{"domain":"example.org"}`)}}
+
+	for _, items := range [][]FailedItem{first, second} {
+		err := AppendFailedItemsToFile(path, items)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	items, err := LoadFailedItemsFromFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	if expected := []string{"example.com", "example.org"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected items %v, got %v instead", expected, ids)
+	}
+}
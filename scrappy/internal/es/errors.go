@@ -9,15 +9,95 @@ import (
 )
 
 var (
-	ErrMissingCACertificate = errors.New("missing CA certificate")
-	ErrSearchResult         = errors.New("error on search")
-	ErrUnexpectedResponse   = errors.New("unexpected response from ES")
-	ErrFailedRequest        = errors.New("failed request")
-	ErrNotFound             = errors.New("not found")
-	ErrInvalidIndex         = errors.New("invalid index")
-	ErrInvalidParams        = errors.New("invalid params")
+	ErrInvalidConfig      = errors.New("invalid ES config")
+	ErrConnection         = errors.New("failed to connect to ES")
+	ErrSearchResult       = errors.New("error on search")
+	ErrUnexpectedResponse = errors.New("unexpected response from ES")
+	ErrFailedRequest      = errors.New("failed request")
+	ErrNotFound           = errors.New("not found")
+	ErrInvalidIndex       = errors.New("invalid index")
+	ErrInvalidParams      = errors.New("invalid params")
+	// The request got no response, the cluster is unreachable or didn't answer in time
+	ErrUnavailable = errors.New("ES unavailable")
 )
 
+// requestError is a request which got no response from ES.
+//
+// The transport error is kept, so callers can check for timeouts using errors.Is.
+type requestError struct {
+	// ErrFailedRequest or ErrSearchResult
+	kind error
+	err  error
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("%s: %s", e.kind, e.err)
+}
+
+func (e *requestError) Is(target error) bool {
+	return target == e.kind || target == ErrUnavailable
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// requestFailed wraps the transport error of a request which got no response.
+func requestFailed(kind error, err error) error {
+	return &requestError{kind: kind, err: err}
+}
+
+// paramsError is an invalid parameter of a request.
+//
+// The validation error is kept, so callers can check for its cause using errors.Is,
+// e.g. phone.ErrInvalidNumber, as well as ErrInvalidParams.
+type paramsError struct {
+	err error
+}
+
+func (e *paramsError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidParams, e.err)
+}
+
+func (e *paramsError) Is(target error) bool {
+	return target == ErrInvalidParams
+}
+
+func (e *paramsError) Unwrap() error {
+	return e.err
+}
+
+// InvalidParams wraps the validation error of a request parameter.
+func InvalidParams(err error) error {
+	return &paramsError{err: err}
+}
+
+// handleResponse checks for network errors and errors returned by ES,
+// then decodes the response body into result, unless result is nil.
+func handleResponse(response *esapi.Response, err error, result any) error {
+	// Check network errors
+	if err != nil {
+		return requestFailed(ErrFailedRequest, err)
+	}
+	defer response.Body.Close()
+
+	// Check errors returned by ES
+	if response.IsError() {
+		return errorFromResponse(response)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+	}
+
+	return nil
+}
+
 // errorFromResponse extracts error information from the ElasticSearch response.
 func errorFromResponse(response *esapi.Response) error {
 	var e esErrorMessage
@@ -8,13 +8,14 @@ import (
 	"examples/scrappy/internal/csv"
 	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	elastic "github.com/elastic/go-elasticsearch/v8"
-	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/elastic/go-elasticsearch/v8/esutil"
 )
 
+// Name of the alias pointing to the current version of the companies index
 const companiesESIndex = "companies"
 
 // Helper type aliases for building nested payloads
@@ -22,35 +23,67 @@ type h map[string]interface{}
 type a []h
 
 // Config represents the credentials needed to connect to the ElasticSearch cluster.
+//
+// At most one authentication method may be set: username and password, an API key, or a bearer token.
+// Clusters are trusted using CACert, CertificateFingerprint, or the system certificates if neither is set.
 type Config struct {
 	Username string
 	Password string
+	// Base64 encoded API key, as returned by the create API key API
+	APIKey string
+	// Bearer token, e.g. a service account token
+	BearerToken string
 	// CA certificate for Elastic Search cluster
 	CACert []byte
+	// SHA256 fingerprint of the cluster CA certificate, hex encoded, printed by ES on first launch
+	CertificateFingerprint string
+	// Skip TLS certificate verification, only meant for local clusters
+	Insecure bool
+	// PEM encoded client certificate and key, for clusters requiring TLS client authentication
+	ClientCert []byte
+	ClientKey  []byte
 	// URL addresses of cluster replicas
 	Addresses []string
 
 	// Other ES config options that may optionally be set
 	CompaniesIndex string
+	// Notified of every request sent to the cluster, e.g. to export metrics
+	Observer Observer
 }
 
 // Client is a wrapper around the go-elasticsearch client.
 type Client struct {
 	client         *elastic.Client
 	companiesIndex string
+	addresses      []string
+	observer       Observer
 }
 
 func NewClient(config *Config) (*Client, error) {
-	if len(config.CACert) == 0 {
-		return nil, ErrMissingCACertificate
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if config.Observer != nil {
+		roundTripper = &observedTransport{next: transport, observer: config.Observer}
 	}
 
 	// Set extended client options
 	esConfig := elastic.Config{
-		Username:  config.Username,
-		Password:  config.Password,
-		CACert:    config.CACert,
-		Addresses: config.Addresses,
+		Username:     config.Username,
+		Password:     config.Password,
+		APIKey:       config.APIKey,
+		ServiceToken: config.BearerToken,
+		Addresses:    config.Addresses,
+		// TLS options are set on the transport, see newTransport
+		Transport: roundTripper,
 		// Options from:
 		// 		https://github.com/elastic/go-elasticsearch/blob/main/esutil/bulk_indexer_example_test.go
 		//
@@ -74,45 +107,119 @@ func NewClient(config *Config) (*Client, error) {
 		companiesIndex = companiesESIndex
 	}
 
-	return &Client{client: client, companiesIndex: companiesIndex}, nil
+	return &Client{
+		client:         client,
+		companiesIndex: companiesIndex,
+		addresses:      config.Addresses,
+		observer:       config.Observer,
+	}, nil
 }
 
-func (c *Client) Info() (*esapi.Response, error) {
-	return c.client.Info()
+// Bulk item results, as returned by ES, anything else is an update
+const (
+	bulkResultCreated = "created"
+	bulkResultNoop    = "noop"
+)
+
+// BulkIndexOptions controls how BulkIndexCompanies writes companies.
+type BulkIndexOptions struct {
+	// Replace existing companies, dropping fields added by the scraper (phone numbers...)
+	Overwrite bool
 }
 
-// BulkIndexCompanies will index the companies into the ElasticSearch "companies" index.
+// BulkIndexStats counts the companies by the outcome of their bulk write.
+type BulkIndexStats struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Failed    int
+	// Companies which couldn't be written, with the reason
+	FailedItems []FailedItem
+}
+
+// bulkIndexCounters collects the outcome of each bulk item,
+// the bulk indexer calls OnSuccess and OnFailure from several goroutines.
+type bulkIndexCounters struct {
+	created   atomic.Int64
+	updated   atomic.Int64
+	unchanged atomic.Int64
+	failed    atomic.Int64
+}
+
+func (b *bulkIndexCounters) stats() *BulkIndexStats {
+	return &BulkIndexStats{
+		Created:   int(b.created.Load()),
+		Updated:   int(b.updated.Load()),
+		Unchanged: int(b.unchanged.Load()),
+		Failed:    int(b.failed.Load()),
+	}
+}
+
+// BulkIndexCompanies will write the companies into the ElasticSearch "companies" index.
+//
+// Companies are upserted: fields read from the CSV file replace the stored ones,
+// while fields added since (phone numbers, Facebook page...) are kept.
+// Companies whose CSV fields didn't change are left untouched, and counted as unchanged.
+// With options.Overwrite, companies are replaced as a whole instead.
 //
 // https://github.com/elastic/go-elasticsearch/blob/main/esutil/bulk_indexer_example_test.go
-func (c *Client) BulkIndexCompanies(companies []csv.Company) (*esutil.BulkIndexerStats, error) {
+func (c *Client) BulkIndexCompanies(companies []csv.Company, options *BulkIndexOptions) (*BulkIndexStats, error) {
 	ctx := context.Background()
+	overwrite := options != nil && options.Overwrite
 
 	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
 		Client: c.client,
-		Index:  companiesESIndex,
+		Index:  c.companiesIndex,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	var counters bulkIndexCounters
+	var failed failedItems
+
+	onSuccess := func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+		handleBulkIndexSuccess(ctx, item, res)
+
+		switch res.Result {
+		case bulkResultCreated:
+			counters.created.Add(1)
+		case bulkResultNoop:
+			counters.unchanged.Add(1)
+		default:
+			counters.updated.Add(1)
+		}
+	}
+
 	for _, company := range companies {
-		payload, err := json.Marshal(company)
+		action, payload, err := companyBulkAction(&company, overwrite)
 		if err != nil {
 			return nil, err
 		}
 
+		// We use the domain host of the company as a natural key
+		id := company.Domain.Hostname()
+
+		onFailure := func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			handleBulkIndexFailure(ctx, item, res, err)
+			c.observeBulkFailure(action)
+			counters.failed.Add(1)
+			failed.add(newFailedItem(c.companiesIndex, action, id, payload, res, err))
+		}
+
 		err = indexer.Add(ctx, esutil.BulkIndexerItem{
-			Action: "index",
-			// We use the domain host of the company as a natural key
-			DocumentID: company.Domain.Hostname(),
+			Action:     action,
+			DocumentID: id,
 			Body:       bytes.NewReader(payload),
-			OnSuccess:  handleBulkIndexSuccess,
-			OnFailure:  handleBulkIndexFailure,
+			OnSuccess:  onSuccess,
+			OnFailure:  onFailure,
 		})
 
 		if err != nil {
 			log.Printf("es index error for company: %q\n", &company.Domain)
+			counters.failed.Add(1)
+			failed.add(newFailedItem(c.companiesIndex, action, id, payload, esutil.BulkIndexerResponseItem{}, err))
 		}
 	}
 
@@ -122,8 +229,46 @@ func (c *Client) BulkIndexCompanies(companies []csv.Company) (*esutil.BulkIndexe
 		return nil, err
 	}
 
-	stats := indexer.Stats()
-	return &stats, nil
+	stats := counters.stats()
+	stats.FailedItems = failed.list()
+	return stats, nil
+}
+
+// companyBulkAction returns the bulk action and body writing a company.
+//
+// Companies are replaced using the "index" action when overwriting,
+// otherwise they are partially updated, or created if missing, using the "update" action.
+func companyBulkAction(company *csv.Company, overwrite bool) (string, []byte, error) {
+	doc := newCompanyDocument(company)
+
+	if overwrite {
+		payload, err := json.Marshal(doc)
+		return "index", payload, err
+	}
+
+	payload, err := json.Marshal(h{
+		"doc":           doc,
+		"doc_as_upsert": true,
+	})
+	return "update", payload, err
+}
+
+// companyDocument is the indexed form of a company.
+type companyDocument struct {
+	*csv.Company
+	// Facebook page of a facebook CSV column, normalized to facebook.com/<page> for matching
+	Facebook string `json:"facebook,omitempty"`
+}
+
+func newCompanyDocument(company *csv.Company) *companyDocument {
+	doc := &companyDocument{Company: company}
+
+	if page, ok := company.Attributes[csv.FieldFacebook]; ok {
+		// Pages which aren't Facebook URLs are only kept as they were written, in the attributes
+		doc.Facebook, _ = NormalizeFacebookURL(page)
+	}
+
+	return doc
 }
 
 func handleBulkIndexSuccess(
@@ -148,8 +293,10 @@ func handleBulkIndexFailure(
 	}
 }
 
+// urlToId returns the document id of the company with the given url,
+// which is the registrable domain of its host.
 func urlToId(url string) (string, error) {
-	parsedUrl, err := csv.ParseURL(url)
+	parsedUrl, err := csv.NormalizeURL(url)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,60 @@
+package es
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"examples/scrappy/internal/csv"
+)
+
+func TestCompanyBulkAction(t *testing.T) {
+	company := csv.Company{
+		Domain:         csv.JSONUrl{URL: &url.URL{Scheme: "https", Host: "acme.com"}},
+		CommercialName: "Acme",
+		Attributes:     map[string]string{"facebook": "https://www.facebook.com/AcmeInc/"},
+	}
+
+	// Upserts only send the CSV fields, so scraped fields are kept
+	action, payload, err := companyBulkAction(&company, false)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var update struct {
+		Doc         map[string]interface{} `json:"doc"`
+		DocAsUpsert bool                   `json:"doc_as_upsert"`
+	}
+	err = json.Unmarshal(payload, &update)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if action != "update" || !update.DocAsUpsert || update.Doc["commercial_name"] != "Acme" {
+		t.Errorf("Expected upsert of the company, got %s %s", action, payload)
+	}
+
+	if update.Doc["facebook"] != "facebook.com/acmeinc" {
+		t.Errorf("Expected normalized facebook page in upsert %s", payload)
+	}
+
+	if _, found := update.Doc["phone_numbers"]; found {
+		t.Errorf("Expected no phone numbers in upsert %s", payload)
+	}
+
+	// Overwrites replace the whole document
+	action, payload, err = companyBulkAction(&company, true)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(payload, &doc)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if action != "index" || doc["domain"] != "https://acme.com" {
+		t.Errorf("Expected company document to be indexed, got %s %s", action, payload)
+	}
+}
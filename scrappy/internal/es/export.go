@@ -0,0 +1,179 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Number of companies fetched for each export search request
+const defaultExportBatchSize = 500
+
+// How long ES keeps the point in time alive between export search requests
+const exportKeepAlive = "1m"
+
+// ExportOptions filters the companies returned by ExportCompanies.
+type ExportOptions struct {
+	// Only export companies which have a value for each of these fields (e.g. "phone_numbers")
+	HasFields []string
+	// Only export companies matching this query string (Lucene syntax)
+	Query string
+	// Number of companies fetched for each search request
+	BatchSize int
+}
+
+type exportCompanyFunc func(company *Company) error
+
+// ExportCompanies streams every company matching the options to handleCompany.
+//
+// Companies are read from a point in time of the companies index,
+// paging through the results using search_after, so the export
+// is consistent even if companies are updated while it runs.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/paginate-search-results.html#search-after
+func (c *Client) ExportCompanies(ctx context.Context, options *ExportOptions, handleCompany exportCompanyFunc) error {
+	pitID, err := c.openPointInTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Always release the point in time, the ES cluster keeps resources around for it
+	defer func() {
+		// Use a fresh context, since ctx may have been cancelled
+		closeErr := c.closePointInTime(context.Background(), pitID)
+		if closeErr != nil {
+			log.Printf("es failed to close point in time: %s\n", closeErr)
+		}
+	}()
+
+	var searchAfter []interface{}
+	for {
+		query := exportQuery(options, pitID, searchAfter)
+
+		res, err := c.client.Search(
+			c.client.Search.WithBody(query),
+			c.client.Search.WithContext(ctx),
+		)
+		// Check network errors
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrSearchResult, err)
+		}
+
+		envelope, err := decodeSearchResponse(res)
+		if err != nil {
+			return err
+		}
+
+		// The point in time id may change between requests, the latest one is closed
+		if envelope.PitID != "" {
+			pitID = envelope.PitID
+		}
+
+		hits := envelope.Hits.Hits
+		if len(hits) == 0 {
+			return nil
+		}
+
+		companies, err := envelope.companies()
+		if err != nil {
+			return err
+		}
+
+		for index := range companies {
+			err = handleCompany(&companies[index])
+			if err != nil {
+				return err
+			}
+		}
+
+		searchAfter = hits[len(hits)-1].Sort
+	}
+}
+
+func (c *Client) openPointInTime(ctx context.Context) (string, error) {
+	res, err := c.client.OpenPointInTime([]string{c.companiesIndex}, exportKeepAlive,
+		c.client.OpenPointInTime.WithContext(ctx),
+	)
+	// Check network errors
+	if err != nil {
+		return "", requestFailed(ErrFailedRequest, err)
+	}
+	defer res.Body.Close()
+
+	// Check errors returned by ES
+	if res.IsError() {
+		return "", errorFromResponse(res)
+	}
+
+	var envelope struct {
+		ID string `json:"id"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&envelope)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+	}
+
+	return envelope.ID, nil
+}
+
+func (c *Client) closePointInTime(ctx context.Context, pitID string) error {
+	body, _ := json.Marshal(h{"id": pitID})
+
+	res, err := c.client.ClosePointInTime(
+		c.client.ClosePointInTime.WithBody(bytes.NewReader(body)),
+		c.client.ClosePointInTime.WithContext(ctx),
+	)
+	// Check network errors
+	if err != nil {
+		return requestFailed(ErrFailedRequest, err)
+	}
+	defer res.Body.Close()
+
+	// Check errors returned by ES
+	if res.IsError() {
+		return errorFromResponse(res)
+	}
+
+	return nil
+}
+
+func exportQuery(options *ExportOptions, pitID string, searchAfter []interface{}) io.Reader {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultExportBatchSize
+	}
+
+	filters := a{}
+	for _, field := range options.HasFields {
+		filters = append(filters, h{"exists": h{"field": field}})
+	}
+
+	if options.Query != "" {
+		filters = append(filters, h{"query_string": h{"query": options.Query}})
+	}
+
+	esQuery := h{
+		"size": batchSize,
+		"query": h{
+			"bool": h{"filter": filters},
+		},
+		"pit": h{
+			"id":         pitID,
+			"keep_alive": exportKeepAlive,
+		},
+		// _shard_doc is the most efficient sort order when paging through a point in time
+		"sort": a{
+			h{"_shard_doc": "asc"},
+		},
+	}
+
+	if len(searchAfter) > 0 {
+		esQuery["search_after"] = searchAfter
+	}
+
+	encoded, _ := json.Marshal(esQuery)
+	return bytes.NewReader(encoded)
+}
@@ -0,0 +1,213 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExportQuery(t *testing.T) {
+	testCases := []struct {
+		name                string
+		options             *ExportOptions
+		searchAfter         []interface{}
+		expectedSize        float64
+		expectedFilters     string
+		expectedSearchAfter []interface{}
+	}{
+		{
+			name:            "default options",
+			options:         &ExportOptions{},
+			expectedSize:    defaultExportBatchSize,
+			expectedFilters: `[]`,
+		},
+		{
+			name:            "filters",
+			options:         &ExportOptions{HasFields: []string{"phone_numbers"}, Query: "attributes.country:US", BatchSize: 50},
+			expectedSize:    50,
+			expectedFilters: `[{"exists":{"field":"phone_numbers"}},{"query_string":{"query":"attributes.country:US"}}]`,
+		},
+		{
+			name:                "next page",
+			options:             &ExportOptions{},
+			searchAfter:         []interface{}{json.Number("42")},
+			expectedSize:        defaultExportBatchSize,
+			expectedFilters:     `[]`,
+			expectedSearchAfter: []interface{}{float64(42)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var query struct {
+				Size  float64
+				Query struct {
+					Bool struct {
+						Filter json.RawMessage
+					}
+				}
+				Pit struct {
+					ID        string
+					KeepAlive string `json:"keep_alive"`
+				}
+				Sort        []map[string]string
+				SearchAfter []interface{} `json:"search_after"`
+			}
+			err := json.NewDecoder(exportQuery(tc.options, "pit-1", tc.searchAfter)).Decode(&query)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			if query.Size != tc.expectedSize {
+				t.Errorf("Expected size %v, got %v instead", tc.expectedSize, query.Size)
+			}
+			if string(query.Query.Bool.Filter) != tc.expectedFilters {
+				t.Errorf("Expected filters %s, got %s instead", tc.expectedFilters, query.Query.Bool.Filter)
+			}
+			if query.Pit.ID != "pit-1" || query.Pit.KeepAlive != exportKeepAlive {
+				t.Errorf("Expected point in time pit-1, got %+v instead", query.Pit)
+			}
+			if len(query.Sort) != 1 || query.Sort[0]["_shard_doc"] != "asc" {
+				t.Errorf("Expected _shard_doc sort, got %v instead", query.Sort)
+			}
+			if !reflect.DeepEqual(query.SearchAfter, tc.expectedSearchAfter) {
+				t.Errorf("Expected search_after %v, got %v instead", tc.expectedSearchAfter, query.SearchAfter)
+			}
+		})
+	}
+}
+
+// exportServer answers export requests with pages of companies,
+// and records the point in time and search_after value of each search.
+type exportServer struct {
+	pages [][]string
+
+	mu       sync.Mutex
+	searches []string
+	closed   []string
+}
+
+func (s *exportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	body, _ := io.ReadAll(r.Body)
+	var request struct {
+		ID  string
+		Pit struct {
+			ID string
+		}
+		SearchAfter []int `json:"search_after"`
+	}
+	json.Unmarshal(body, &request)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/companies/_pit":
+		fmt.Fprint(w, `{"id": "pit-0"}`)
+
+	case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+		s.closed = append(s.closed, request.ID)
+		fmt.Fprint(w, `{"succeeded": true}`)
+
+	case r.URL.Path == "/_search":
+		page := len(request.SearchAfter)
+		if page > 0 {
+			page = request.SearchAfter[0]
+		}
+		s.searches = append(s.searches, fmt.Sprintf("%s %v", request.Pit.ID, request.SearchAfter))
+
+		var hits []string
+		if page < len(s.pages) {
+			for _, domain := range s.pages[page] {
+				hits = append(hits, fmt.Sprintf(`{"_id": %q, "_source": {"domain": "https://%s"}, "sort": [%d]}`,
+					domain, domain, page+1))
+			}
+		}
+
+		// ES may return a new point in time id with every page
+		fmt.Fprintf(w, `{"pit_id": "pit-%d", "hits": {"total": {"value": 0}, "hits": [%s]}}`,
+			page+1, strings.Join(hits, ","))
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error": {"type": "unexpected", "reason": "%s %s"}}`, r.Method, r.URL.Path)
+	}
+}
+
+func TestExportCompanies(t *testing.T) {
+	handlerErr := errors.New("disk full")
+
+	testCases := []struct {
+		name             string
+		pages            [][]string
+		handlerErr       error
+		expectedIDs      []string
+		expectedSearches []string
+		expectedClosed   string
+	}{
+		{
+			name:             "pages",
+			pages:            [][]string{{"acme.com", "mazautoglass.com"}, {"putitontheglass.com"}},
+			expectedIDs:      []string{"acme.com", "mazautoglass.com", "putitontheglass.com"},
+			expectedSearches: []string{"pit-0 []", "pit-1 [1]", "pit-2 [2]"},
+			expectedClosed:   "pit-3",
+		},
+		{
+			name:             "no companies",
+			expectedSearches: []string{"pit-0 []"},
+			expectedClosed:   "pit-1",
+		},
+		{
+			// The point in time is released when the export fails
+			name:             "handler error",
+			pages:            [][]string{{"acme.com", "mazautoglass.com"}},
+			handlerErr:       handlerErr,
+			expectedIDs:      []string{"acme.com"},
+			expectedSearches: []string{"pit-0 []"},
+			expectedClosed:   "pit-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			esServer := &exportServer{pages: tc.pages}
+			server := httptest.NewServer(esServer)
+			defer server.Close()
+
+			client, err := NewClient(&Config{Addresses: []string{server.URL}})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			var ids []string
+			err = client.ExportCompanies(context.Background(), &ExportOptions{}, func(company *Company) error {
+				ids = append(ids, company.ID)
+				return tc.handlerErr
+			})
+			if !errors.Is(err, tc.handlerErr) {
+				t.Errorf("Expected error %v, got %v instead", tc.handlerErr, err)
+			}
+
+			if !reflect.DeepEqual(ids, tc.expectedIDs) {
+				t.Errorf("Expected companies %v, got %v instead", tc.expectedIDs, ids)
+			}
+			if !reflect.DeepEqual(esServer.searches, tc.expectedSearches) {
+				t.Errorf("Expected searches %v, got %v instead", tc.expectedSearches, esServer.searches)
+			}
+			if len(esServer.closed) != 1 || esServer.closed[0] != tc.expectedClosed {
+				t.Errorf("Expected point in time %s to be closed, got %v instead", tc.expectedClosed, esServer.closed)
+			}
+		})
+	}
+}
@@ -4,14 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 )
 
 type getCompanyResult struct {
-	Found   bool    `json:"found"`
-	Company Company `json:"_source"`
+	Found       bool    `json:"found"`
+	Index       string  `json:"_index"`
+	SeqNo       int64   `json:"_seq_no"`
+	PrimaryTerm int64   `json:"_primary_term"`
+	Company     Company `json:"_source"`
+	// Set when the request failed, e.g. the index doesn't exist
+	Error *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
 }
 
-// GetCompany gets a company from ElasticSearch by url.
+// GetCompany gets a company from ElasticSearch by url,
+// with the document version set.
 //
 // If the company can't be found, ErrNotFound is returned.
 func (c *Client) GetCompany(ctx context.Context, url string) (*Company, error) {
@@ -25,25 +35,32 @@ func (c *Client) GetCompany(ctx context.Context, url string) (*Company, error) {
 	)
 
 	if err != nil {
-		return nil, err
+		return nil, requestFailed(ErrFailedRequest, err)
 	}
 	defer res.Body.Close()
 
-	// Check errors returned by ES
-	if res.IsError() {
+	// Missing documents are reported with a 404 status, and no error
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
 		return nil, errorFromResponse(res)
 	}
 
-	// Decode ES search response
+	// Decode ES get response
 	var envelope getCompanyResult
 	err = json.NewDecoder(res.Body).Decode(&envelope)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+		return nil, fmt.Errorf("%w: [%d] %s", ErrUnexpectedResponse, res.StatusCode, err)
+	}
+
+	if envelope.Error != nil {
+		return nil, fmt.Errorf("%w: [%s] %s: %s", ErrFailedRequest,
+			res.Status(), envelope.Error.Type, envelope.Error.Reason)
 	}
 
 	if !envelope.Found {
-		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
 	}
 
-	return &envelope.Company, nil
+	company := envelope.Company
+	company.Version = &DocumentVersion{Index: envelope.Index, SeqNo: envelope.SeqNo, PrimaryTerm: envelope.PrimaryTerm}
+	return &company, nil
 }
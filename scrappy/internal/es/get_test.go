@@ -0,0 +1,126 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetCompany(t *testing.T) {
+	testCases := []struct {
+		name            string
+		status          int
+		body            string
+		expectedVersion DocumentVersion
+		expectedError   error
+	}{
+		{
+			name:   "found",
+			status: http.StatusOK,
+			body: `{"_index": "companies_v2", "_id": "mazautoglass.com", "_seq_no": 12, "_primary_term": 2, "found": true,
+				"_source": {"domain": "https://mazautoglass.com", "commercial_name": "MAZ Auto Glass"}}`,
+			expectedVersion: DocumentVersion{Index: "companies_v2", SeqNo: 12, PrimaryTerm: 2},
+		},
+		{
+			name:          "missing document",
+			status:        http.StatusNotFound,
+			body:          `{"_index": "companies", "_id": "mazautoglass.com", "found": false}`,
+			expectedError: ErrNotFound,
+		},
+		{
+			name:   "missing index",
+			status: http.StatusNotFound,
+			body: `{"error": {"type": "index_not_found_exception", "reason": "no such index [companies]"},
+				"status": 404}`,
+			expectedError: ErrFailedRequest,
+		},
+		{
+			name:          "server error",
+			status:        http.StatusInternalServerError,
+			body:          `{"error": {"type": "exception", "reason": "boom"}, "status": 500}`,
+			expectedError: ErrFailedRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/companies/_doc/mazautoglass.com" {
+					t.Errorf("Unexpected request path %q", r.URL.Path)
+				}
+
+				w.Header().Set("X-Elastic-Product", "Elasticsearch")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client, err := NewClient(&Config{Addresses: []string{server.URL}})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			company, err := client.GetCompany(context.Background(), "https://mazautoglass.com/contact")
+			if tc.expectedError != nil {
+				if !errors.Is(err, tc.expectedError) {
+					t.Errorf("Expected error %v, got %v instead", tc.expectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if company.CommercialName != "MAZ Auto Glass" {
+				t.Errorf("Expected commercial name %q, got %q instead", "MAZ Auto Glass", company.CommercialName)
+			}
+			if company.Version == nil || *company.Version != tc.expectedVersion {
+				t.Errorf("Expected version %+v, got %+v instead", tc.expectedVersion, company.Version)
+			}
+		})
+	}
+}
+
+func TestGetCompanyUnavailable(t *testing.T) {
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slowServer.Close()
+
+	stoppedServer := httptest.NewServer(http.NotFoundHandler())
+	stoppedServer.Close()
+
+	testCases := []struct {
+		name          string
+		address       string
+		timeout       time.Duration
+		expectedCause error
+	}{
+		{name: "timeout", address: slowServer.URL, timeout: 50 * time.Millisecond, expectedCause: context.DeadlineExceeded},
+		{name: "unreachable", address: stoppedServer.URL, timeout: 10 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient(&Config{Addresses: []string{tc.address}})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+
+			_, err = client.GetCompany(ctx, "mazautoglass.com")
+			if !errors.Is(err, ErrUnavailable) || !errors.Is(err, ErrFailedRequest) {
+				t.Errorf("Expected %v and %v, got %v instead", ErrUnavailable, ErrFailedRequest, err)
+			}
+			if tc.expectedCause != nil && !errors.Is(err, tc.expectedCause) {
+				t.Errorf("Expected cause %v, got %v instead", tc.expectedCause, err)
+			}
+		})
+	}
+}
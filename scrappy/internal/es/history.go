@@ -0,0 +1,279 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// Every scrape of a domain is recorded in a monthly time-series index (scrapes-2022.11),
+// so changes of the company contact data can be followed over time,
+// while the companies index only holds the latest state.
+//
+// The indices are created on first write, using the mapping of the scrapes index template.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/index-templates.html
+
+const (
+	scrapesIndexPrefix  = "scrapes-"
+	scrapesIndexLayout  = "2006.01"
+	scrapesTemplateName = "scrapes"
+)
+
+// Number of scrapes returned by ScrapeHistory, unless a limit is given
+const DefaultScrapeHistoryLimit = 20
+
+// Maximum number of scrapes returned by ScrapeHistory
+const maxScrapeHistoryLimit = 1000
+
+// ScrapeRecord is the outcome of a scrape of a company website.
+type ScrapeRecord struct {
+	// Company id, set by ScrapeHistoryWriter.Add
+	Domain    string    `json:"domain"`
+	URL       string    `json:"url"`
+	ScrapedAt time.Time `json:"scraped_at"`
+	// Scrape duration in milliseconds
+	DurationMillis int64           `json:"duration_ms"`
+	PagesVisited   []string        `json:"pages_visited"`
+	PhoneNumbers   []PhoneSighting `json:"phone_numbers"`
+	Statuses       []PageStatus    `json:"statuses"`
+	Errors         []string        `json:"errors"`
+}
+
+// PageStatus is the HTTP status of a page requested by a scrape, 0 if no response was received.
+type PageStatus struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// ScrapeHistoryEntry is a recorded scrape, with the phone numbers changes since the previous one.
+type ScrapeHistoryEntry struct {
+	ScrapeRecord
+	// Numbers found that weren't found by the previous scrape
+	Added []string `json:"added,omitempty"`
+	// Numbers found by the previous scrape that weren't found anymore
+	Removed []string `json:"removed,omitempty"`
+}
+
+// ScrapeHistoryStats counts the scrapes by the outcome of their bulk write.
+type ScrapeHistoryStats struct {
+	Recorded int
+	Failed   int
+}
+
+// ScrapeHistoryWriter records scrapes in the scrapes indices, using bulk requests.
+type ScrapeHistoryWriter struct {
+	client   *Client
+	indexer  esutil.BulkIndexer
+	recorded atomic.Int64
+	failed   atomic.Int64
+}
+
+// NewScrapeHistoryWriter creates the scrapes index template if needed,
+// and returns a writer which must be closed once every scrape was added.
+func (c *Client) NewScrapeHistoryWriter(ctx context.Context) (*ScrapeHistoryWriter, error) {
+	err := c.putScrapesTemplate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scrapes index template: %w", err)
+	}
+
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client: c.client,
+		OnError: func(ctx context.Context, err error) {
+			log.Printf("es bulk scrape history error: %s\n", err)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScrapeHistoryWriter{client: c, indexer: indexer}, nil
+}
+
+// Add queues a scrape, written to the index of the month it was scraped in.
+func (w *ScrapeHistoryWriter) Add(ctx context.Context, record *ScrapeRecord) error {
+	id, err := urlToId(record.URL)
+	if err != nil {
+		return err
+	}
+
+	record.Domain = id
+	record.ScrapedAt = record.ScrapedAt.UTC()
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return w.indexer.Add(ctx, esutil.BulkIndexerItem{
+		Action: "create",
+		Index:  scrapesIndexName(record.ScrapedAt),
+		Body:   bytes.NewReader(body),
+		OnSuccess: func(ctx context.Context, _ esutil.BulkIndexerItem, _ esutil.BulkIndexerResponseItem) {
+			w.recorded.Add(1)
+		},
+		OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			handleBulkIndexFailure(ctx, esutil.BulkIndexerItem{DocumentID: id}, res, err)
+			w.client.observeBulkFailure("create")
+			w.failed.Add(1)
+		},
+	})
+}
+
+// Close flushes the queued scrapes, and returns the stats of the run.
+func (w *ScrapeHistoryWriter) Close(ctx context.Context) (*ScrapeHistoryStats, error) {
+	err := w.indexer.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScrapeHistoryStats{
+		Recorded: int(w.recorded.Load()),
+		Failed:   int(w.failed.Load()),
+	}, nil
+}
+
+// ScrapeHistory returns the latest scrapes of the company with the given url, newest first,
+// with the phone numbers added and removed by each scrape.
+//
+// A limit of 0 uses DefaultScrapeHistoryLimit.
+func (c *Client) ScrapeHistory(ctx context.Context, url string, limit int) ([]ScrapeHistoryEntry, error) {
+	id, err := urlToId(url)
+	if err != nil {
+		return nil, InvalidParams(err)
+	}
+
+	if limit == 0 {
+		limit = DefaultScrapeHistoryLimit
+	}
+	if limit < 0 || limit > maxScrapeHistoryLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidParams, maxScrapeHistoryLimit)
+	}
+
+	body, _ := json.Marshal(h{
+		"size":  limit,
+		"query": h{"term": h{"domain": id}},
+		"sort":  a{h{"scraped_at": "desc"}},
+	})
+
+	// No scrapes index exists before the first scrape
+	res, err := c.client.Search(
+		c.client.Search.WithIndex(scrapesIndexPrefix+"*"),
+		c.client.Search.WithBody(bytes.NewReader(body)),
+		c.client.Search.WithAllowNoIndices(true),
+		c.client.Search.WithIgnoreUnavailable(true),
+		c.client.Search.WithContext(ctx),
+	)
+
+	var envelope struct {
+		Hits struct {
+			Hits []struct {
+				Source ScrapeRecord `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = handleResponse(res, err, &envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ScrapeHistoryEntry, 0, len(envelope.Hits.Hits))
+	for _, hit := range envelope.Hits.Hits {
+		entries = append(entries, ScrapeHistoryEntry{ScrapeRecord: hit.Source})
+	}
+
+	setPhoneNumberChanges(entries)
+	return entries, nil
+}
+
+// setPhoneNumberChanges compares the numbers found by each scrape with the previous one,
+// entries are sorted newest first.
+//
+// Scrapes which didn't visit any page are skipped, so a failed scrape doesn't remove every number.
+// The oldest scrape has no previous one, and no changes.
+func setPhoneNumberChanges(entries []ScrapeHistoryEntry) {
+	var previous map[string]bool
+
+	for index := len(entries) - 1; index >= 0; index-- {
+		entry := &entries[index]
+		if len(entry.PagesVisited) == 0 {
+			continue
+		}
+
+		current := map[string]bool{}
+		for _, sighting := range entry.PhoneNumbers {
+			current[sighting.Number] = true
+		}
+
+		if previous != nil {
+			entry.Added = difference(current, previous)
+			entry.Removed = difference(previous, current)
+		}
+		previous = current
+	}
+}
+
+// difference returns the sorted keys of left missing from right.
+func difference(left map[string]bool, right map[string]bool) []string {
+	var result []string
+	for key := range left {
+		if !right[key] {
+			result = append(result, key)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func scrapesIndexName(scrapedAt time.Time) string {
+	return scrapesIndexPrefix + scrapedAt.UTC().Format(scrapesIndexLayout)
+}
+
+// putScrapesTemplate creates or updates the scrapes index template.
+func (c *Client) putScrapesTemplate(ctx context.Context) error {
+	body, _ := json.Marshal(scrapesIndexTemplate())
+
+	res, err := c.client.Indices.PutIndexTemplate(scrapesTemplateName, bytes.NewReader(body),
+		c.client.Indices.PutIndexTemplate.WithContext(ctx),
+	)
+
+	return handleResponse(res, err, nil)
+}
+
+func scrapesIndexTemplate() h {
+	return h{
+		"index_patterns": []string{scrapesIndexPrefix + "*"},
+		"template": h{
+			"mappings": h{
+				"properties": h{
+					"domain":        h{"type": "keyword"},
+					"url":           h{"type": "keyword"},
+					"scraped_at":    h{"type": "date"},
+					"duration_ms":   h{"type": "long"},
+					"pages_visited": h{"type": "keyword"},
+					"phone_numbers": h{
+						"properties": h{
+							"number":     h{"type": "keyword"},
+							"source":     h{"type": "keyword"},
+							"confidence": h{"type": "integer"},
+						},
+					},
+					"statuses": h{
+						"properties": h{
+							"url":    h{"type": "keyword"},
+							"status": h{"type": "integer"},
+						},
+					},
+					"errors": h{"type": "text"},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package es
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScrapesIndexName(t *testing.T) {
+	// Scrapes are bucketed by their UTC month
+	scrapedAt := time.Date(2022, time.December, 1, 1, 0, 0, 0, time.FixedZone("EET", 2*60*60))
+
+	if name := scrapesIndexName(scrapedAt); name != "scrapes-2022.11" {
+		t.Errorf("Expected %q, got %q instead", "scrapes-2022.11", name)
+	}
+}
+
+func TestSetPhoneNumberChanges(t *testing.T) {
+	scrape := func(pages int, numbers ...string) ScrapeHistoryEntry {
+		entry := ScrapeHistoryEntry{}
+		for index := 0; index < pages; index++ {
+			entry.PagesVisited = append(entry.PagesVisited, "https://example.com/")
+		}
+		for _, number := range numbers {
+			entry.PhoneNumbers = append(entry.PhoneNumbers, PhoneSighting{Number: number})
+		}
+		return entry
+	}
+
+	// Newest first
+	entries := []ScrapeHistoryEntry{
+		scrape(2, "+1 617-491-1000", "+1 415-626-4474"),
+		// Failed scrape, doesn't count as removing every number
+		scrape(0),
+		scrape(1, "+1 617-491-1000", "+1 212-555-0100"),
+		scrape(1, "+1 617-491-1000"),
+	}
+
+	setPhoneNumberChanges(entries)
+
+	expected := []struct {
+		added   []string
+		removed []string
+	}{
+		{added: []string{"+1 415-626-4474"}, removed: []string{"+1 212-555-0100"}},
+		{},
+		{added: []string{"+1 212-555-0100"}},
+		// Oldest scrape, nothing to compare with
+		{},
+	}
+
+	for index, entry := range entries {
+		if !reflect.DeepEqual(entry.Added, expected[index].added) {
+			t.Errorf("Expected scrape %d to add %v, got %v instead", index, expected[index].added, entry.Added)
+		}
+		if !reflect.DeepEqual(entry.Removed, expected[index].removed) {
+			t.Errorf("Expected scrape %d to remove %v, got %v instead", index, expected[index].removed, entry.Removed)
+		}
+	}
+}
@@ -6,51 +6,400 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Index management functions examples from:
 // https://github.com/elastic/go-elasticsearch/blob/main/_examples/xkcdsearch/store.go
 
-func (c *Client) CreateCompanyIndex(ctx context.Context, indexName string) error {
-	if indexName != c.companiesIndex {
-		return fmt.Errorf("%w: only %s index is currently supported", ErrInvalidIndex, c.companiesIndex)
+// Companies are stored in versioned indices (companies_v1, companies_v2...),
+// with the companies index name used as an alias pointing to the current one.
+// Incompatible mapping changes are rolled out by reindexing into a new version, then swapping the alias,
+// see mappingMigrations.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/aliases.html
+
+// IndexInfo describes one of the companies indices.
+type IndexInfo struct {
+	Name      string `json:"index"`
+	Health    string `json:"health"`
+	Status    string `json:"status"`
+	DocsCount string `json:"docs.count"`
+	StoreSize string `json:"store.size"`
+	// True if the companies alias points to this index
+	Current bool `json:"-"`
+}
+
+// ReindexResult describes a completed reindex.
+type ReindexResult struct {
+	Source string
+	Dest   string
+	Count  int
+}
+
+// CreateCompanyIndex creates the first version of the companies index,
+// and points the companies alias to it.
+//
+// The name of the created index is returned.
+func (c *Client) CreateCompanyIndex(ctx context.Context) (string, error) {
+	current, err := c.currentCompanyIndex(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if current != "" {
+		return "", fmt.Errorf("%w: %s already points to %s, use reindex to change the mapping",
+			ErrInvalidIndex, c.companiesIndex, current)
+	}
+
+	indexName := c.versionedIndexName(1)
+	err = c.createIndex(ctx, indexName, true)
+	return indexName, err
+}
+
+// ReindexCompanies copies every company into a new version of the companies index,
+// created using the current mapping, and swaps the companies alias to it
+// once the document counts of both indices match.
+//
+// Documents written to the old index while the reindex runs are not copied,
+// so writers (import, scrape) should be paused until the alias is swapped.
+func (c *Client) ReindexCompanies(ctx context.Context) (*ReindexResult, error) {
+	source, err := c.currentCompanyIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if source == "" {
+		return nil, fmt.Errorf("%w: %s index", ErrNotFound, c.companiesIndex)
+	}
+
+	nextVersion, err := c.nextIndexVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dest := c.versionedIndexName(nextVersion)
+	err = c.createIndex(ctx, dest, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.reindex(ctx, source, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check all documents were copied before swapping the alias
+	sourceCount, err := c.countDocuments(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	destCount, err := c.countDocuments(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	if sourceCount != destCount {
+		return nil, fmt.Errorf("%w: %s has %d documents, %s has %d, alias not swapped",
+			ErrFailedRequest, source, sourceCount, dest, destCount)
+	}
+
+	// The counts match, so a legacy source index can be deleted
+	err = c.swapCompanyAlias(ctx, source, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReindexResult{Source: source, Dest: dest, Count: destCount}, nil
+}
+
+// SetCompanyAlias atomically points the companies alias to indexName.
+//
+// A legacy unversioned index is never replaced, since replacing it with the alias deletes it,
+// it's migrated by ReindexCompanies once every document was copied.
+func (c *Client) SetCompanyAlias(ctx context.Context, indexName string) error {
+	if !c.isCompanyIndex(indexName) {
+		return fmt.Errorf("%w: %s is not a %s index", ErrInvalidIndex, indexName, c.companiesIndex)
+	}
+
+	current, err := c.currentCompanyIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == indexName {
+		return nil
+	}
+
+	if current == c.companiesIndex {
+		return fmt.Errorf("%w: %s is a legacy unversioned index, which would be deleted, use reindex to migrate it",
+			ErrInvalidIndex, current)
+	}
+
+	return c.swapCompanyAlias(ctx, current, indexName)
+}
+
+// swapCompanyAlias atomically moves the companies alias from current, "" if there is no index, to indexName.
+//
+// A legacy unversioned current index is deleted, callers must check its documents were copied first.
+func (c *Client) swapCompanyAlias(ctx context.Context, current string, indexName string) error {
+	actions := a{
+		h{"add": h{"index": indexName, "alias": c.companiesIndex}},
+	}
+
+	switch {
+	case current == c.companiesIndex:
+		// Legacy, unversioned index using the alias name,
+		// which has to be removed for the alias to be created.
+		actions = append(actions, h{"remove_index": h{"index": current}})
+	case current != "":
+		actions = append(actions, h{"remove": h{"index": current, "alias": c.companiesIndex}})
+	}
+
+	body, _ := json.Marshal(h{"actions": actions})
+	res, err := c.client.Indices.UpdateAliases(bytes.NewReader(body),
+		c.client.Indices.UpdateAliases.WithContext(ctx),
+	)
+
+	return handleResponse(res, err, nil)
+}
+
+// ListCompanyIndices lists the companies indices, sorted by name.
+func (c *Client) ListCompanyIndices(ctx context.Context) ([]IndexInfo, error) {
+	catAPI := c.client.Cat
+
+	res, err := catAPI.Indices(
+		catAPI.Indices.WithIndex(c.companiesIndex+"*"),
+		catAPI.Indices.WithFormat("json"),
+		catAPI.Indices.WithS("index"),
+		catAPI.Indices.WithContext(ctx),
+	)
+
+	var indices []IndexInfo
+	err = handleResponse(res, err, &indices)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.currentCompanyIndex(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	for index := range indices {
+		indices[index].Current = indices[index].Name == current
+	}
+
+	return indices, nil
+}
+
+// DeleteCompanyIndex deletes one of the companies indices.
+//
+// The index the companies alias points to can't be deleted.
+func (c *Client) DeleteCompanyIndex(ctx context.Context, indexName string) error {
+	if !c.isCompanyIndex(indexName) {
+		return fmt.Errorf("%w: %s is not a %s index", ErrInvalidIndex, indexName, c.companiesIndex)
+	}
+
+	current, err := c.currentCompanyIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == indexName {
+		return fmt.Errorf("%w: %s is the current %s index", ErrInvalidIndex, indexName, c.companiesIndex)
+	}
+
+	res, err := c.client.Indices.Delete([]string{indexName},
+		c.client.Indices.Delete.WithContext(ctx),
+	)
+
+	return handleResponse(res, err, nil)
+}
+
+// CurrentCompanyIndex returns the name of the index the companies alias points to.
+func (c *Client) CurrentCompanyIndex(ctx context.Context) (string, error) {
+	current, err := c.currentCompanyIndex(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if current == "" {
+		return "", fmt.Errorf("%w: %s index", ErrNotFound, c.companiesIndex)
+	}
+
+	return current, nil
+}
+
+// currentCompanyIndex returns the name of the index the companies alias points to,
+// the alias name itself for legacy unversioned indices, or "" if there is no index.
+func (c *Client) currentCompanyIndex(ctx context.Context) (string, error) {
+	indicesAPI := c.client.Indices
+
+	res, err := indicesAPI.GetAlias(
+		indicesAPI.GetAlias.WithName(c.companiesIndex),
+		indicesAPI.GetAlias.WithContext(ctx),
+	)
+	if err != nil {
+		return "", requestFailed(ErrFailedRequest, err)
+	}
+
+	// The alias doesn't exist, check for a legacy unversioned index
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return c.legacyCompanyIndex(ctx)
+	}
+
+	// Response maps index names to their aliases
+	var aliases map[string]json.RawMessage
+	err = handleResponse(res, nil, &aliases)
+	if err != nil {
+		return "", err
+	}
+
+	indices := make([]string, 0, len(aliases))
+	for indexName := range aliases {
+		indices = append(indices, indexName)
+	}
+
+	if len(indices) != 1 {
+		sort.Strings(indices)
+		return "", fmt.Errorf("%w: %s alias points to %d indices %v",
+			ErrInvalidIndex, c.companiesIndex, len(indices), indices)
+	}
+
+	return indices[0], nil
+}
+
+func (c *Client) legacyCompanyIndex(ctx context.Context) (string, error) {
+	res, err := c.client.Indices.Exists([]string{c.companiesIndex},
+		c.client.Indices.Exists.WithContext(ctx),
+	)
+	if err != nil {
+		return "", requestFailed(ErrFailedRequest, err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return c.companiesIndex, nil
+	}
+
+	return "", nil
+}
+
+// nextIndexVersion returns the version following the highest existing companies index version.
+func (c *Client) nextIndexVersion(ctx context.Context) (int, error) {
+	indices, err := c.ListCompanyIndices(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	highest := 0
+	for _, index := range indices {
+		version, ok := c.indexVersion(index.Name)
+		if ok && version > highest {
+			highest = version
+		}
+	}
+
+	return highest + 1, nil
+}
+
+func (c *Client) versionedIndexName(version int) string {
+	return fmt.Sprintf("%s_v%d", c.companiesIndex, version)
+}
+
+// indexVersion returns the version of a versioned companies index name.
+func (c *Client) indexVersion(indexName string) (int, bool) {
+	suffix := strings.TrimPrefix(indexName, c.companiesIndex+"_v")
+	if suffix == indexName {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(suffix)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// isCompanyIndex returns true for versioned companies indices and the legacy unversioned index.
+func (c *Client) isCompanyIndex(indexName string) bool {
+	_, ok := c.indexVersion(indexName)
+	return ok || indexName == c.companiesIndex
+}
+
+// createIndex creates an index using the current companies mapping,
+// optionally pointing the companies alias to it.
+func (c *Client) createIndex(ctx context.Context, indexName string, withAlias bool) error {
 	indexAPI := c.client.Indices
 	createOp := indexAPI.Create
 
-	res, err := indexAPI.Create(c.companiesIndex,
-		createOp.WithBody(companyIndexMapping()),
+	res, err := indexAPI.Create(indexName,
+		createOp.WithBody(c.companyIndexBody(withAlias)),
 		createOp.WithContext(ctx),
 	)
 
-	// Check network errors
+	return handleResponse(res, err, nil)
+}
+
+// reindex copies every document from source to dest, waiting for the copy to complete.
+func (c *Client) reindex(ctx context.Context, source string, dest string) error {
+	body, _ := json.Marshal(h{
+		"source": h{"index": source},
+		"dest":   h{"index": dest},
+	})
+
+	res, err := c.client.Reindex(bytes.NewReader(body),
+		c.client.Reindex.WithWaitForCompletion(true),
+		c.client.Reindex.WithRefresh(true),
+		c.client.Reindex.WithContext(ctx),
+	)
+
+	var result struct {
+		Failures []json.RawMessage `json:"failures"`
+	}
+	err = handleResponse(res, err, &result)
 	if err != nil {
-		return fmt.Errorf("%w: %s", ErrFailedRequest, err)
+		return err
 	}
-	res.Body.Close()
 
-	// Check errors returned by ES
-	if res.IsError() {
-		return errorFromResponse(res)
+	if len(result.Failures) > 0 {
+		return fmt.Errorf("%w: %d documents failed to reindex: %s",
+			ErrFailedRequest, len(result.Failures), result.Failures[0])
 	}
 
 	return nil
 }
 
-func companyIndexMapping() io.Reader {
-	mapping := h{
-		"mappings": h{
-			"properties": h{
-				"domain":              h{"type": "keyword"},
-				"phone_numbers":       h{"type": "keyword"},
-				"commercial_name":     h{"type": "text"},
-				"legal_name":          h{"type": "text"},
-				"all_available_names": h{"type": "text"},
-			},
-		},
+func (c *Client) countDocuments(ctx context.Context, indexName string) (int, error) {
+	res, err := c.client.Count(
+		c.client.Count.WithIndex(indexName),
+		c.client.Count.WithContext(ctx),
+	)
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	err = handleResponse(res, err, &result)
+	return result.Count, err
+}
+
+func (c *Client) companyIndexBody(withAlias bool) io.Reader {
+	body := h{
+		"settings": companyIndexSettings(),
+		"mappings": companyIndexMapping(),
+	}
+
+	if withAlias {
+		body["aliases"] = h{c.companiesIndex: h{}}
 	}
 
-	encoded, _ := json.Marshal(mapping)
+	encoded, _ := json.Marshal(body)
 	return bytes.NewReader(encoded)
 }
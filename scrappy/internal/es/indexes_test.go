@@ -0,0 +1,109 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIndexVersion(t *testing.T) {
+	client := Client{companiesIndex: "companies"}
+
+	testCases := []struct {
+		name           string
+		indexName      string
+		expected       int
+		expectedOk     bool
+		isCompanyIndex bool
+	}{
+		{name: "versioned index", indexName: "companies_v3", expected: 3, expectedOk: true, isCompanyIndex: true},
+		{name: "legacy index", indexName: "companies", isCompanyIndex: true},
+		{name: "invalid version", indexName: "companies_vX"},
+		{name: "zero version", indexName: "companies_v0"},
+		{name: "other index", indexName: "scrapes_v1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, ok := client.indexVersion(tc.indexName)
+
+			if version != tc.expected || ok != tc.expectedOk {
+				t.Errorf("Expected (%d, %t), got (%d, %t) instead",
+					tc.expected, tc.expectedOk, version, ok)
+			}
+
+			if client.isCompanyIndex(tc.indexName) != tc.isCompanyIndex {
+				t.Errorf("Expected isCompanyIndex %t for %q", tc.isCompanyIndex, tc.indexName)
+			}
+		})
+	}
+
+	if name := client.versionedIndexName(4); name != "companies_v4" {
+		t.Errorf("Expected %q, got %q instead", "companies_v4", name)
+	}
+}
+
+func TestSetCompanyAlias(t *testing.T) {
+	testCases := []struct {
+		name          string
+		aliasStatus   int
+		aliasBody     string
+		expectedSwap  bool
+		expectedError error
+	}{
+		{
+			name:         "versioned index",
+			aliasStatus:  http.StatusOK,
+			aliasBody:    `{"companies_v1": {"aliases": {"companies": {}}}}`,
+			expectedSwap: true,
+		},
+		{
+			name:          "legacy index",
+			aliasStatus:   http.StatusNotFound,
+			aliasBody:     `{"error": "alias [companies] missing", "status": 404}`,
+			expectedError: ErrInvalidIndex,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			swapped := false
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Elastic-Product", "Elasticsearch")
+				w.Header().Set("Content-Type", "application/json")
+
+				switch {
+				case r.URL.Path == "/_alias/companies":
+					w.WriteHeader(tc.aliasStatus)
+					w.Write([]byte(tc.aliasBody))
+				case r.Method == http.MethodHead && r.URL.Path == "/companies":
+					w.WriteHeader(http.StatusOK)
+				case r.URL.Path == "/_aliases":
+					swapped = true
+					w.Write([]byte(`{"acknowledged": true}`))
+				default:
+					t.Errorf("Unexpected request %s %q", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+			defer server.Close()
+
+			client, err := NewClient(&Config{Addresses: []string{server.URL}})
+			if err != nil {
+				t.Fatalf("Failed to create client: %s", err)
+			}
+
+			err = client.SetCompanyAlias(context.Background(), "companies_v2")
+			if !errors.Is(err, tc.expectedError) || (tc.expectedError == nil && err != nil) {
+				t.Errorf("Expected error %v, got %v", tc.expectedError, err)
+			}
+
+			if swapped != tc.expectedSwap {
+				t.Errorf("Expected alias swap %t, got %t", tc.expectedSwap, swapped)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package es
+
+import (
+	"fmt"
+
+	"examples/scrappy/internal/phone"
+)
+
+// Company names are analyzed using a custom analysis chain, so that
+// "Acme Inc." matches "ACME, Incorporated" and "Café" matches "cafe":
+//   - "&" is replaced with "and" before tokenizing
+//   - tokens are lowercased and folded to ASCII
+//   - legal suffixes (inc, llc, gmbh...) are dropped
+//   - common abbreviations are expanded using synonyms
+//
+// Each name field also has an edge n-gram subfield for prefix search,
+// and a normalized keyword subfield for exact matches.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/analysis-custom-analyzer.html
+
+// Phone numbers are stored as scraped, in the international format ("+1 617-491-1000"),
+// with keyword subfields holding their E.164 form ("+16174911000"),
+// national digits ("6174911000") and last 7 digits ("4911000"),
+// so numbers can be searched in any format, or by their last digits.
+// Extensions are dropped from every subfield.
+
+// Analyzers and normalizers of the companies index
+const (
+	companyNameAnalyzer     = "company_name"
+	autocompleteAnalyzer    = "company_name_autocomplete"
+	companyNameNormalizer   = "company_name_normalizer"
+	autocompleteSubfield    = "autocomplete"
+	keywordSubfield         = "keyword"
+	maxAutocompletePrefixes = 20
+
+	phoneE164Normalizer       = "phone_e164"
+	phoneNationalNormalizer   = "phone_national"
+	phoneLastDigitsNormalizer = "phone_last_digits"
+	phoneE164Subfield         = "e164"
+	phoneNationalSubfield     = "national"
+	phoneLastDigitsSubfield   = "last7"
+)
+
+// Legal entity suffixes ignored when matching company names
+var legalSuffixes = []string{
+	"inc", "incorporated", "corp", "corporation", "co", "company",
+	"llc", "llp", "lp", "pllc", "ltd", "limited", "plc",
+	"gmbh", "ag", "kg", "srl", "sarl", "sa", "sas", "spa",
+	"bv", "nv", "oy", "ab", "pty",
+}
+
+// Abbreviations commonly found in company names
+var companyNameSynonyms = []string{
+	"intl, international",
+	"assoc, assn, association, associates",
+	"bros, brothers",
+	"mfg, manufacturing",
+	"svc, svcs, service, services",
+	"tech, technology, technologies",
+	"mgmt, management",
+	"grp, group",
+}
+
+func companyIndexSettings() h {
+	return h{
+		"analysis": h{
+			"char_filter": h{
+				"ampersand": h{
+					"type":     "mapping",
+					"mappings": []string{"& => and", "+ => and"},
+				},
+				"phone_extension": h{
+					"type":        "pattern_replace",
+					"pattern":     `(?i)\s*(ext\.?|extension|x|#)\s*\d+\s*$`,
+					"replacement": "",
+				},
+				// The international format separates the country code with a space
+				"phone_country_code": h{
+					"type":        "pattern_replace",
+					"pattern":     `^\+\d+\s+`,
+					"replacement": "",
+				},
+				"phone_non_e164": h{
+					"type":        "pattern_replace",
+					"pattern":     `[^0-9+]`,
+					"replacement": "",
+				},
+				"phone_non_digits": h{
+					"type":        "pattern_replace",
+					"pattern":     `\D`,
+					"replacement": "",
+				},
+				"phone_last_digits": h{
+					"type":        "pattern_replace",
+					"pattern":     fmt.Sprintf(`^\d*(\d{%d})$`, phone.LastDigitsLength),
+					"replacement": "$1",
+				},
+			},
+			"filter": h{
+				"legal_suffix_stop": h{
+					"type":      "stop",
+					"stopwords": legalSuffixes,
+				},
+				"company_name_synonyms": h{
+					"type":     "synonym",
+					"synonyms": companyNameSynonyms,
+				},
+				"autocomplete_prefixes": h{
+					"type":     "edge_ngram",
+					"min_gram": 1,
+					"max_gram": maxAutocompletePrefixes,
+				},
+			},
+			"analyzer": h{
+				companyNameAnalyzer: h{
+					"type":        "custom",
+					"char_filter": []string{"ampersand"},
+					"tokenizer":   "standard",
+					"filter": []string{
+						"lowercase",
+						"asciifolding",
+						"legal_suffix_stop",
+						"company_name_synonyms",
+					},
+				},
+				autocompleteAnalyzer: h{
+					"type":        "custom",
+					"char_filter": []string{"ampersand"},
+					"tokenizer":   "standard",
+					"filter": []string{
+						"lowercase",
+						"asciifolding",
+						"legal_suffix_stop",
+						"autocomplete_prefixes",
+					},
+				},
+			},
+			"normalizer": h{
+				companyNameNormalizer: h{
+					"type":   "custom",
+					"filter": []string{"lowercase", "asciifolding", "trim"},
+				},
+				phoneE164Normalizer: h{
+					"type":        "custom",
+					"char_filter": []string{"phone_extension", "phone_non_e164"},
+				},
+				phoneNationalNormalizer: h{
+					"type":        "custom",
+					"char_filter": []string{"phone_extension", "phone_country_code", "phone_non_digits"},
+				},
+				phoneLastDigitsNormalizer: h{
+					"type":        "custom",
+					"char_filter": []string{"phone_extension", "phone_non_digits", "phone_last_digits"},
+				},
+			},
+		},
+	}
+}
+
+// companyIndexMapping returns the current mapping of the companies index,
+// changes must be recorded as a migration step, see mappingMigrations.
+func companyIndexMapping() h {
+	return h{
+		"_meta": h{mappingVersionKey: CurrentMappingVersion},
+		"properties": h{
+			"domain":              h{"type": "keyword"},
+			"phone_numbers":       phoneNumberMapping(),
+			"phone_history":       phoneHistoryMapping(),
+			"commercial_name":     companyNameMapping(),
+			"legal_name":          companyNameMapping(),
+			"all_available_names": companyNameMapping(),
+			// Facebook page, normalized to facebook.com/<page>
+			"facebook": h{"type": "keyword"},
+			// Set using UpdateCompanyInfo
+			"emails":    h{"type": "keyword"},
+			"addresses": h{"type": "keyword"},
+			// Extra CSV columns, with arbitrary keys
+			"attributes": h{"type": "flattened"},
+		},
+	}
+}
+
+func phoneNumberMapping() h {
+	return h{
+		"type": "keyword",
+		"fields": h{
+			phoneE164Subfield:       h{"type": "keyword", "normalizer": phoneE164Normalizer},
+			phoneNationalSubfield:   h{"type": "keyword", "normalizer": phoneNationalNormalizer},
+			phoneLastDigitsSubfield: h{"type": "keyword", "normalizer": phoneLastDigitsNormalizer},
+		},
+	}
+}
+
+// phoneHistoryMapping maps the history of each phone number found by the scraper,
+// see MergePhoneNumbers.
+func phoneHistoryMapping() h {
+	return h{
+		"type": "nested",
+		"properties": h{
+			"number":     h{"type": "keyword"},
+			"first_seen": h{"type": "date"},
+			"last_seen":  h{"type": "date"},
+			"times_seen": h{"type": "integer"},
+			"sources":    h{"type": "keyword"},
+			"confidence": h{"type": "integer"},
+			"stale":      h{"type": "boolean"},
+		},
+	}
+}
+
+func companyNameMapping() h {
+	return h{
+		"type":     "text",
+		"analyzer": companyNameAnalyzer,
+		"fields": h{
+			autocompleteSubfield: h{
+				"type":            "text",
+				"analyzer":        autocompleteAnalyzer,
+				"search_analyzer": companyNameAnalyzer,
+			},
+			keywordSubfield: h{
+				"type":       "keyword",
+				"normalizer": companyNameNormalizer,
+			},
+		},
+	}
+}
@@ -0,0 +1,61 @@
+package es
+
+import "testing"
+
+// Built in token filters used by the custom analyzers
+var builtinFilters = map[string]bool{
+	"lowercase":    true,
+	"asciifolding": true,
+	"trim":         true,
+}
+
+func TestCompanyIndexSettings(t *testing.T) {
+	analysis := companyIndexSettings()["analysis"].(h)
+	filters := analysis["filter"].(h)
+	analyzers := analysis["analyzer"].(h)
+	normalizers := analysis["normalizer"].(h)
+
+	// Every filter used by an analyzer must be built in, or defined in the settings
+	for name, analyzer := range analyzers {
+		for _, filter := range analyzer.(h)["filter"].([]string) {
+			if _, found := filters[filter]; !found && !builtinFilters[filter] {
+				t.Errorf("Analyzer %q uses undefined filter %q", name, filter)
+			}
+		}
+	}
+
+	// Every analyzer and normalizer used by the name fields must be defined
+	properties := companyIndexMapping()["properties"].(h)
+	for _, field := range []string{"commercial_name", "legal_name", "all_available_names"} {
+		mapping := properties[field].(h)
+		checkDefined(t, analyzers, mapping["analyzer"], field)
+
+		subfields := mapping["fields"].(h)
+		autocomplete := subfields[autocompleteSubfield].(h)
+		checkDefined(t, analyzers, autocomplete["analyzer"], field)
+		checkDefined(t, analyzers, autocomplete["search_analyzer"], field)
+
+		keyword := subfields[keywordSubfield].(h)
+		checkDefined(t, normalizers, keyword["normalizer"], field)
+	}
+
+	// Every char filter used by the phone normalizers must be defined
+	charFilters := analysis["char_filter"].(h)
+	phoneSubfields := properties["phone_numbers"].(h)["fields"].(h)
+	for name, subfield := range phoneSubfields {
+		normalizer := subfield.(h)["normalizer"]
+		checkDefined(t, normalizers, normalizer, "phone_numbers."+name)
+
+		for _, charFilter := range normalizers[normalizer.(string)].(h)["char_filter"].([]string) {
+			checkDefined(t, charFilters, charFilter, "phone_numbers."+name)
+		}
+	}
+}
+
+func checkDefined(t *testing.T, defined h, name interface{}, field string) {
+	t.Helper()
+
+	if _, found := defined[name.(string)]; !found {
+		t.Errorf("Field %q uses undefined analyzer or normalizer %q", field, name)
+	}
+}
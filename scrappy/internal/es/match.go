@@ -0,0 +1,216 @@
+package es
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Number of candidates returned by MatchCompany, unless a limit is provided
+const DefaultMatchLimit = 5
+
+// Names of the match query clauses, reported in SearchMatch.MatchedQueries
+const (
+	matchNameFuzzy = "name_fuzzy"
+	matchDomain    = "domain"
+	matchFacebook  = "facebook"
+)
+
+// MatchWeights sets how much each signal contributes to the score of a candidate.
+//
+// A weight of 0 ignores the signal, even if it is provided.
+type MatchWeights struct {
+	Name     float64 `json:"name"`
+	Phone    float64 `json:"phone"`
+	Website  float64 `json:"website"`
+	Facebook float64 `json:"facebook"`
+}
+
+// DefaultMatchWeights trusts exact identifiers (website, Facebook page, phone number)
+// more than company names, which are often shared or misspelled.
+func DefaultMatchWeights() MatchWeights {
+	return MatchWeights{
+		Name:     1,
+		Phone:    3,
+		Website:  5,
+		Facebook: 4,
+	}
+}
+
+// MatchQuery is a partial company record, any of its signals may be empty.
+type MatchQuery struct {
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+	Website  string `json:"website"`
+	Facebook string `json:"facebook"`
+	// Signal weights, DefaultMatchWeights if nil
+	Weights *MatchWeights `json:"weights,omitempty"`
+	// Maximum number of candidates returned (DefaultMatchLimit if 0)
+	Limit int `json:"limit,omitempty"`
+}
+
+// MatchCompanyResult holds the candidates matching a partial company record.
+type MatchCompanyResult struct {
+	// Candidates ranked by score, highest first
+	Candidates []Company `json:"candidates"`
+}
+
+// Best returns the highest scoring candidate, or nil if nothing matched.
+func (r *MatchCompanyResult) Best() *Company {
+	if len(r.Candidates) == 0 {
+		return nil
+	}
+
+	return &r.Candidates[0]
+}
+
+// MatchCompany finds the companies best matching a partial company record.
+//
+// Every provided signal is an optional clause of a bool query:
+// names are matched fuzzily, while the website, phone number and Facebook page
+// must match exactly, and are boosted by their weights.
+// The matched clauses of each candidate are reported in its MatchedQueries.
+func (c *Client) MatchCompany(ctx context.Context, match *MatchQuery) (*MatchCompanyResult, error) {
+	esQuery, err := matchCompanyQuery(match)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := match.Limit
+	if limit == 0 {
+		limit = DefaultMatchLimit
+	}
+
+	result, err := c.searchQuery(ctx, esQuery, &SearchOptions{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode "no candidates" as an empty list rather than null
+	candidates := result.Companies
+	if candidates == nil {
+		candidates = []Company{}
+	}
+
+	return &MatchCompanyResult{Candidates: candidates}, nil
+}
+
+// matchCompanyQuery builds a bool query with a should clause for each provided signal.
+func matchCompanyQuery(match *MatchQuery) (h, error) {
+	weights := DefaultMatchWeights()
+	if match.Weights != nil {
+		weights = *match.Weights
+	}
+
+	if weights.Name < 0 || weights.Phone < 0 || weights.Website < 0 || weights.Facebook < 0 {
+		return nil, fmt.Errorf("%w: match weights can't be negative", ErrInvalidParams)
+	}
+
+	should := a{}
+
+	name := strings.TrimSpace(match.Name)
+	if name != "" && weights.Name > 0 {
+		should = append(should,
+			h{"multi_match": h{
+				"query":  name,
+				"type":   "phrase",
+				"fields": companyNameFields,
+				"boost":  2 * weights.Name,
+				"_name":  matchNamePhrase,
+			}},
+			h{"multi_match": h{
+				"query":         name,
+				"type":          "best_fields",
+				"fields":        companyNameFields,
+				"fuzziness":     "AUTO",
+				"prefix_length": 1,
+				"boost":         weights.Name,
+				"_name":         matchNameFuzzy,
+			}},
+		)
+	}
+
+	if match.Phone != "" && weights.Phone > 0 {
+		query, err := phoneNumberQuery(match.Phone, weights.Phone)
+		if err != nil {
+			return nil, err
+		}
+
+		should = append(should, query)
+	}
+
+	if match.Website != "" && weights.Website > 0 {
+		id, err := urlToId(match.Website)
+		if err != nil {
+			return nil, InvalidParams(fmt.Errorf("website %w", err))
+		}
+
+		// Companies are indexed by their domain
+		should = append(should, h{"ids": h{
+			"values": []string{id},
+			"boost":  weights.Website,
+			"_name":  matchDomain,
+		}})
+	}
+
+	if match.Facebook != "" && weights.Facebook > 0 {
+		page, err := NormalizeFacebookURL(match.Facebook)
+		if err != nil {
+			return nil, err
+		}
+
+		// The facebook column of imported companies is normalized into the facebook field
+		should = append(should, h{"term": h{
+			"facebook": h{
+				"value": page,
+				"boost": weights.Facebook,
+				"_name": matchFacebook,
+			},
+		}})
+	}
+
+	if len(should) == 0 {
+		return nil, fmt.Errorf("%w: provide at least one of name, phone, website or facebook", ErrInvalidParams)
+	}
+
+	esQuery := h{
+		"query": h{
+			"bool": h{
+				"should":               should,
+				"minimum_should_match": 1,
+			},
+		},
+		"highlight": highlightFields(append(
+			[]string{"commercial_name", "legal_name", "all_available_names"},
+			phoneNumberFields...)...),
+	}
+
+	return esQuery, nil
+}
+
+// NormalizeFacebookURL reduces a Facebook page URL to "facebook.com/<page>",
+// the form Facebook pages are stored in.
+//
+// "https://m.facebook.com/AcmeInc/" becomes "facebook.com/acmeinc"
+func NormalizeFacebookURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid facebook url %q", ErrInvalidParams, rawURL)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	page := strings.Trim(strings.ToLower(parsed.Path), "/")
+
+	if (host != "facebook.com" && host != "fb.com") || page == "" {
+		return "", fmt.Errorf("%w: not a facebook page url %q", ErrInvalidParams, rawURL)
+	}
+
+	return "facebook.com/" + page, nil
+}
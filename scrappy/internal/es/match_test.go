@@ -0,0 +1,201 @@
+package es
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"examples/scrappy/internal/csv"
+)
+
+func TestMatchCompanyQuery(t *testing.T) {
+	testCases := []struct {
+		name        string
+		match       MatchQuery
+		expected    []string
+		expectedErr error
+	}{
+		{
+			name:     "name only",
+			match:    MatchQuery{Name: "Acme Glass"},
+			expected: []string{matchNamePhrase, matchNameFuzzy},
+		},
+		{
+			name: "every signal",
+			match: MatchQuery{
+				Name:     "Acme Glass",
+				Phone:    "(617) 491-1000",
+				Website:  "https://www.acme.com/contact",
+				Facebook: "facebook.com/acme",
+			},
+			expected: []string{matchNamePhrase, matchNameFuzzy, matchPhone, matchDomain, matchFacebook},
+		},
+		{
+			name:     "zero weight ignores signal",
+			match:    MatchQuery{Name: "Acme", Website: "acme.com", Weights: &MatchWeights{Website: 1}},
+			expected: []string{matchDomain},
+		},
+		{name: "no signals", match: MatchQuery{Name: "  "}, expectedErr: ErrInvalidParams},
+		{name: "invalid phone", match: MatchQuery{Phone: "12"}, expectedErr: ErrInvalidParams},
+		{name: "invalid facebook", match: MatchQuery{Facebook: "twitter.com/acme"}, expectedErr: ErrInvalidParams},
+		{
+			name:        "negative weight",
+			match:       MatchQuery{Name: "Acme", Weights: &MatchWeights{Name: -1}},
+			expectedErr: ErrInvalidParams,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			esQuery, err := matchCompanyQuery(&tc.match)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v instead", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			should := esQuery["query"].(h)["bool"].(h)["should"].(a)
+			if len(should) != len(tc.expected) {
+				t.Fatalf("Expected %d clauses, got %d instead", len(tc.expected), len(should))
+			}
+
+			for index, clause := range should {
+				if name := clauseName(clause); name != tc.expected[index] {
+					t.Errorf("Expected clause %q, got %q instead", tc.expected[index], name)
+				}
+			}
+		})
+	}
+}
+
+// clauseName returns the first _name found in a query clause, searching nested clauses depth first.
+func clauseName(clause h) string {
+	if name, found := clause["_name"]; found {
+		return name.(string)
+	}
+
+	for _, value := range clause {
+		var nested a
+		switch value := value.(type) {
+		case h:
+			nested = a{value}
+		case a:
+			nested = value
+		}
+
+		for _, query := range nested {
+			if name := clauseName(query); name != "" {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+func TestNormalizeFacebookURL(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "https://www.facebook.com/AcmeInc/", expected: "facebook.com/acmeinc"},
+		{input: "m.facebook.com/acmeinc", expected: "facebook.com/acmeinc"},
+		{input: "http://fb.com/acmeinc?ref=page", expected: "facebook.com/acmeinc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			page, err := NormalizeFacebookURL(tc.input)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			if page != tc.expected {
+				t.Errorf("Expected %q, got %q instead", tc.expected, page)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"https://facebook.com/", "https://example.com/acme"} {
+		_, err := NormalizeFacebookURL(invalid)
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Expected ErrInvalidParams for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestBatchMatchResultOutcome(t *testing.T) {
+	match := func(score float64) *MatchCompanyResult {
+		company := Company{ID: "acme.com", SearchMatch: &SearchMatch{Score: score}}
+		company.CommercialName = "Acme"
+		return &MatchCompanyResult{Candidates: []Company{company}}
+	}
+
+	testCases := []struct {
+		name     string
+		result   BatchMatchResult
+		expected csv.MatchOutcome
+	}{
+		{
+			name:     "match",
+			result:   BatchMatchResult{MatchCompanyResult: match(4)},
+			expected: csv.MatchOutcome{Domain: "acme.com", Name: "Acme", Score: 4, Status: csv.MatchStatusMatch},
+		},
+		{
+			name:     "below min score",
+			result:   BatchMatchResult{MatchCompanyResult: match(1)},
+			expected: csv.MatchOutcome{Domain: "acme.com", Name: "Acme", Score: 1, Status: csv.MatchStatusNoMatch},
+		},
+		{
+			name:     "no candidates",
+			result:   BatchMatchResult{MatchCompanyResult: &MatchCompanyResult{}},
+			expected: csv.MatchOutcome{Status: csv.MatchStatusNoMatch},
+		},
+		{
+			name:     "error",
+			result:   BatchMatchResult{Err: ErrInvalidParams},
+			expected: csv.MatchOutcome{Status: csv.MatchStatusError, Error: ErrInvalidParams.Error()},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outcome := tc.result.Outcome(2)
+			if outcome != tc.expected {
+				t.Errorf("Expected %+v, got %+v instead", tc.expected, outcome)
+			}
+		})
+	}
+}
+
+func TestAppendMatchSearch(t *testing.T) {
+	var body bytes.Buffer
+
+	for _, name := range []string{"Acme", "Beta"} {
+		esQuery, err := matchCompanyQuery(&MatchQuery{Name: name})
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+
+		err = appendMatchSearch(&body, esQuery, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	// Multi search bodies alternate header and query lines, each ending with a newline
+	lines := strings.Split(body.String(), "\n")
+	if len(lines) != 5 || lines[4] != "" {
+		t.Fatalf("Expected 4 newline terminated lines, got %q", body.String())
+	}
+
+	if lines[0] != "{}" || lines[2] != "{}" {
+		t.Errorf("Expected empty header lines, got %q and %q", lines[0], lines[2])
+	}
+
+	if !strings.Contains(lines[3], `"size":1`) || !strings.Contains(lines[3], "Beta") {
+		t.Errorf("Expected a single result query for Beta, got %s", lines[3])
+	}
+}
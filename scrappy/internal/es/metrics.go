@@ -0,0 +1,63 @@
+package es
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Observer is notified of the requests sent to the cluster, e.g. to export metrics.
+//
+// It's called from several goroutines.
+type Observer interface {
+	// ObserveESRequest is called once per attempt of a request,
+	// with a status of 0 if no response was received.
+	ObserveESRequest(operation string, status int, duration time.Duration)
+	// ObserveBulkFailure is called for each bulk item ES didn't write.
+	ObserveBulkFailure(action string)
+}
+
+// observedTransport times the requests sent through the wrapped transport.
+type observedTransport struct {
+	next     http.RoundTripper
+	observer Observer
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+
+	status := 0
+	if err == nil {
+		status = res.StatusCode
+	}
+	t.observer.ObserveESRequest(requestOperation(req.Method, req.URL.Path), status, time.Since(start))
+
+	return res, err
+}
+
+// requestOperation names the ES API called by a request, from the first "_" path segment
+// (search, msearch, bulk, doc, update...), keeping the metrics labels bounded.
+//
+// Requests to an index without an API segment are index operations, requests to the root are info requests.
+func requestOperation(method string, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, "_") && len(segment) > 1 {
+			return segment[1:]
+		}
+	}
+
+	if segments[0] == "" {
+		return "info"
+	}
+
+	return "index_" + strings.ToLower(method)
+}
+
+// observeBulkFailure reports a failed bulk item to the observer, if any.
+func (c *Client) observeBulkFailure(action string) {
+	if c.observer != nil {
+		c.observer.ObserveBulkFailure(action)
+	}
+}
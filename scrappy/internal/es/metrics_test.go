@@ -0,0 +1,78 @@
+package es
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestOperation(t *testing.T) {
+	testCases := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{method: "GET", path: "/", expected: "info"},
+		{method: "POST", path: "/companies/_search", expected: "search"},
+		{method: "POST", path: "/_msearch", expected: "msearch"},
+		{method: "POST", path: "/_bulk", expected: "bulk"},
+		{method: "GET", path: "/companies/_doc/mazautoglass.com", expected: "doc"},
+		{method: "POST", path: "/companies/_update/mazautoglass.com", expected: "update"},
+		{method: "GET", path: "/_alias/companies", expected: "alias"},
+		{method: "GET", path: "/_cat/indices/companies*", expected: "cat"},
+		{method: "HEAD", path: "/companies", expected: "index_head"},
+		{method: "PUT", path: "/companies_v2", expected: "index_put"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			operation := requestOperation(tc.method, tc.path)
+			if operation != tc.expected {
+				t.Errorf("Expected operation %q, got %q", tc.expected, operation)
+			}
+		})
+	}
+}
+
+type testObserver struct {
+	mu         sync.Mutex
+	operations []string
+	statuses   []int
+}
+
+func (o *testObserver) ObserveESRequest(operation string, status int, _ time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.operations = append(o.operations, operation)
+	o.statuses = append(o.statuses, status)
+}
+
+func (o *testObserver) ObserveBulkFailure(string) {}
+
+func TestObservedRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"_index": "companies", "_id": "mazautoglass.com", "found": false}`))
+	}))
+	defer server.Close()
+
+	observer := &testObserver{}
+	client, err := NewClient(&Config{Addresses: []string{server.URL}, Observer: observer})
+	if err != nil {
+		t.Fatalf("Failed to create client: %s", err)
+	}
+
+	_, err = client.GetCompany(context.Background(), "https://mazautoglass.com")
+	if err == nil {
+		t.Fatalf("Expected a not found error")
+	}
+
+	if len(observer.operations) != 1 || observer.operations[0] != "doc" || observer.statuses[0] != http.StatusNotFound {
+		t.Errorf("Expected one doc request with status 404, got %v %v", observer.operations, observer.statuses)
+	}
+}
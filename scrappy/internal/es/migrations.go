@@ -0,0 +1,257 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Mapping changes are recorded as migration steps, and the mapping version of each index
+// is stored in its "_meta" field. Additive changes (new fields) are applied in place
+// using the put mapping API, other changes (analyzers, field types) require a reindex.
+//
+// Indices created before mapping versions were recorded are at version 0.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/mapping-meta-field.html
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/explicit-mapping.html#add-field-mapping
+
+// Key of the mapping version in the index mapping "_meta" field
+const mappingVersionKey = "mapping_version"
+
+// MappingMigration is a change of the companies index mapping.
+type MappingMigration struct {
+	Version     int
+	Description string
+	// Fields added by the migration, as dotted paths into the current mapping properties
+	Fields []string
+	// Changes that can't be applied to an existing index require a reindex
+	Reindex bool
+}
+
+// Migration steps, in order, the current mapping is the result of applying all of them.
+//
+// New fields are added to companyIndexMapping, and listed in a new step.
+var mappingMigrations = []MappingMigration{
+	{
+		Version:     1,
+		Description: "Company name analyzers, with folding, legal suffix stopwords and autocomplete",
+		Reindex:     true,
+	},
+	{
+		Version:     2,
+		Description: "Facebook pages of companies",
+		Fields:      []string{"facebook"},
+	},
+	{
+		Version:     3,
+		Description: "Phone number E.164, national and last digits subfields",
+		// Adds normalizers to the index analysis settings
+		Reindex: true,
+	},
+	{
+		Version:     4,
+		Description: "Phone number history",
+		Fields:      []string{"phone_history"},
+	},
+	{
+		Version:     5,
+		Description: "Confidence of scraped phone numbers",
+		Fields:      []string{"phone_history.confidence"},
+	},
+	{
+		Version:     6,
+		Description: "Company emails and addresses",
+		Fields:      []string{"emails", "addresses"},
+	},
+}
+
+// CurrentMappingVersion is the version of the mapping used to create new indices.
+var CurrentMappingVersion = mappingMigrations[len(mappingMigrations)-1].Version
+
+// MigrationPlan lists the migration steps needed to bring an index to the current mapping.
+type MigrationPlan struct {
+	Index       string
+	FromVersion int
+	ToVersion   int
+	Steps       []MappingMigration
+	// True if any of the steps requires a reindex
+	Reindex bool
+}
+
+// MigrationResult describes an applied migration plan.
+type MigrationResult struct {
+	Plan *MigrationPlan
+	// Set if the migration reindexed into a new index version
+	Reindexed *ReindexResult
+}
+
+// PlanCompanyIndexMigration compares the mapping version of the current companies index
+// with the current mapping version, and lists the steps needed to migrate it.
+func (c *Client) PlanCompanyIndexMigration(ctx context.Context) (*MigrationPlan, error) {
+	current, err := c.CurrentCompanyIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := c.mappingVersion(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+
+	return planMigration(current, version)
+}
+
+// MigrateCompanyIndex applies a migration plan, updating the mapping of the current index in place
+// if all steps are additive, or reindexing into a new index version otherwise.
+//
+// The plan must have been made against the current companies index.
+func (c *Client) MigrateCompanyIndex(ctx context.Context, plan *MigrationPlan) (*MigrationResult, error) {
+	result := &MigrationResult{Plan: plan}
+	if len(plan.Steps) == 0 {
+		return result, nil
+	}
+
+	if plan.Reindex {
+		reindexed, err := c.ReindexCompanies(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Reindexed = reindexed
+		return result, nil
+	}
+
+	body, err := json.Marshal(migrationMapping(plan.Steps))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.Indices.PutMapping([]string{plan.Index}, bytes.NewReader(body),
+		c.client.Indices.PutMapping.WithContext(ctx),
+	)
+
+	err = handleResponse(res, err, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %s mapping, the index may need a reindex: %w", plan.Index, err)
+	}
+
+	return result, nil
+}
+
+// planMigration lists the steps following the index mapping version.
+func planMigration(indexName string, version int) (*MigrationPlan, error) {
+	if version > CurrentMappingVersion {
+		return nil, fmt.Errorf("%w: %s has mapping version %d, newer than the supported version %d",
+			ErrInvalidIndex, indexName, version, CurrentMappingVersion)
+	}
+
+	plan := &MigrationPlan{
+		Index:       indexName,
+		FromVersion: version,
+		ToVersion:   CurrentMappingVersion,
+		Steps:       []MappingMigration{},
+	}
+
+	for _, step := range mappingMigrations {
+		if step.Version > version {
+			plan.Steps = append(plan.Steps, step)
+			plan.Reindex = plan.Reindex || step.Reindex
+		}
+	}
+
+	return plan, nil
+}
+
+// migrationMapping returns the partial mapping adding the fields of the steps,
+// and recording the current mapping version.
+func migrationMapping(steps []MappingMigration) h {
+	mapping := companyIndexMapping()
+	properties := h{}
+
+	for _, step := range steps {
+		for _, field := range step.Fields {
+			copyMappingField(properties, mapping["properties"].(h), strings.Split(field, "."))
+		}
+	}
+
+	return h{
+		"_meta":      mapping["_meta"],
+		"properties": properties,
+	}
+}
+
+// copyMappingField copies the mapping of a field, found by path, from source to dest properties.
+// Parents of nested fields are copied without their other properties, keeping their type.
+func copyMappingField(dest h, source h, path []string) bool {
+	field, found := source[path[0]].(h)
+	if !found {
+		return false
+	}
+
+	if len(path) == 1 {
+		dest[path[0]] = field
+		return true
+	}
+
+	sourceProperties, found := field["properties"].(h)
+	if !found {
+		return false
+	}
+
+	parent, found := dest[path[0]].(h)
+	if !found {
+		parent = h{}
+		for key, value := range field {
+			if key != "properties" {
+				parent[key] = value
+			}
+		}
+		parent["properties"] = h{}
+	}
+
+	// The whole parent may already be copied by a previous step
+	destProperties, found := parent["properties"].(h)
+	if !found {
+		return false
+	}
+
+	if !copyMappingField(destProperties, sourceProperties, path[1:]) {
+		return false
+	}
+
+	dest[path[0]] = parent
+	return true
+}
+
+// mappingVersion returns the mapping version recorded in the index mapping, 0 if missing.
+func (c *Client) mappingVersion(ctx context.Context, indexName string) (int, error) {
+	res, err := c.client.Indices.GetMapping(
+		c.client.Indices.GetMapping.WithIndex(indexName),
+		c.client.Indices.GetMapping.WithContext(ctx),
+	)
+
+	// Response maps index names to their mappings
+	var result map[string]struct {
+		Mappings struct {
+			Meta map[string]any `json:"_meta"`
+		} `json:"mappings"`
+	}
+	err = handleResponse(res, err, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	version, found := result[indexName].Mappings.Meta[mappingVersionKey]
+	if !found {
+		return 0, nil
+	}
+
+	number, ok := version.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s has invalid mapping version %v", ErrInvalidIndex, indexName, version)
+	}
+
+	return int(number), nil
+}
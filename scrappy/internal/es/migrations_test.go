@@ -0,0 +1,92 @@
+package es
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMappingMigrations(t *testing.T) {
+	properties := companyIndexMapping()["properties"].(h)
+
+	for index, step := range mappingMigrations {
+		// Versions are consecutive, starting at 1
+		if step.Version != index+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d instead", index, index+1, step.Version)
+		}
+
+		// Every added field must be part of the current mapping
+		for _, field := range step.Fields {
+			if !copyMappingField(h{}, properties, strings.Split(field, ".")) {
+				t.Errorf("Migration %d adds field %q missing from the current mapping", step.Version, field)
+			}
+		}
+	}
+
+	meta := companyIndexMapping()["_meta"].(h)
+	if meta[mappingVersionKey] != CurrentMappingVersion {
+		t.Errorf("Expected mapping version %d, got %v instead", CurrentMappingVersion, meta[mappingVersionKey])
+	}
+}
+
+func TestPlanMigration(t *testing.T) {
+	testCases := []struct {
+		name            string
+		version         int
+		expectedSteps   int
+		expectedReindex bool
+	}{
+		{name: "unversioned index", version: 0, expectedSteps: CurrentMappingVersion, expectedReindex: true},
+		{name: "before incompatible change", version: 2, expectedSteps: CurrentMappingVersion - 2, expectedReindex: true},
+		{name: "additive changes only", version: 3, expectedSteps: CurrentMappingVersion - 3},
+		{name: "up to date", version: CurrentMappingVersion},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := planMigration("companies_v1", tc.version)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			if len(plan.Steps) != tc.expectedSteps || plan.Reindex != tc.expectedReindex {
+				t.Errorf("Expected %d steps with reindex %t, got %d steps with reindex %t instead",
+					tc.expectedSteps, tc.expectedReindex, len(plan.Steps), plan.Reindex)
+			}
+			if plan.FromVersion != tc.version || plan.ToVersion != CurrentMappingVersion {
+				t.Errorf("Expected plan from %d to %d, got %d to %d instead",
+					tc.version, CurrentMappingVersion, plan.FromVersion, plan.ToVersion)
+			}
+		})
+	}
+
+	_, err := planMigration("companies_v1", CurrentMappingVersion+1)
+	if !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("Expected %v for newer mapping versions, got %v instead", ErrInvalidIndex, err)
+	}
+}
+
+func TestMigrationMapping(t *testing.T) {
+	steps := []MappingMigration{
+		{Version: 1, Fields: []string{"facebook"}},
+		{Version: 2, Fields: []string{"phone_history.confidence"}},
+	}
+
+	expected := h{
+		"_meta": h{mappingVersionKey: CurrentMappingVersion},
+		"properties": h{
+			"facebook": h{"type": "keyword"},
+			// Parents of added fields keep their type, without their other properties
+			"phone_history": h{
+				"type":       "nested",
+				"properties": h{"confidence": h{"type": "integer"}},
+			},
+		},
+	}
+
+	mapping := migrationMapping(steps)
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Errorf("Expected mapping %v, got %v instead", expected, mapping)
+	}
+}
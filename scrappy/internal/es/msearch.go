@@ -0,0 +1,246 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"examples/scrappy/internal/csv"
+)
+
+// Number of match queries sent in each _msearch request
+const defaultBatchMatchSize = 100
+
+// Number of _msearch requests sent concurrently
+const defaultBatchMatchWorkers = 4
+
+// BatchMatchOptions controls how MatchCompanies splits the queries into _msearch requests.
+type BatchMatchOptions struct {
+	// Number of match queries sent in each _msearch request
+	BatchSize int
+	// Number of _msearch requests sent concurrently
+	NumWorkers int
+}
+
+// BatchMatchResult holds the candidates of one of the queries passed to MatchCompanies.
+type BatchMatchResult struct {
+	*MatchCompanyResult
+	// Set if the query is invalid, or could not be run
+	Err error
+}
+
+// NewMatchQuery returns the query matching a partial company record parsed from a CSV file.
+//
+// Only the best candidate is needed to match a record, so a single candidate is returned.
+func NewMatchQuery(record *csv.MatchRecord, weights *MatchWeights) MatchQuery {
+	return MatchQuery{
+		Name:     record.Name,
+		Phone:    record.Phone,
+		Website:  record.Website,
+		Facebook: record.Facebook,
+		Weights:  weights,
+		Limit:    1,
+	}
+}
+
+// Outcome returns the best candidate as a match, if its score is at least minScore.
+func (r *BatchMatchResult) Outcome(minScore float64) csv.MatchOutcome {
+	if r.Err != nil {
+		return csv.MatchOutcome{Status: csv.MatchStatusError, Error: r.Err.Error()}
+	}
+
+	best := r.Best()
+	if best == nil || best.SearchMatch == nil {
+		return csv.MatchOutcome{Status: csv.MatchStatusNoMatch}
+	}
+
+	outcome := csv.MatchOutcome{
+		Domain: best.ID,
+		Name:   best.CommercialName,
+		Score:  best.Score,
+		Status: csv.MatchStatusMatch,
+	}
+
+	if best.Score < minScore {
+		// Keep the best candidate, so low scoring matches can be reviewed
+		outcome.Status = csv.MatchStatusNoMatch
+	}
+
+	return outcome
+}
+
+// msearchEnvelope decodes the responses of a _msearch request, in query order.
+type msearchEnvelope struct {
+	Responses []struct {
+		searchEnvelope
+		Status int          `json:"status"`
+		Error  *esErrorInfo `json:"error"`
+	} `json:"responses"`
+}
+
+// batchMatchJob is a slice of the queries, starting at index.
+type batchMatchJob struct {
+	index   int
+	matches []MatchQuery
+}
+
+// MatchCompanies runs MatchCompany for each of the partial company records,
+// sending them in batches through the multi search API, using several workers.
+//
+// A result is returned for each query, in the same order.
+// Invalid queries and failed batches are reported in the Err of their results,
+// so one bad record doesn't fail the whole batch.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-multi-search.html
+func (c *Client) MatchCompanies(ctx context.Context, matches []MatchQuery, options *BatchMatchOptions) []BatchMatchResult {
+	batchSize := defaultBatchMatchSize
+	numWorkers := defaultBatchMatchWorkers
+	if options != nil && options.BatchSize > 0 {
+		batchSize = options.BatchSize
+	}
+	if options != nil && options.NumWorkers > 0 {
+		numWorkers = options.NumWorkers
+	}
+
+	var wg sync.WaitGroup
+
+	// Slice in which results are collected, each job writes to its own part of it
+	results := make([]BatchMatchResult, len(matches))
+
+	// Channel on which jobs are enqueued
+	jobCh := make(chan batchMatchJob, len(matches)/batchSize+1)
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range jobCh {
+				c.matchBatch(ctx, job.matches, results[job.index:job.index+len(job.matches)])
+			}
+		}()
+	}
+
+	// Enqueue jobs
+	for index := 0; index < len(matches); index += batchSize {
+		end := index + batchSize
+		if end > len(matches) {
+			end = len(matches)
+		}
+
+		jobCh <- batchMatchJob{index: index, matches: matches[index:end]}
+	}
+	close(jobCh)
+
+	wg.Wait()
+	return results
+}
+
+// matchBatch runs the match queries using a single _msearch request,
+// storing the result of each query in results.
+func (c *Client) matchBatch(ctx context.Context, matches []MatchQuery, results []BatchMatchResult) {
+	// Indexes of the valid queries, which are sent to ES
+	var sent []int
+	var body bytes.Buffer
+
+	for index := range matches {
+		esQuery, err := matchCompanyQuery(&matches[index])
+		if err == nil {
+			err = appendMatchSearch(&body, esQuery, matches[index].Limit)
+		}
+
+		if err != nil {
+			results[index].Err = err
+			continue
+		}
+
+		sent = append(sent, index)
+	}
+
+	if len(sent) == 0 {
+		return
+	}
+
+	responses, err := c.multiSearch(ctx, &body)
+	if err == nil && len(responses.Responses) != len(sent) {
+		err = fmt.Errorf("%w: expected %d responses, got %d",
+			ErrUnexpectedResponse, len(sent), len(responses.Responses))
+	}
+
+	if err != nil {
+		for _, index := range sent {
+			results[index].Err = err
+		}
+		return
+	}
+
+	for position, index := range sent {
+		response := &responses.Responses[position]
+
+		if response.Error != nil {
+			results[index].Err = fmt.Errorf("%w: [%d] %s: %s", ErrFailedRequest,
+				response.Status, response.Error.Type, response.Error.Reason)
+			continue
+		}
+
+		candidates, err := response.companies()
+		if err != nil {
+			results[index].Err = err
+			continue
+		}
+
+		if candidates == nil {
+			candidates = []Company{}
+		}
+		results[index].MatchCompanyResult = &MatchCompanyResult{Candidates: candidates}
+	}
+}
+
+// appendMatchSearch appends the header and body lines of a match query to a _msearch request body.
+func appendMatchSearch(body *bytes.Buffer, esQuery h, limit int) error {
+	if limit == 0 {
+		limit = DefaultMatchLimit
+	}
+
+	query, _, err := searchBody(esQuery, &SearchOptions{Limit: limit})
+	if err != nil {
+		return err
+	}
+
+	// The index is set on the _msearch request, the header line can be empty
+	body.WriteString("{}\n")
+	_, err = io.Copy(body, query)
+	body.WriteString("\n")
+	return err
+}
+
+func (c *Client) multiSearch(ctx context.Context, body io.Reader) (*msearchEnvelope, error) {
+	res, err := c.client.Msearch(body,
+		c.client.Msearch.WithIndex(c.companiesIndex),
+		c.client.Msearch.WithContext(ctx),
+	)
+	// Check network errors
+	if err != nil {
+		return nil, requestFailed(ErrSearchResult, err)
+	}
+	defer res.Body.Close()
+
+	// Check errors returned by ES
+	if res.IsError() {
+		return nil, errorFromResponse(res)
+	}
+
+	var envelope msearchEnvelope
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	err = decoder.Decode(&envelope)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+	}
+
+	return &envelope, nil
+}
@@ -0,0 +1,118 @@
+package es
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Number of companies returned by a search, unless a limit is provided
+const DefaultSearchLimit = 10
+
+// Maximum number of companies returned by a single search
+const MaxSearchLimit = 100
+
+// ES refuses from + size pagination past this many results (index.max_result_window),
+// search_after cursors have to be used to page further.
+const maxResultWindow = 10000
+
+// SearchOptions controls which page of search results is returned, and how much detail it includes.
+type SearchOptions struct {
+	// Maximum number of companies returned (DefaultSearchLimit if 0)
+	Limit int
+	// Number of companies to skip, can't be combined with Cursor
+	From int
+	// Opaque cursor, returned as SearchCompaniesResult.Next by the previous page
+	Cursor string
+	// Include the explanation of how each company's score was computed
+	Explain bool
+}
+
+// Sort order of search results.
+//
+// The domain keyword is unique for each company, breaking score ties,
+// so search_after cursors always resume from the same position.
+var searchSort = a{
+	h{"_score": "desc"},
+	h{"domain": "asc"},
+}
+
+// limit returns the page size, checking it is within bounds.
+func (o *SearchOptions) limit() (int, error) {
+	if o == nil || o.Limit == 0 {
+		return DefaultSearchLimit, nil
+	}
+
+	if o.Limit < 0 || o.Limit > MaxSearchLimit {
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidParams, MaxSearchLimit)
+	}
+
+	return o.Limit, nil
+}
+
+// paginate adds the size, from, search_after, sort and track_total_hits
+// parameters to the search request body.
+func (o *SearchOptions) paginate(esQuery h) error {
+	limit, err := o.limit()
+	if err != nil {
+		return err
+	}
+
+	esQuery["size"] = limit
+	esQuery["sort"] = searchSort
+	// Count every hit, instead of stopping at 10000
+	esQuery["track_total_hits"] = true
+
+	if o == nil {
+		return nil
+	}
+
+	switch {
+	case o.Cursor != "" && o.From != 0:
+		return fmt.Errorf("%w: from can't be used together with a cursor", ErrInvalidParams)
+	case o.Cursor != "":
+		searchAfter, err := decodeCursor(o.Cursor)
+		if err != nil {
+			return err
+		}
+		esQuery["search_after"] = searchAfter
+	case o.From < 0 || o.From+limit > maxResultWindow:
+		return fmt.Errorf("%w: from must be between 0 and %d, use a cursor to page further",
+			ErrInvalidParams, maxResultWindow-limit)
+	case o.From > 0:
+		esQuery["from"] = o.From
+	}
+
+	return nil
+}
+
+// encodeCursor encodes the sort values of the last hit of a page as an opaque cursor.
+func encodeCursor(sortValues []interface{}) (string, error) {
+	encoded, err := json.Marshal(sortValues)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// decodeCursor decodes the sort values from a cursor, to be used as search_after.
+func decodeCursor(cursor string) ([]interface{}, error) {
+	encoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidParams)
+	}
+
+	// Keep numbers as json.Number, so scores and long values are sent back unchanged
+	var sortValues []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	err = decoder.Decode(&sortValues)
+	if err != nil || len(sortValues) != len(searchSort) {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidParams)
+	}
+
+	return sortValues, nil
+}
@@ -0,0 +1,85 @@
+package es
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSearchCursor(t *testing.T) {
+	// Sort values as decoded from a search response
+	sortValues := []interface{}{json.Number("3.1415927"), "acme.com"}
+
+	cursor, err := encodeCursor(sortValues)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	decoded, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, sortValues) {
+		t.Errorf("Expected %v, got %v instead", sortValues, decoded)
+	}
+
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24", "WyJhY21lLmNvbSJd"} {
+		_, err := decodeCursor(invalid)
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Expected ErrInvalidParams for cursor %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestSearchOptionsPaginate(t *testing.T) {
+	cursor, _ := encodeCursor([]interface{}{json.Number("1.5"), "acme.com"})
+
+	testCases := []struct {
+		name        string
+		options     *SearchOptions
+		size        int
+		from        interface{}
+		searchAfter bool
+		expectedErr error
+	}{
+		{name: "default options", options: nil, size: DefaultSearchLimit},
+		{name: "limit and from", options: &SearchOptions{Limit: 25, From: 50}, size: 25, from: 50},
+		{name: "cursor", options: &SearchOptions{Cursor: cursor}, size: DefaultSearchLimit, searchAfter: true},
+		{name: "limit too large", options: &SearchOptions{Limit: MaxSearchLimit + 1}, expectedErr: ErrInvalidParams},
+		{name: "negative from", options: &SearchOptions{From: -1}, expectedErr: ErrInvalidParams},
+		{name: "past result window", options: &SearchOptions{From: maxResultWindow}, expectedErr: ErrInvalidParams},
+		{name: "from and cursor", options: &SearchOptions{From: 10, Cursor: cursor}, expectedErr: ErrInvalidParams},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			esQuery := h{}
+			err := tc.options.paginate(esQuery)
+
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v instead", tc.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if esQuery["size"] != tc.size {
+				t.Errorf("Expected size %d, got %v instead", tc.size, esQuery["size"])
+			}
+
+			if esQuery["from"] != tc.from {
+				t.Errorf("Expected from %v, got %v instead", tc.from, esQuery["from"])
+			}
+
+			if _, found := esQuery["search_after"]; found != tc.searchAfter {
+				t.Errorf("Expected search_after %t, got %v", tc.searchAfter, esQuery["search_after"])
+			}
+
+			if esQuery["track_total_hits"] != true {
+				t.Errorf("Expected track_total_hits to be set")
+			}
+		})
+	}
+}
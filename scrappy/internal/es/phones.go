@@ -0,0 +1,199 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"examples/scrappy/internal/phone"
+)
+
+// Numbers not seen by a scrape for this long are marked stale, unless configured otherwise
+const DefaultPhoneStaleAfter = 90 * 24 * time.Hour
+
+// Number of times an update is retried if the company changed while it was applied
+const updateRetryOnConflict = 3
+
+// PhoneSighting is a phone number found by a scrape, along with the page it was found on.
+type PhoneSighting struct {
+	Number     string                      `json:"number"`
+	Source     string                      `json:"source"`
+	Confidence phone.PhoneNumberConfidence `json:"confidence"`
+}
+
+// PhoneRecord is the history of one of the phone numbers of a company.
+type PhoneRecord struct {
+	Number    string    `json:"number"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Number of scrapes which found the number, 0 for numbers added by hand
+	TimesSeen int `json:"times_seen"`
+	// Pages the number was found on
+	Sources []string `json:"sources"`
+	// Highest confidence the number was found with, nil for numbers added by hand
+	Confidence *phone.PhoneNumberConfidence `json:"confidence,omitempty"`
+	// True once the number hasn't been seen for longer than the stale period
+	Stale bool `json:"stale"`
+}
+
+// mergePhoneNumbersScript merges the sightings of a scrape into the phone history of a company.
+//
+// Numbers already in phone_numbers, but missing from the history (added by hand,
+// or scraped before the history was recorded), are added to it first.
+// Every sighted number is then marked as seen, keeping the highest confidence it was found with.
+// Numbers not seen for longer than the stale period are marked stale, and phone_numbers
+// is set to the numbers that aren't. Only numbers found by scrapes on one of the pages visited
+// are checked: numbers added by hand, or found on pages the scrape didn't get to, are kept as they are.
+// The update is a noop if nothing changed.
+//
+// Dates are stored as RFC 3339 strings.
+const mergePhoneNumbersScript = `
+def history = ctx._source.phone_history;
+if (history == null) {
+	history = new ArrayList();
+	ctx._source.phone_history = history;
+}
+
+boolean changed = false;
+Set visited = new HashSet(params.visited);
+Map byNumber = new HashMap();
+for (def record : history) {
+	byNumber.put(record.number, record);
+}
+
+def stored = ctx._source.phone_numbers;
+if (stored instanceof String) {
+	stored = [stored];
+}
+if (stored != null) {
+	for (def number : stored) {
+		if (!byNumber.containsKey(number)) {
+			def record = ['number': number, 'first_seen': params.now, 'last_seen': params.now,
+				'times_seen': 0, 'sources': new ArrayList(), 'stale': false];
+			history.add(record);
+			byNumber.put(number, record);
+			changed = true;
+		}
+	}
+}
+
+for (def sighting : params.sightings) {
+	def record = byNumber.get(sighting.number);
+	if (record == null) {
+		record = ['number': sighting.number, 'first_seen': params.now, 'last_seen': params.now,
+			'times_seen': 0, 'sources': new ArrayList(), 'stale': false];
+		history.add(record);
+		byNumber.put(sighting.number, record);
+	}
+
+	record.last_seen = params.now;
+	record.times_seen += 1;
+	if (record.sources == null) {
+		record.sources = new ArrayList();
+	}
+	if (sighting.source != null && sighting.source != '' && !record.sources.contains(sighting.source)) {
+		record.sources.add(sighting.source);
+	}
+	if (record.confidence == null || sighting.confidence > record.confidence) {
+		record.confidence = sighting.confidence;
+	}
+	changed = true;
+}
+
+List current = new ArrayList();
+for (def record : history) {
+	boolean checked = false;
+	if (record.confidence != null && record.sources != null) {
+		for (def source : record.sources) {
+			if (visited.contains(source)) {
+				checked = true;
+				break;
+			}
+		}
+	}
+
+	boolean stale = record.stale == true;
+	if (checked) {
+		long lastSeen = ZonedDateTime.parse(record.last_seen).toInstant().toEpochMilli();
+		stale = params.now_millis - lastSeen > params.stale_after_millis;
+	}
+	if (record.stale != stale) {
+		record.stale = stale;
+		changed = true;
+	}
+	if (!stale) {
+		current.add(record.number);
+	}
+}
+
+if (changed) {
+	ctx._source.phone_numbers = current;
+} else {
+	ctx.op = 'noop';
+}
+`
+
+// MergePhoneNumbers records the phone numbers found by a scrape of the company with the given url.
+//
+// Unlike UpdateCompanyInfo, numbers found by earlier scrapes or added by hand are kept:
+// the merge is done by a script running on the ES cluster, so concurrent updates aren't lost.
+// Numbers not seen for longer than staleAfter are marked stale in the phone history,
+// and removed from the phone numbers, but never deleted. Only numbers found on one of
+// the visited pages can become stale, since the scrape didn't look for the other ones.
+//
+// Returns whether the phone numbers of the company changed.
+func (c *Client) MergePhoneNumbers(ctx context.Context, url string, sightings []PhoneSighting, visited []string, staleAfter time.Duration) (bool, error) {
+	id, err := urlToId(url)
+	if err != nil {
+		return false, err
+	}
+
+	if staleAfter <= 0 {
+		staleAfter = DefaultPhoneStaleAfter
+	}
+
+	body, err := mergePhoneNumbersBody(sightings, visited, time.Now(), staleAfter)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := c.client.Update(c.companiesIndex, id, bytes.NewReader(body),
+		c.client.Update.WithRetryOnConflict(updateRetryOnConflict),
+		c.client.Update.WithContext(ctx),
+	)
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	err = handleResponse(res, err, &result)
+	if err != nil {
+		return false, fmt.Errorf("failed to merge phone numbers of %q: %w", id, err)
+	}
+
+	return result.Result != bulkResultNoop, nil
+}
+
+func mergePhoneNumbersBody(sightings []PhoneSighting, visited []string, now time.Time, staleAfter time.Duration) ([]byte, error) {
+	if sightings == nil {
+		sightings = []PhoneSighting{}
+	}
+	if visited == nil {
+		visited = []string{}
+	}
+
+	return json.Marshal(h{
+		"script": h{
+			"lang":   "painless",
+			"source": mergePhoneNumbersScript,
+			"params": h{
+				"sightings":          sightings,
+				"visited":            visited,
+				"now":                now.UTC().Format(time.RFC3339),
+				"now_millis":         now.UnixMilli(),
+				"stale_after_millis": staleAfter.Milliseconds(),
+			},
+		},
+	})
+}
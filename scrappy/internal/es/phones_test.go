@@ -0,0 +1,102 @@
+package es
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergePhoneNumbersBody(t *testing.T) {
+	now := time.Date(2022, time.November, 20, 10, 30, 0, 0, time.FixedZone("EET", 2*60*60))
+	sightings := []PhoneSighting{
+		{Number: "+1 617-491-1000", Source: "https://example.com/contact"},
+	}
+
+	visited := []string{"https://example.com", "https://example.com/contact"}
+
+	body, err := mergePhoneNumbersBody(sightings, visited, now, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var decoded struct {
+		Script struct {
+			Lang   string `json:"lang"`
+			Params struct {
+				Sightings        []PhoneSighting `json:"sightings"`
+				Visited          []string        `json:"visited"`
+				Now              string          `json:"now"`
+				NowMillis        int64           `json:"now_millis"`
+				StaleAfterMillis int64           `json:"stale_after_millis"`
+			} `json:"params"`
+		} `json:"script"`
+	}
+	err = json.Unmarshal(body, &decoded)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	params := decoded.Script.Params
+	if decoded.Script.Lang != "painless" {
+		t.Errorf("Expected painless script, got %q instead", decoded.Script.Lang)
+	}
+	if !reflect.DeepEqual(params.Sightings, sightings) {
+		t.Errorf("Expected sightings %v, got %v instead", sightings, params.Sightings)
+	}
+	if !reflect.DeepEqual(params.Visited, visited) {
+		t.Errorf("Expected visited pages %v, got %v instead", visited, params.Visited)
+	}
+	// Dates are sent in UTC, so they compare correctly once stored
+	if params.Now != "2022-11-20T08:30:00Z" {
+		t.Errorf("Expected now to be %q, got %q instead", "2022-11-20T08:30:00Z", params.Now)
+	}
+	if params.NowMillis != now.UnixMilli() {
+		t.Errorf("Expected now_millis to be %d, got %d instead", now.UnixMilli(), params.NowMillis)
+	}
+	if params.StaleAfterMillis != 24*60*60*1000 {
+		t.Errorf("Expected stale_after_millis to be one day, got %d instead", params.StaleAfterMillis)
+	}
+
+	// Scrapes finding no numbers still send empty lists, so staleness is updated
+	body, err = mergePhoneNumbersBody(nil, nil, now, time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	err = json.Unmarshal(body, &decoded)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if decoded.Script.Params.Sightings == nil || decoded.Script.Params.Visited == nil {
+		t.Errorf("Expected empty sightings and visited lists, got null")
+	}
+}
+
+func TestPhoneRecordDecode(t *testing.T) {
+	source := `{
+		"number": "+1 617-491-1000",
+		"first_seen": "2022-08-01T08:00:00Z",
+		"last_seen": "2022-11-20T08:30:00Z",
+		"times_seen": 3,
+		"sources": ["https://example.com/contact"],
+		"stale": true
+	}`
+
+	var record PhoneRecord
+	err := json.Unmarshal([]byte(source), &record)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	expected := PhoneRecord{
+		Number:    "+1 617-491-1000",
+		FirstSeen: time.Date(2022, time.August, 1, 8, 0, 0, 0, time.UTC),
+		LastSeen:  time.Date(2022, time.November, 20, 8, 30, 0, 0, time.UTC),
+		TimesSeen: 3,
+		Sources:   []string{"https://example.com/contact"},
+		Stale:     true,
+	}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("Expected %+v, got %+v instead", expected, record)
+	}
+}
@@ -13,21 +13,95 @@ import (
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
+// Company name fields, boosted by how much we trust each of them.
 var companyNameFields = []string{
+	"commercial_name^3",
+	"legal_name^2",
+	"all_available_names",
+}
+
+// Edge n-gram subfields of the company name fields, used for prefix search.
+var companyNameAutocompleteFields = []string{
+	"commercial_name.autocomplete^3",
+	"legal_name.autocomplete^2",
+	"all_available_names.autocomplete",
+}
+
+// Company name fields highlighted in search results, including the autocomplete subfields.
+var companyNameHighlightFields = []string{
 	"commercial_name",
 	"legal_name",
 	"all_available_names",
+	"commercial_name.autocomplete",
+	"legal_name.autocomplete",
+	"all_available_names.autocomplete",
+}
+
+// Names of the search query clauses, reported in SearchMatch.MatchedQueries
+const (
+	matchNamePhrase   = "name_phrase"
+	matchNameTerms    = "name_terms"
+	matchNamePrefix   = "name_prefix"
+	matchPhone        = "phone_number"
+	matchPhonePartial = "phone_partial"
+)
+
+// Phone number subfields, highlighted in search results
+var phoneNumberFields = []string{
+	phoneNumberSubfield(phoneE164Subfield),
+	phoneNumberSubfield(phoneNationalSubfield),
+	phoneNumberSubfield(phoneLastDigitsSubfield),
 }
 
 type Company struct {
 	csv.Company
 	ID           string   `json:"id"`
 	PhoneNumbers []string `json:"phone_numbers,omitempty"`
+	// Every phone number found by the scraper, including stale ones
+	PhoneHistory []PhoneRecord `json:"phone_history,omitempty"`
+	// Set for companies returned by a search
+	*SearchMatch `json:",omitempty"`
+	// Revision of the stored document, set by GetCompany if the store tracks revisions
+	Version *DocumentVersion `json:"-"`
+}
+
+// DocumentVersion identifies a revision of a stored document,
+// the sequence number increases on every write to the index shard.
+// Sequence numbers start over in a new index, e.g. once reindexed.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/optimistic-concurrency-control.html
+type DocumentVersion struct {
+	// Concrete index holding the document, rather than the alias
+	Index       string
+	SeqNo       int64
+	PrimaryTerm int64
+}
+
+// SearchMatch describes why a company matched a search query.
+type SearchMatch struct {
+	Score float64 `json:"score"`
+	// Names of the query clauses that matched (name_phrase, name_terms, name_prefix, phone_number...)
+	MatchedQueries []string `json:"matched_queries,omitempty"`
+	// Matching fragments of each field, with the matched terms wrapped in <em> tags
+	Highlights map[string][]string `json:"highlights,omitempty"`
+	// How the score was computed, only set when SearchOptions.Explain is true
+	Explanation *Explanation `json:"explanation,omitempty"`
+}
+
+// Explanation is the ES score explanation tree of a search hit.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-explain.html
+type Explanation struct {
+	Value       float64       `json:"value"`
+	Description string        `json:"description"`
+	Details     []Explanation `json:"details,omitempty"`
 }
 
 type SearchCompaniesResult struct {
 	Total     int       `json:"total"`
 	Companies []Company `json:"companies"`
+	// Cursor of the next page, empty on the last page
+	Next string `json:"next,omitempty"`
 }
 
 // Documentation example code for querying ES
@@ -35,15 +109,20 @@ type SearchCompaniesResult struct {
 
 type searchEnvelope struct {
 	Took int
-	Hits struct {
+	// Point in time id, set when searching using a point in time
+	PitID string `json:"pit_id"`
+	Hits  struct {
 		Total struct {
 			Value int
 		}
 		Hits []struct {
-			ID         string          `json:"_id"`
-			Source     json.RawMessage `json:"_source"`
-			Highlights json.RawMessage `json:"_highlight"`
-			Sort       []interface{}   `json:"sort"`
+			ID             string              `json:"_id"`
+			Score          *float64            `json:"_score"`
+			Source         json.RawMessage     `json:"_source"`
+			Highlights     map[string][]string `json:"highlight"`
+			MatchedQueries []string            `json:"matched_queries"`
+			Explanation    *Explanation        `json:"_explanation"`
+			Sort           []interface{}       `json:"sort"`
 		}
 	}
 }
@@ -58,37 +137,51 @@ type esErrorInfo struct {
 	Reason string `json:"reason"`
 }
 
-// SearchCompany searches ElasticSearch for a company by name or phone number
-func (c *Client) SearchCompany(ctx context.Context, query string, phone string) (*SearchCompaniesResult, error) {
+// SearchCompany searches ElasticSearch for a company by name or phone number.
+//
+// Options select the page of results, the first DefaultSearchLimit companies are returned if nil.
+func (c *Client) SearchCompany(ctx context.Context, query string, phone string, options *SearchOptions) (*SearchCompaniesResult, error) {
 	switch {
 	case query == "" && phone == "":
 		return nil, fmt.Errorf("%w: missing query argument", ErrInvalidParams)
 	case query != "" && phone != "":
 		return nil, fmt.Errorf("%w: must provide either query or phone number", ErrInvalidParams)
 	case phone != "":
-		return c.SearchCompanyByPhone(ctx, phone)
+		return c.SearchCompanyByPhone(ctx, phone, options)
 	default:
-		return c.SearchCompanyByName(ctx, query)
+		return c.SearchCompanyByName(ctx, query, options)
 	}
 }
 
 // SearchCompany searches ElasticSearch for a company by name.
-func (c *Client) SearchCompanyByName(ctx context.Context, query string) (*SearchCompaniesResult, error) {
-	return c.searchQuery(ctx, searchCompanyByNameQuery(query))
+func (c *Client) SearchCompanyByName(ctx context.Context, query string, options *SearchOptions) (*SearchCompaniesResult, error) {
+	return c.searchQuery(ctx, searchCompanyByNameQuery(query), options)
 }
 
 // SearchCompanyByPhone searches ElasticSearch for a company by phone number.
-func (c *Client) SearchCompanyByPhone(ctx context.Context, phoneNumber string) (*SearchCompaniesResult, error) {
-	// Validate and normalize phone number format for US
-	phone, err := phone.ValidatePhoneNumberString(phoneNumber)
+//
+// Numbers can be in any format, with or without an extension.
+// Partial numbers, like "491-1000", match the last digits of the stored numbers.
+func (c *Client) SearchCompanyByPhone(ctx context.Context, phoneNumber string, options *SearchOptions) (*SearchCompaniesResult, error) {
+	query, err := phoneNumberQuery(phoneNumber, 1)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.searchQuery(ctx, searchCompanyByPhoneQuery(phone.Number))
+	esQuery := h{
+		"query":     query,
+		"highlight": highlightFields(phoneNumberFields...),
+	}
+
+	return c.searchQuery(ctx, esQuery, options)
 }
 
-func (c *Client) searchQuery(ctx context.Context, query io.Reader) (*SearchCompaniesResult, error) {
+func (c *Client) searchQuery(ctx context.Context, esQuery h, options *SearchOptions) (*SearchCompaniesResult, error) {
+	query, limit, err := searchBody(esQuery, options)
+	if err != nil {
+		return nil, err
+	}
+
 	searchAPI := c.client.Search
 
 	// Send search request to ES
@@ -99,14 +192,60 @@ func (c *Client) searchQuery(ctx context.Context, query io.Reader) (*SearchCompa
 	)
 	// Check network errors
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", ErrSearchResult, err)
+		return nil, requestFailed(ErrSearchResult, err)
+	}
+
+	return handleSearchResponse(res, limit)
+}
+
+// searchBody adds the pagination parameters to the search query,
+// returning the encoded request body and the page size.
+func searchBody(esQuery h, options *SearchOptions) (io.Reader, int, error) {
+	err := options.paginate(esQuery)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return handleSearchResponse(res)
+	// Scores are only computed when sorting by _score, make sure they are always returned
+	esQuery["track_scores"] = true
+	if options != nil && options.Explain {
+		esQuery["explain"] = true
+	}
+
+	encoded, _ := json.Marshal(esQuery)
+	return bytes.NewReader(encoded), esQuery["size"].(int), nil
 }
 
-func handleSearchResponse(res *esapi.Response) (*SearchCompaniesResult, error) {
-	var result SearchCompaniesResult
+func handleSearchResponse(res *esapi.Response, limit int) (*SearchCompaniesResult, error) {
+	envelope, err := decodeSearchResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	companies, err := envelope.companies()
+	if err != nil {
+		return nil, err
+	}
+
+	result := SearchCompaniesResult{
+		Total:     envelope.Hits.Total.Value,
+		Companies: companies,
+	}
+
+	// A full page means there may be more results, the next page starts after its last hit
+	hits := envelope.Hits.Hits
+	if len(hits) > 0 && len(hits) == limit {
+		result.Next, err = encodeCursor(hits[len(hits)-1].Sort)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+		}
+	}
+
+	return &result, nil
+}
+
+// decodeSearchResponse checks the ES response for errors and decodes the search envelope.
+func decodeSearchResponse(res *esapi.Response) (*searchEnvelope, error) {
 	defer res.Body.Close()
 
 	// Check errors returned by ES
@@ -114,19 +253,25 @@ func handleSearchResponse(res *esapi.Response) (*SearchCompaniesResult, error) {
 		return nil, errorFromResponse(res)
 	}
 
-	// Decode ES search response
+	// Decode ES search response.
+	// Numbers are kept as json.Number, so long sort values don't lose precision
+	// when they are sent back to ES as search_after values.
 	var envelope searchEnvelope
-	err := json.NewDecoder(res.Body).Decode(&envelope)
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	err := decoder.Decode(&envelope)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
 	}
 
-	result.Total = envelope.Hits.Total.Value
-	if len(envelope.Hits.Hits) < 1 {
-		return &result, nil
-	}
+	return &envelope, nil
+}
+
+// companies decodes the company of each search hit.
+func (e *searchEnvelope) companies() ([]Company, error) {
+	var companies []Company
 
-	for index, hit := range envelope.Hits.Hits {
+	for index, hit := range e.Hits.Hits {
 		var company Company
 		company.ID = hit.ID
 
@@ -136,43 +281,108 @@ func handleSearchResponse(res *esapi.Response) (*SearchCompaniesResult, error) {
 			return nil, fmt.Errorf("%w: %s (index %d)", ErrUnexpectedResponse, err, index)
 		}
 
-		result.Companies = append(result.Companies, company)
+		// Scores aren't returned when paging through a point in time, sorted by _shard_doc
+		if hit.Score != nil {
+			company.SearchMatch = &SearchMatch{
+				Score:          *hit.Score,
+				MatchedQueries: hit.MatchedQueries,
+				Highlights:     hit.Highlights,
+				Explanation:    hit.Explanation,
+			}
+		}
+
+		companies = append(companies, company)
 	}
 
-	return &result, nil
+	return companies, nil
 }
 
-func searchCompanyByNameQuery(query string) io.Reader {
+// searchCompanyByNameQuery matches company names, scoring exact phrases highest,
+// then names containing every query term, then names starting with the query terms.
+func searchCompanyByNameQuery(query string) h {
 	esQuery := h{
 		"query": h{
-			"multi_match": h{
-				"query":  query,
-				"fields": companyNameFields,
+			"bool": h{
+				"should": a{
+					h{"multi_match": h{
+						"query":  query,
+						"type":   "phrase",
+						"fields": companyNameFields,
+						"boost":  3,
+						"_name":  matchNamePhrase,
+					}},
+					h{"multi_match": h{
+						"query":  query,
+						"type":   "best_fields",
+						"fields": companyNameFields,
+						"boost":  2,
+						"_name":  matchNameTerms,
+					}},
+					h{"multi_match": h{
+						"query":    query,
+						"type":     "best_fields",
+						"fields":   companyNameAutocompleteFields,
+						"operator": "and",
+						"_name":    matchNamePrefix,
+					}},
+				},
+				"minimum_should_match": 1,
 			},
 		},
-		"sort": a{
-			h{"_score": "desc"},
-			h{"_doc": "asc"},
-		},
+		"highlight": highlightFields(companyNameHighlightFields...),
 	}
 
-	encoded, _ := json.Marshal(esQuery)
-	return bytes.NewReader(encoded)
+	return esQuery
 }
 
-func searchCompanyByPhoneQuery(phoneNumber string) io.Reader {
-	esQuery := h{
-		"query": h{
-			"match": h{
-				"phone_numbers": phoneNumber,
-			},
-		},
-		"sort": a{
-			h{"_score": "desc"},
-			h{"_doc": "asc"},
-		},
+// phoneNumberQuery matches the E.164 form and national digits of valid numbers,
+// scoring exact numbers above numbers sharing the same last digits.
+func phoneNumberQuery(phoneNumber string, boost float64) (h, error) {
+	// Normalize the phone number using the same rules as the scraped numbers
+	forms, err := phone.ParseNumberForms(phoneNumber)
+	if err != nil {
+		return nil, InvalidParams(err)
 	}
 
-	encoded, _ := json.Marshal(esQuery)
-	return bytes.NewReader(encoded)
+	var should a
+	if forms.E164 != "" {
+		should = append(should,
+			h{"term": h{phoneNumberSubfield(phoneE164Subfield): h{
+				"value": forms.E164,
+				"boost": 3,
+				"_name": matchPhone,
+			}}},
+			h{"term": h{phoneNumberSubfield(phoneNationalSubfield): h{
+				"value": forms.NationalDigits,
+				"boost": 2,
+				"_name": matchPhone,
+			}}},
+		)
+	}
+
+	should = append(should, h{"term": h{phoneNumberSubfield(phoneLastDigitsSubfield): h{
+		"value": forms.LastDigits,
+		"_name": matchPhonePartial,
+	}}})
+
+	return h{"bool": h{
+		"should":               should,
+		"minimum_should_match": 1,
+		"boost":                boost,
+	}}, nil
+}
+
+func phoneNumberSubfield(subfield string) string {
+	return "phone_numbers." + subfield
+}
+
+// highlightFields requests highlighting of the whole value of each field,
+// since company names and phone numbers are short.
+func highlightFields(fields ...string) h {
+	highlighted := h{}
+	for _, field := range fields {
+		highlighted[field] = h{"number_of_fragments": 0}
+	}
+
+	return h{"fields": highlighted}
 }
@@ -0,0 +1,131 @@
+package es
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"examples/scrappy/internal/phone"
+)
+
+const searchResponse = `{
+	"took": 3,
+	"hits": {
+		"total": {"value": 2},
+		"hits": [
+			{
+				"_id": "mazautoglass.com",
+				"_score": 4.5,
+				"_source": {"domain": "https://mazautoglass.com", "commercial_name": "MAZ Auto Glass"},
+				"highlight": {"commercial_name": ["MAZ Auto <em>Glass</em>"]},
+				"matched_queries": ["name_phrase", "name_terms"],
+				"_explanation": {
+					"value": 4.5,
+					"description": "sum of:",
+					"details": [{"value": 4.5, "description": "weight(commercial_name:glass)"}]
+				},
+				"sort": [4.5, "mazautoglass.com"]
+			},
+			{
+				"_id": "putitontheglass.com",
+				"_source": {"domain": "https://putitontheglass.com"},
+				"sort": [1]
+			}
+		]
+	}
+}`
+
+func TestSearchEnvelopeCompanies(t *testing.T) {
+	var envelope searchEnvelope
+	err := json.NewDecoder(strings.NewReader(searchResponse)).Decode(&envelope)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	companies, err := envelope.companies()
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if len(companies) != 2 {
+		t.Fatalf("Expected 2 companies, got %d instead", len(companies))
+	}
+
+	expected := &SearchMatch{
+		Score:          4.5,
+		MatchedQueries: []string{matchNamePhrase, matchNameTerms},
+		Highlights:     map[string][]string{"commercial_name": {"MAZ Auto <em>Glass</em>"}},
+		Explanation: &Explanation{
+			Value:       4.5,
+			Description: "sum of:",
+			Details:     []Explanation{{Value: 4.5, Description: "weight(commercial_name:glass)"}},
+		},
+	}
+	if !reflect.DeepEqual(companies[0].SearchMatch, expected) {
+		t.Errorf("Expected %+v, got %+v instead", expected, companies[0].SearchMatch)
+	}
+
+	// Hits without a score, such as exports, have no search match details
+	if companies[1].SearchMatch != nil {
+		t.Errorf("Expected no search match, got %+v", companies[1].SearchMatch)
+	}
+
+	encoded, err := json.Marshal(companies[1])
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if strings.Contains(string(encoded), "score") {
+		t.Errorf("Expected no score in %s", encoded)
+	}
+}
+
+func TestPhoneNumberQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		number   string
+		expected map[string]string
+	}{
+		{
+			name:   "full number",
+			number: "617.491.1000 ext 12",
+			expected: map[string]string{
+				"phone_numbers.e164":     "+16174911000",
+				"phone_numbers.national": "6174911000",
+				"phone_numbers.last7":    "4911000",
+			},
+		},
+		{
+			name:     "partial number",
+			number:   "491-1000",
+			expected: map[string]string{"phone_numbers.last7": "4911000"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := phoneNumberQuery(tc.number, 1)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			terms := map[string]string{}
+			for _, clause := range query["bool"].(h)["should"].(a) {
+				for field, params := range clause["term"].(h) {
+					terms[field] = params.(h)["value"].(string)
+				}
+			}
+
+			if !reflect.DeepEqual(terms, tc.expected) {
+				t.Errorf("Expected terms %v, got %v instead", tc.expected, terms)
+			}
+		})
+	}
+
+	// The validation error is kept, next to ErrInvalidParams
+	_, err := phoneNumberQuery("1000", 1)
+	if !errors.Is(err, ErrInvalidParams) || !errors.Is(err, phone.ErrInvalidNumber) {
+		t.Errorf("Expected ErrInvalidParams and phone.ErrInvalidNumber, got %v", err)
+	}
+}
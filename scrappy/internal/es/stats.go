@@ -0,0 +1,374 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"examples/scrappy/internal/phone"
+)
+
+// Number of TLD buckets returned by CompanyStats
+const statsTLDBuckets = 20
+
+// Number of phone count buckets returned by CompanyStats, companies with more numbers are rare
+const statsPhoneCountBuckets = 20
+
+// Confidence bucket key of phone numbers added by hand, which have no confidence
+const statsManualConfidence = -1
+
+// Kinds of company data counted by CompanyStats, and the fields holding them.
+//
+// Only phone numbers are collected by the scraper,
+// other kinds of data are counted when imported as extra CSV columns, or set using UpdateCompanyInfo.
+// Companies count once for a kind of data, whichever of its fields they have, e.g. the facebook field
+// is filled on import from a facebook column, which is also kept in the attributes.
+var statsFillFields = []struct {
+	name   string
+	fields []string
+}{
+	{name: "phone_numbers", fields: []string{"phone_numbers"}},
+	{name: "emails", fields: []string{"emails", "attributes.email"}},
+	{name: "addresses", fields: []string{"addresses", "attributes.address"}},
+	{name: "social_profiles", fields: []string{
+		"facebook",
+		"attributes.facebook",
+		"attributes.twitter",
+		"attributes.linkedin",
+		"attributes.instagram",
+	}},
+}
+
+// Number of domains of the scrape history read by each request of CompanyStats
+const statsScrapeDomainsPage = 1000
+
+// Companies are bucketed by how long ago they were last scraped,
+// in the first range they were scraped within, the last range has no bound
+var statsFreshnessRanges = []struct {
+	key    string
+	within time.Duration
+}{
+	{key: "last day", within: 24 * time.Hour},
+	{key: "1-7 days", within: 7 * 24 * time.Hour},
+	{key: "7-30 days", within: 30 * 24 * time.Hour},
+	{key: "30-90 days", within: 90 * 24 * time.Hour},
+	{key: "over 90 days"},
+}
+
+// Freshness bucket key of companies without any scrape in the history
+const statsNotScraped = "no scrape recorded"
+
+// Top level domain of the company domain, e.g. "com" for "https://mazautoglass.com"
+const tldScript = `
+if (doc['domain'].size() == 0) {
+	return;
+}
+String host = doc['domain'].value;
+int scheme = host.indexOf('://');
+if (scheme >= 0) {
+	host = host.substring(scheme + 3);
+}
+int path = host.indexOf('/');
+if (path >= 0) {
+	host = host.substring(0, path);
+}
+emit(host.substring(host.lastIndexOf('.') + 1).toLowerCase());
+`
+
+// FillRate counts the companies having a kind of data.
+type FillRate struct {
+	Field string `json:"field"`
+	Count int    `json:"count"`
+	// Fraction of all companies, between 0 and 1
+	Rate float64 `json:"rate"`
+}
+
+// StatsBucket counts the companies, or phone numbers, sharing a value.
+type StatsBucket struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// CompanyStats reports how complete the companies data is.
+type CompanyStats struct {
+	Total     int        `json:"total"`
+	FillRates []FillRate `json:"fill_rates"`
+	// Companies by their number of current phone numbers
+	PhoneCounts []StatsBucket `json:"phone_counts"`
+	// Companies by the top level domain of their website, most common first
+	TLDs []StatsBucket `json:"tlds"`
+	// Phone numbers, including stale ones, by the highest confidence they were found with
+	PhoneConfidence []StatsBucket `json:"phone_confidence"`
+	// Companies by how long ago they were last scraped, read from the scrape history
+	ScrapeFreshness []StatsBucket `json:"scrape_freshness"`
+}
+
+// statsBucketsEnvelope decodes the buckets of a terms aggregation,
+// keys are either strings or numbers depending on the field.
+type statsBucketsEnvelope struct {
+	Buckets []struct {
+		Key      json.RawMessage `json:"key"`
+		DocCount int             `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+type statsEnvelope struct {
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+	} `json:"hits"`
+	Aggregations struct {
+		FillRates struct {
+			Buckets map[string]struct {
+				DocCount int `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"fill_rates"`
+		PhoneCounts  statsBucketsEnvelope `json:"phone_counts"`
+		TLDs         statsBucketsEnvelope `json:"tlds"`
+		PhoneHistory struct {
+			Confidence statsBucketsEnvelope `json:"confidence"`
+		} `json:"phone_history"`
+	} `json:"aggregations"`
+}
+
+// scrapeFreshnessEnvelope decodes a page of the latest scrape of each domain.
+type scrapeFreshnessEnvelope struct {
+	Aggregations struct {
+		Domains struct {
+			AfterKey json.RawMessage `json:"after_key"`
+			Buckets  []struct {
+				LastScraped struct {
+					// Epoch milliseconds, null if no scrape has a date
+					Value *float64 `json:"value"`
+				} `json:"last_scraped"`
+			} `json:"buckets"`
+		} `json:"domains"`
+	} `json:"aggregations"`
+}
+
+// CompanyStats computes coverage statistics of the companies index, using aggregations.
+//
+// The scrape freshness is read from the scrape history, see scrapeFreshness.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations.html
+func (c *Client) CompanyStats(ctx context.Context) (*CompanyStats, error) {
+	body, err := json.Marshal(companyStatsQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.Search(
+		c.client.Search.WithIndex(c.companiesIndex),
+		c.client.Search.WithBody(bytes.NewReader(body)),
+		c.client.Search.WithContext(ctx),
+	)
+
+	var envelope statsEnvelope
+	err = handleResponse(res, err, &envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute company stats: %w", err)
+	}
+
+	stats := envelope.stats()
+	stats.ScrapeFreshness, err = c.scrapeFreshness(ctx, stats.Total, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute scrape freshness: %w", err)
+	}
+
+	return stats, nil
+}
+
+// scrapeFreshness counts the companies by how long ago their latest scrape was,
+// paging through the domains of the scrape history using a composite aggregation.
+//
+// Companies without a scrape in the history, e.g. scraped before it was recorded, are counted apart.
+// The history of deleted companies is kept, so they still count as scraped.
+//
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-aggregations-bucket-composite-aggregation.html
+func (c *Client) scrapeFreshness(ctx context.Context, total int, now time.Time) ([]StatsBucket, error) {
+	counts := make([]int, len(statsFreshnessRanges))
+	scraped := 0
+
+	var after json.RawMessage
+	for {
+		body, err := json.Marshal(scrapeFreshnessQuery(after))
+		if err != nil {
+			return nil, err
+		}
+
+		// No scrapes index exists before the first scrape
+		res, err := c.client.Search(
+			c.client.Search.WithIndex(scrapesIndexPrefix+"*"),
+			c.client.Search.WithBody(bytes.NewReader(body)),
+			c.client.Search.WithAllowNoIndices(true),
+			c.client.Search.WithIgnoreUnavailable(true),
+			c.client.Search.WithContext(ctx),
+		)
+
+		var envelope scrapeFreshnessEnvelope
+		err = handleResponse(res, err, &envelope)
+		if err != nil {
+			return nil, err
+		}
+
+		domains := &envelope.Aggregations.Domains
+		for _, bucket := range domains.Buckets {
+			if bucket.LastScraped.Value == nil {
+				continue
+			}
+			lastScraped := time.UnixMilli(int64(*bucket.LastScraped.Value))
+			counts[freshnessRange(now.Sub(lastScraped))]++
+			scraped++
+		}
+
+		if len(domains.Buckets) < statsScrapeDomainsPage || domains.AfterKey == nil {
+			break
+		}
+		after = domains.AfterKey
+	}
+
+	buckets := make([]StatsBucket, 0, len(statsFreshnessRanges)+1)
+	for index, freshness := range statsFreshnessRanges {
+		buckets = append(buckets, StatsBucket{Key: freshness.key, Count: counts[index]})
+	}
+
+	notScraped := total - scraped
+	if notScraped < 0 {
+		notScraped = 0
+	}
+	buckets = append(buckets, StatsBucket{Key: statsNotScraped, Count: notScraped})
+
+	return buckets, nil
+}
+
+// scrapeFreshnessQuery requests a page of domains of the scrape history, with their latest scrape,
+// after the given composite key.
+func scrapeFreshnessQuery(after json.RawMessage) h {
+	composite := h{
+		"size":    statsScrapeDomainsPage,
+		"sources": a{h{"domain": h{"terms": h{"field": "domain"}}}},
+	}
+	if after != nil {
+		composite["after"] = after
+	}
+
+	return h{
+		"size": 0,
+		"aggs": h{
+			"domains": h{
+				"composite": composite,
+				"aggs": h{
+					"last_scraped": h{"max": h{"field": "scraped_at"}},
+				},
+			},
+		},
+	}
+}
+
+// freshnessRange returns the index of the first freshness range a scrape of the given age is within.
+func freshnessRange(age time.Duration) int {
+	for index, freshness := range statsFreshnessRanges {
+		if age < freshness.within {
+			return index
+		}
+	}
+
+	return len(statsFreshnessRanges) - 1
+}
+
+func companyStatsQuery() h {
+	fillFilters := h{}
+	for _, fill := range statsFillFields {
+		exists := a{}
+		for _, field := range fill.fields {
+			exists = append(exists, h{"exists": h{"field": field}})
+		}
+		fillFilters[fill.name] = h{"bool": h{"should": exists, "minimum_should_match": 1}}
+	}
+
+	return h{
+		"size":             0,
+		"track_total_hits": true,
+		"runtime_mappings": h{
+			"tld": h{
+				"type":   "keyword",
+				"script": h{"source": tldScript},
+			},
+			"phone_count": h{
+				"type":   "long",
+				"script": h{"source": "emit(doc['phone_numbers'].size())"},
+			},
+		},
+		"aggs": h{
+			"fill_rates": h{"filters": h{"filters": fillFilters}},
+			"phone_counts": h{"terms": h{
+				"field": "phone_count",
+				"size":  statsPhoneCountBuckets,
+				"order": h{"_key": "asc"},
+			}},
+			"tlds": h{"terms": h{
+				"field": "tld",
+				"size":  statsTLDBuckets,
+			}},
+			"phone_history": h{
+				"nested": h{"path": "phone_history"},
+				"aggs": h{
+					"confidence": h{"terms": h{
+						"field":   "phone_history.confidence",
+						"missing": statsManualConfidence,
+						"order":   h{"_key": "desc"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// stats converts the aggregations into CompanyStats, keeping the buckets in a stable order.
+func (e *statsEnvelope) stats() *CompanyStats {
+	aggs := &e.Aggregations
+	stats := &CompanyStats{
+		Total:           e.Hits.Total.Value,
+		FillRates:       []FillRate{},
+		PhoneCounts:     aggs.PhoneCounts.buckets(),
+		TLDs:            aggs.TLDs.buckets(),
+		PhoneConfidence: []StatsBucket{},
+		ScrapeFreshness: []StatsBucket{},
+	}
+
+	for _, fill := range statsFillFields {
+		rate := FillRate{Field: fill.name, Count: aggs.FillRates.Buckets[fill.name].DocCount}
+		if stats.Total > 0 {
+			rate.Rate = float64(rate.Count) / float64(stats.Total)
+		}
+		stats.FillRates = append(stats.FillRates, rate)
+	}
+
+	for _, bucket := range aggs.PhoneHistory.Confidence.Buckets {
+		key := "added by hand"
+		confidence, err := strconv.Atoi(string(bucket.Key))
+		if err == nil && confidence != statsManualConfidence {
+			key = phone.PhoneNumberConfidence(confidence).String()
+		}
+		stats.PhoneConfidence = append(stats.PhoneConfidence, StatsBucket{Key: key, Count: bucket.DocCount})
+	}
+
+	return stats
+}
+
+func (e *statsBucketsEnvelope) buckets() []StatsBucket {
+	buckets := []StatsBucket{}
+	for _, bucket := range e.Buckets {
+		var key string
+		if json.Unmarshal(bucket.Key, &key) != nil {
+			key = string(bucket.Key)
+		}
+		buckets = append(buckets, StatsBucket{Key: key, Count: bucket.DocCount})
+	}
+
+	return buckets
+}
@@ -0,0 +1,211 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleStatsResponse = `{
+	"hits": {"total": {"value": 4, "relation": "eq"}, "hits": []},
+	"aggregations": {
+		"fill_rates": {"buckets": {
+			"phone_numbers": {"doc_count": 3},
+			"emails": {"doc_count": 1},
+			"addresses": {"doc_count": 0},
+			"social_profiles": {"doc_count": 2}
+		}},
+		"phone_counts": {"buckets": [
+			{"key": 0, "doc_count": 1},
+			{"key": 2, "doc_count": 3}
+		]},
+		"tlds": {"buckets": [
+			{"key": "com", "doc_count": 3},
+			{"key": "ro", "doc_count": 1}
+		]},
+		"phone_history": {
+			"doc_count": 7,
+			"confidence": {"buckets": [
+				{"key": 2, "doc_count": 4},
+				{"key": 0, "doc_count": 2},
+				{"key": -1, "doc_count": 1}
+			]}
+		}
+	}
+}`
+
+func TestCompanyStatsDecode(t *testing.T) {
+	var envelope statsEnvelope
+	err := json.Unmarshal([]byte(sampleStatsResponse), &envelope)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	expected := &CompanyStats{
+		Total: 4,
+		FillRates: []FillRate{
+			{Field: "phone_numbers", Count: 3, Rate: 0.75},
+			{Field: "emails", Count: 1, Rate: 0.25},
+			{Field: "addresses", Count: 0, Rate: 0},
+			{Field: "social_profiles", Count: 2, Rate: 0.5},
+		},
+		PhoneCounts: []StatsBucket{{Key: "0", Count: 1}, {Key: "2", Count: 3}},
+		TLDs:        []StatsBucket{{Key: "com", Count: 3}, {Key: "ro", Count: 1}},
+		PhoneConfidence: []StatsBucket{
+			{Key: `a[href="tel:< phone number >"]`, Count: 4},
+			{Key: "regex match", Count: 2},
+			{Key: "added by hand", Count: 1},
+		},
+		ScrapeFreshness: []StatsBucket{},
+	}
+
+	stats := envelope.stats()
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected stats %+v, got %+v instead", expected, stats)
+	}
+}
+
+func TestCompanyStatsEmptyIndex(t *testing.T) {
+	var envelope statsEnvelope
+	err := json.Unmarshal([]byte(`{"hits": {"total": {"value": 0}}}`), &envelope)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	stats := envelope.stats()
+	if len(stats.FillRates) != len(statsFillFields) {
+		t.Fatalf("Expected %d fill rates, got %d instead", len(statsFillFields), len(stats.FillRates))
+	}
+	for _, rate := range stats.FillRates {
+		if rate.Rate != 0 {
+			t.Errorf("Expected %s fill rate to be 0, got %f instead", rate.Field, rate.Rate)
+		}
+	}
+
+	// Empty buckets are encoded as lists, not null
+	encoded, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	var decoded map[string]any
+	json.Unmarshal(encoded, &decoded)
+	for _, field := range []string{"phone_counts", "tlds", "phone_confidence", "scrape_freshness"} {
+		if _, ok := decoded[field].([]any); !ok {
+			t.Errorf("Expected %s to be a list, got %v instead", field, decoded[field])
+		}
+	}
+}
+
+func TestCompanyStatsQuery(t *testing.T) {
+	query := companyStatsQuery()
+
+	if query["size"] != 0 {
+		t.Errorf("Expected no hits to be returned, got size %v instead", query["size"])
+	}
+
+	aggs := query["aggs"].(h)
+	for _, name := range []string{"fill_rates", "phone_counts", "tlds", "phone_history"} {
+		if _, ok := aggs[name]; !ok {
+			t.Errorf("Expected aggregation %q", name)
+		}
+	}
+
+	filters := aggs["fill_rates"].(h)["filters"].(h)["filters"].(h)
+	for _, fill := range statsFillFields {
+		should := filters[fill.name].(h)["bool"].(h)["should"].(a)
+		if len(should) != len(fill.fields) {
+			t.Errorf("Expected %s filter to check %d fields, got %d instead",
+				fill.name, len(fill.fields), len(should))
+		}
+	}
+}
+
+func TestScrapeFreshness(t *testing.T) {
+	now := time.Date(2022, 11, 30, 12, 0, 0, 0, time.UTC)
+	scrapedAt := func(age time.Duration) string {
+		return fmt.Sprint(now.Add(-age).UnixMilli())
+	}
+
+	// Domains of the scrape history, by composite page, with their latest scrape
+	pages := [][]string{make([]string, 0, statsScrapeDomainsPage), {scrapedAt(3 * 24 * time.Hour), "null"}}
+	for len(pages[0]) < statsScrapeDomainsPage-2 {
+		pages[0] = append(pages[0], scrapedAt(time.Hour))
+	}
+	pages[0] = append(pages[0], scrapedAt(60*24*time.Hour), scrapedAt(200*24*time.Hour))
+
+	var afters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path != "/scrapes-*/_search" || r.URL.Query().Get("allow_no_indices") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error": {"type": "unexpected", "reason": "%s %s"}}`, r.Method, r.URL)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			Aggs struct {
+				Domains struct {
+					Composite struct {
+						After struct {
+							Domain string `json:"domain"`
+						} `json:"after"`
+					} `json:"composite"`
+				} `json:"domains"`
+			} `json:"aggs"`
+		}
+		json.Unmarshal(body, &request)
+		after := request.Aggs.Domains.Composite.After.Domain
+		afters = append(afters, after)
+
+		page := 0
+		if after != "" {
+			fmt.Sscanf(after, "page-%d", &page)
+		}
+
+		var buckets []string
+		for _, value := range pages[page] {
+			buckets = append(buckets, fmt.Sprintf(`{"key": {"domain": "d"}, "last_scraped": {"value": %s}}`, value))
+		}
+		fmt.Fprintf(w, `{"aggregations": {"domains": {"after_key": {"domain": "page-%d"}, "buckets": [%s]}}}`,
+			page+1, strings.Join(buckets, ","))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	buckets, err := client.scrapeFreshness(context.Background(), 1010, now)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	expected := []StatsBucket{
+		{Key: "last day", Count: statsScrapeDomainsPage - 2},
+		{Key: "1-7 days", Count: 1},
+		{Key: "7-30 days", Count: 0},
+		{Key: "30-90 days", Count: 1},
+		{Key: "over 90 days", Count: 1},
+		// The domain without a scrape date counts as not scraped
+		{Key: statsNotScraped, Count: 1010 - statsScrapeDomainsPage - 1},
+	}
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("Expected buckets %+v, got %+v instead", expected, buckets)
+	}
+
+	// The second page is requested after the key of the first, the short page is the last
+	if expected := []string{"", "page-1"}; !reflect.DeepEqual(afters, expected) {
+		t.Errorf("Expected requests after %q, got %q instead", expected, afters)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 )
 
@@ -25,7 +24,7 @@ func (c *Client) UpdateCompanyInfo(ctx context.Context, url string, info map[str
 	)
 
 	if err != nil {
-		return fmt.Errorf("%w: %s", ErrFailedRequest, err)
+		return requestFailed(ErrFailedRequest, err)
 	}
 
 	if response.IsError() {
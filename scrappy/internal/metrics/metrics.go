@@ -0,0 +1,149 @@
+// Package metrics exports the server, scraper and ES metrics in the Prometheus format.
+//
+// Metrics implements the observers of the server, web and es packages,
+// which don't depend on Prometheus themselves.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Prefix of every metric name
+const namespace = "scrappy"
+
+// Scrapes take from a second to several minutes, with the random delay between pages
+var scrapeDurationBuckets = prometheus.ExponentialBuckets(1, 2, 10)
+
+// Metrics collects the metrics in its own registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests   *prometheus.HistogramVec
+	esRequests     *prometheus.HistogramVec
+	esBulkFailures *prometheus.CounterVec
+	pages          *prometheus.CounterVec
+	downloaded     prometheus.Counter
+	scrapes        *prometheus.HistogramVec
+	phoneNumbers   prometheus.Counter
+	checks         *prometheus.HistogramVec
+}
+
+// New returns the metrics, registered along with the Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of the requests served, by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		esRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "es_request_duration_seconds",
+			Help:      "Duration of the requests sent to ElasticSearch, by API and status, 0 if no response was received.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "code"}),
+		esBulkFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "es_bulk_failures_total",
+			Help:      "Bulk items ElasticSearch failed to write, by action.",
+		}, []string{"action"}),
+		pages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_pages_total",
+			Help:      "Pages fetched while scraping, by status, 0 if no response was received.",
+		}, []string{"code"}),
+		downloaded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_downloaded_bytes_total",
+			Help:      "Bytes of the page bodies downloaded while scraping.",
+		}),
+		scrapes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "scrape_duration_seconds",
+			Help:      "Duration of each domain scrape, by result.",
+			Buckets:   scrapeDurationBuckets,
+		}, []string{"result"}),
+		phoneNumbers: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_phone_numbers_total",
+			Help:      "Valid phone numbers found while scraping.",
+		}),
+		checks: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "domain_check_duration_seconds",
+			Help:      "Duration of the domain checks, by status, 0 if the check failed.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"code"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.esRequests,
+		m.esBulkFailures,
+		m.pages,
+		m.downloaded,
+		m.scrapes,
+		m.phoneNumbers,
+		m.checks,
+	)
+
+	return m
+}
+
+// Handler returns the handler exposing the metrics to Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Push sends the metrics to a Prometheus Pushgateway, replacing the metrics previously pushed for the job.
+func (m *Metrics) Push(url string, job string) error {
+	return push.New(url, job).Gatherer(m.registry).Push()
+}
+
+// ObserveHTTPRequest implements server.RequestObserver.
+func (m *Metrics) ObserveHTTPRequest(route string, method string, status int, duration time.Duration) {
+	m.httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveESRequest implements es.Observer.
+func (m *Metrics) ObserveESRequest(operation string, status int, duration time.Duration) {
+	m.esRequests.WithLabelValues(operation, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveBulkFailure implements es.Observer.
+func (m *Metrics) ObserveBulkFailure(action string) {
+	m.esBulkFailures.WithLabelValues(action).Inc()
+}
+
+// ObservePage implements web.Observer.
+func (m *Metrics) ObservePage(status int, bytes int) {
+	m.pages.WithLabelValues(strconv.Itoa(status)).Inc()
+	m.downloaded.Add(float64(bytes))
+}
+
+// ObserveScrape implements web.Observer.
+func (m *Metrics) ObserveScrape(duration time.Duration, phoneNumbers int, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.scrapes.WithLabelValues(result).Observe(duration.Seconds())
+	m.phoneNumbers.Add(float64(phoneNumbers))
+}
+
+// ObserveCheck implements web.Observer.
+func (m *Metrics) ObserveCheck(status int, duration time.Duration) {
+	m.checks.WithLabelValues(strconv.Itoa(status)).Observe(duration.Seconds())
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObservePage(t *testing.T) {
+	m := New()
+	m.ObservePage(200, 1024)
+	m.ObservePage(200, 512)
+	m.ObservePage(404, 128)
+	m.ObservePage(0, 0)
+
+	testCases := []struct {
+		code     string
+		expected float64
+	}{
+		{code: "200", expected: 2},
+		{code: "404", expected: 1},
+		{code: "0", expected: 1},
+		{code: "500", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code, func(t *testing.T) {
+			count := testutil.ToFloat64(m.pages.WithLabelValues(tc.code))
+			if count != tc.expected {
+				t.Errorf("Expected %v pages, got %v", tc.expected, count)
+			}
+		})
+	}
+
+	downloaded := testutil.ToFloat64(m.downloaded)
+	if downloaded != 1664 {
+		t.Errorf("Expected 1664 bytes downloaded, got %v", downloaded)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ObserveHTTPRequest("/companies/{domain}", http.MethodGet, http.StatusOK, 20*time.Millisecond)
+	m.ObserveHTTPRequest("/companies/{domain}", http.MethodGet, http.StatusNotFound, 5*time.Millisecond)
+	m.ObserveESRequest("doc", http.StatusOK, 15*time.Millisecond)
+	m.ObserveBulkFailure("update")
+	m.ObserveBulkFailure("update")
+	m.ObserveScrape(3*time.Second, 2, nil)
+	m.ObserveScrape(time.Second, 1, nil)
+	m.ObserveScrape(10*time.Second, 0, errors.New("connection refused"))
+	m.ObserveCheck(0, time.Second)
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %s", err)
+	}
+
+	testCases := []string{
+		`scrappy_http_request_duration_seconds_count{code="200",method="GET",route="/companies/{domain}"} 1`,
+		`scrappy_http_request_duration_seconds_count{code="404",method="GET",route="/companies/{domain}"} 1`,
+		`scrappy_es_request_duration_seconds_count{code="200",operation="doc"} 1`,
+		`scrappy_es_bulk_failures_total{action="update"} 2`,
+		`scrappy_scrape_duration_seconds_count{result="success"} 2`,
+		`scrappy_scrape_duration_seconds_count{result="error"} 1`,
+		`scrappy_scrape_phone_numbers_total 3`,
+		`scrappy_domain_check_duration_seconds_count{code="0"} 1`,
+		`go_goroutines`,
+	}
+
+	for _, expected := range testCases {
+		t.Run(expected, func(t *testing.T) {
+			if !strings.Contains(string(body), expected) {
+				t.Errorf("Expected metrics to contain %q", expected)
+			}
+		})
+	}
+}
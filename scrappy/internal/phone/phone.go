@@ -24,6 +24,8 @@ const (
 
 type Phone struct {
 	Number string
+	// URL of the page the number was found on, if known
+	Source string
 	// Depending on how we scraped the phone number,
 	// we can have more or less confidence that it is valid.
 	//
@@ -181,3 +183,51 @@ func NewFromHrefTel(tel string) *Phone {
 		Confidence: PhoneHrefTel,
 	}
 }
+
+// Number of trailing digits used to find numbers from partial inputs,
+// the subscriber part of a NANP number ("491-1000")
+const LastDigitsLength = 7
+
+// Matches an extension at the end of a number: "x123", "ext. 123", "#123"
+var phoneExtensionRegex = regexp.MustCompile(`(?i)\s*(ext\.?|extension|x|#)\s*\d+\s*$`)
+
+var nonDigitRegex = regexp.MustCompile(`\D`)
+
+// NumberForms holds the forms a phone number is indexed and searched by.
+type NumberForms struct {
+	// "+16174911000", empty for partial numbers
+	E164 string
+	// National significant number "6174911000", empty for partial numbers
+	NationalDigits string
+	// "4911000"
+	LastDigits string
+}
+
+// ParseNumberForms returns the search forms of a phone number.
+//
+// Valid numbers are parsed using the same rules as ValidatePhoneNumber,
+// extensions are ignored. Partial numbers, like "491-1000", only have
+// their last digits set, they need at least LastDigitsLength digits.
+func ParseNumberForms(number string) (*NumberForms, error) {
+	result, err := phonenumbers.Parse(number, defaultPhoneRegion)
+	if err == nil && phonenumbers.IsValidNumber(result) {
+		national := phonenumbers.GetNationalSignificantNumber(result)
+
+		return &NumberForms{
+			E164:           phonenumbers.Format(result, phonenumbers.E164),
+			NationalDigits: national,
+			LastDigits:     lastDigits(national),
+		}, nil
+	}
+
+	digits := nonDigitRegex.ReplaceAllString(phoneExtensionRegex.ReplaceAllString(number, ""), "")
+	if len(digits) < LastDigitsLength {
+		return nil, fmt.Errorf("%w: %q has less than %d digits", ErrInvalidNumber, number, LastDigitsLength)
+	}
+
+	return &NumberForms{LastDigits: lastDigits(digits)}, nil
+}
+
+func lastDigits(digits string) string {
+	return digits[max(0, len(digits)-LastDigitsLength):]
+}
@@ -204,6 +204,49 @@ func TestDedupPhoneNumbers(t *testing.T) {
 	}
 }
 
+func TestParseNumberForms(t *testing.T) {
+	testCases := []struct {
+		name     string
+		number   string
+		expected NumberForms
+	}{
+		{
+			name:     "international format",
+			number:   "+1 617-491-1000",
+			expected: NumberForms{E164: "+16174911000", NationalDigits: "6174911000", LastDigits: "4911000"},
+		},
+		{
+			name:     "national format with extension",
+			number:   "(617) 491-1000 ext. 123",
+			expected: NumberForms{E164: "+16174911000", NationalDigits: "6174911000", LastDigits: "4911000"},
+		},
+		{
+			name:     "partial number",
+			number:   "491-1000",
+			expected: NumberForms{LastDigits: "4911000"},
+		},
+		{
+			name:     "partial number with extension",
+			number:   "491.1000 x42",
+			expected: NumberForms{LastDigits: "4911000"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			forms, err := ParseNumberForms(tc.number)
+			checkNoErr(t, err)
+
+			if *forms != tc.expected {
+				t.Errorf("Expected %+v, got %+v instead", tc.expected, *forms)
+			}
+		})
+	}
+
+	_, err := ParseNumberForms("1000 x42")
+	checkErrIs(t, err, ErrInvalidNumber)
+}
+
 // Helpers
 
 func checkNoErr(t *testing.T, err error) {
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"examples/scrappy/internal/auth"
+)
+
+// Header holding the API key, keys can also be sent as an Authorization bearer token
+const apiKeyHeader = "X-API-Key"
+
+// Each remote address can fail authentication failedAuthBurst times at once,
+// then once per second, so unknown keys can't be guessed, or flood the key lookups
+const (
+	failedAuthRate  = 1
+	failedAuthBurst = 10
+)
+
+// authorize requires requests to present a key granting the scope, within the rate limit of the key.
+//
+// Every request is allowed if authentication is disabled.
+func (state *State) authorize(scope auth.Scope, next http.HandlerFunc) http.Handler {
+	if state.keys == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := remoteHost(r)
+		if allowed, wait := state.failedAuth.Check(client); !allowed {
+			err := fmt.Errorf("%w: too many failed authentications from %s", ErrRateLimited, client)
+			replyRateLimited(w, r, err, wait)
+			return
+		}
+
+		key, err := state.authenticate(r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				state.failedAuth.Take(client)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="scrappy"`)
+			}
+			replyError(w, r, err, "")
+			return
+		}
+
+		setAuditKey(r, key.Name)
+
+		if !key.Allows(scope) {
+			err = fmt.Errorf("%w: %s scope required", ErrForbidden, scope)
+			replyError(w, r, err, "")
+			return
+		}
+
+		if state.limiter != nil {
+			allowed, wait := state.limiter.Allow(key)
+			if !allowed {
+				replyRateLimited(w, r, fmt.Errorf("%w: %s", ErrRateLimited, key.Name), wait)
+				return
+			}
+		}
+
+		next(w, r)
+	})
+}
+
+// authenticate looks up the key sent with the request.
+func (state *State) authenticate(r *http.Request) (*auth.APIKey, error) {
+	key := strings.TrimSpace(r.Header.Get(apiKeyHeader))
+	if key == "" {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			key = strings.TrimSpace(token)
+		}
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("%w: missing API key", ErrUnauthorized)
+	}
+
+	apiKey, err := state.keys.LookupKey(r.Context(), auth.HashKey(key))
+	if errors.Is(err, auth.ErrUnknownKey) {
+		return nil, fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+// replyRateLimited replies with the error, and the seconds to wait before retrying.
+func replyRateLimited(w http.ResponseWriter, r *http.Request, err error, wait time.Duration) {
+	retryAfter := int(math.Max(1, math.Ceil(wait.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	replyError(w, r, err, fmt.Sprintf("rate limit exceeded, retry after %d seconds", retryAfter))
+}
+
+// remoteHost returns the address of the client, without its port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/auth"
+	"examples/scrappy/internal/es"
+)
+
+func TestAuthorize(t *testing.T) {
+	keyring, err := auth.NewKeyring([]auth.APIKey{
+		{Name: "reports", Hash: auth.HashKey("scrappy_reports"), Scopes: []auth.Scope{auth.ScopeRead}},
+		{Name: "limited", Hash: auth.HashKey("scrappy_limited"), Scopes: []auth.Scope{auth.ScopeRead}, RateLimit: 1, Burst: 1},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	companyStore := &testStore{getCompany: func(ctx context.Context, url string) (*es.Company, error) {
+		return testCompany(), nil
+	}}
+
+	type request struct {
+		path   string
+		header string
+		value  string
+	}
+	var guesses []request
+	for index := 0; index < failedAuthBurst; index++ {
+		guess := fmt.Sprintf("scrappy_guess_%d", index)
+		guesses = append(guesses, request{path: "/companies/mazautoglass.com", header: apiKeyHeader, value: guess})
+	}
+
+	testCases := []struct {
+		name     string
+		requests []request
+		// Expected response to the last request
+		expectedStatus          int
+		expectedCode            string
+		expectedWWWAuthenticate string
+		expectedRetryAfter      string
+	}{
+		{
+			name:           "API key header",
+			requests:       []request{{path: "/companies/mazautoglass.com", header: apiKeyHeader, value: "scrappy_reports"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "bearer token",
+			requests:       []request{{path: "/companies/mazautoglass.com", header: "Authorization", value: "Bearer scrappy_reports"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:                    "missing key",
+			requests:                []request{{path: "/companies/mazautoglass.com"}},
+			expectedStatus:          http.StatusUnauthorized,
+			expectedCode:            codeUnauthorized,
+			expectedWWWAuthenticate: `Bearer realm="scrappy"`,
+		},
+		{
+			name:                    "unknown key",
+			requests:                []request{{path: "/companies/mazautoglass.com", header: apiKeyHeader, value: "scrappy_unknown"}},
+			expectedStatus:          http.StatusUnauthorized,
+			expectedCode:            codeUnauthorized,
+			expectedWWWAuthenticate: `Bearer realm="scrappy"`,
+		},
+		{
+			name:           "missing scope",
+			requests:       []request{{path: "/stats", header: apiKeyHeader, value: "scrappy_reports"}},
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   codeForbidden,
+		},
+		{
+			name: "key rate limit",
+			requests: []request{
+				{path: "/companies/mazautoglass.com", header: apiKeyHeader, value: "scrappy_limited"},
+				{path: "/companies/mazautoglass.com", header: apiKeyHeader, value: "scrappy_limited"},
+			},
+			expectedStatus:     http.StatusTooManyRequests,
+			expectedCode:       codeRateLimited,
+			expectedRetryAfter: "1",
+		},
+		{
+			// Valid keys are refused too, once the client failed too many times
+			name:               "failed authentications",
+			requests:           append(guesses, request{path: "/companies/mazautoglass.com", header: apiKeyHeader, value: "scrappy_reports"}),
+			expectedStatus:     http.StatusTooManyRequests,
+			expectedCode:       codeRateLimited,
+			expectedRetryAfter: "1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer("", time.Second, companyStore, &Options{
+				Keys:        keyring,
+				RateLimiter: auth.NewRateLimiter(0, 0),
+			})
+
+			var recorder *httptest.ResponseRecorder
+			var body errorBody
+			for _, req := range tc.requests {
+				r := httptest.NewRequest(http.MethodGet, req.path, nil)
+				if req.header != "" {
+					r.Header.Set(req.header, req.value)
+				}
+				recorder, body = serveTestRequest(t, server.Handler, r)
+			}
+
+			if recorder.Code != tc.expectedStatus || body.Code != tc.expectedCode {
+				t.Errorf("Expected %d %q, got %d %q", tc.expectedStatus, tc.expectedCode, recorder.Code, body.Code)
+			}
+			if header := recorder.Header().Get("WWW-Authenticate"); header != tc.expectedWWWAuthenticate {
+				t.Errorf("Expected WWW-Authenticate %q, got %q", tc.expectedWWWAuthenticate, header)
+			}
+			if header := recorder.Header().Get("Retry-After"); header != tc.expectedRetryAfter {
+				t.Errorf("Expected Retry-After %q, got %q", tc.expectedRetryAfter, header)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/store"
+)
+
+// Maximum size of a batch match request body
+const maxBatchBodyBytes = 10 * 1024 * 1024
+
+// Maximum number of records matched by a single batch request
+const maxBatchRecords = 10000
+
+// batchMatchRequest is the JSON body of a batch match request.
+type batchMatchRequest struct {
+	Records []es.MatchQuery `json:"records"`
+	// Signal weights applied to every record, es.DefaultMatchWeights if missing
+	Weights *es.MatchWeights `json:"weights"`
+	// Minimum score of the best candidate for a record to match
+	MinScore float64 `json:"min_score"`
+}
+
+// batchMatchResponse is the JSON body of a batch match response.
+type batchMatchResponse struct {
+	Results []csv.MatchOutcome `json:"results"`
+	Summary csv.MatchSummary   `json:"summary"`
+}
+
+// matchCompaniesHandler matches a batch of partial company records.
+//
+// Records are posted either as a CSV file (Content-Type: text/csv),
+// answered with the same CSV, with the match columns appended,
+// or as a JSON batchMatchRequest, answered with a batchMatchResponse.
+func matchCompaniesHandler(state *State) http.HandlerFunc {
+	companyStore := state.store
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only POST HTTP method allowed
+		if r.Method != http.MethodPost {
+			replyError(w, r, ErrMethodNotSupported, "")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "text/csv" {
+			matchCSVBatch(companyStore, w, r)
+			return
+		}
+
+		weights := es.DefaultMatchWeights()
+		request := batchMatchRequest{Weights: &weights}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err == nil {
+			err = checkBatchSize(len(request.Records))
+		}
+		if err != nil {
+			replyError(w, r, invalidBody(err), "invalid batch match request")
+			return
+		}
+
+		// Only the best candidate of each record is returned
+		for index := range request.Records {
+			request.Records[index].Weights = request.Weights
+			request.Records[index].Limit = 1
+		}
+
+		results := companyStore.MatchCompanies(r.Context(), request.Records, nil)
+		outcomes := batchOutcomes(results, request.MinScore)
+
+		replyJSONContent(http.StatusOK, w, r, batchMatchResponse{
+			Results: outcomes,
+			Summary: csv.NewMatchSummary(outcomes),
+		})
+	}
+}
+
+// matchCSVBatch matches the records of a posted CSV file, using the default weights.
+//
+// Invalid lines, e.g. records without any signal, are answered with an error outcome,
+// while the other lines are still matched.
+// The minimum score is read from the min_score query parameter,
+// the match summary is returned in the X-Match-* headers.
+func matchCSVBatch(companyStore store.CompanyStore, w http.ResponseWriter, r *http.Request) {
+	minScore := 0.0
+	if value := r.URL.Query().Get("min_score"); value != "" {
+		var err error
+		minScore, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			err = fmt.Errorf("%w: invalid min_score %q", ErrInvalidRequest, value)
+			replyError(w, r, err, "invalid batch match request")
+			return
+		}
+	}
+
+	records, err := csv.ParseMatchRecordsCSV(r.Body)
+
+	// Invalid lines can only be answered once the header is known
+	var invalidLines csv.ErrInvalidCSVLines
+	if errors.As(err, &invalidLines) && records != nil && records.Header != nil {
+		err = nil
+	}
+	if err == nil {
+		err = checkBatchSize(len(records.Records) + len(invalidLines))
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %s%s", ErrInvalidRequest, err, firstInvalidLine(err))
+		replyError(w, r, err, "invalid batch match CSV")
+		return
+	}
+
+	weights := es.DefaultMatchWeights()
+	matches := make([]es.MatchQuery, 0, len(records.Records))
+	for index := range records.Records {
+		matches = append(matches, es.NewMatchQuery(&records.Records[index], &weights))
+	}
+
+	results := companyStore.MatchCompanies(r.Context(), matches, nil)
+	rows, outcomes := records.WithInvalidLines(batchOutcomes(results, minScore), invalidLines)
+	summary := csv.NewMatchSummary(outcomes)
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("X-Match-Total", strconv.Itoa(summary.Total))
+	w.Header().Set("X-Match-Matched", strconv.Itoa(summary.Matched))
+	w.Header().Set("X-Match-Rate", strconv.FormatFloat(summary.MatchRate, 'f', 1, 64))
+	w.WriteHeader(http.StatusOK)
+
+	err = csv.WriteMatchResultsCSV(w, records.Header, rows, outcomes)
+	logErr(err)
+}
+
+func batchOutcomes(results []es.BatchMatchResult, minScore float64) []csv.MatchOutcome {
+	outcomes := make([]csv.MatchOutcome, 0, len(results))
+	for index := range results {
+		outcomes = append(outcomes, results[index].Outcome(minScore))
+	}
+
+	return outcomes
+}
+
+func checkBatchSize(numRecords int) error {
+	if numRecords == 0 {
+		return errors.New("no records")
+	}
+
+	if numRecords > maxBatchRecords {
+		return fmt.Errorf("%d records, at most %d are allowed", numRecords, maxBatchRecords)
+	}
+
+	return nil
+}
+
+func firstInvalidLine(err error) string {
+	var invalidLines csv.ErrInvalidCSVLines
+	if !errors.As(err, &invalidLines) || len(invalidLines) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(", first on line %d: %s", invalidLines[0].LineNumber, invalidLines[0].Err)
+}
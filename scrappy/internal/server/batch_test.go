@@ -0,0 +1,130 @@
+package server
+
+import (
+	encodingcsv "encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/store"
+)
+
+func TestMatchCSVBatch(t *testing.T) {
+	companyStore := store.NewMemoryStore()
+	_, err := companyStore.BulkIndexCompanies([]csv.Company{{
+		Domain:         csv.JSONUrl{URL: &url.URL{Scheme: "https", Host: "mazautoglass.com"}},
+		CommercialName: "MAZ Auto Glass",
+	}}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	server := NewServer("", time.Second, companyStore, nil)
+
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedCode   string
+		// Status of each answered line, and the columns of invalid lines
+		expectedMatches []string
+		expectedRows    map[int][]string
+		expectedTotal   string
+	}{
+		{
+			// Invalid lines don't prevent matching the other ones
+			name: "invalid lines",
+			body: "name,phone,website,notes\n" +
+				"MAZ Auto Glass,,,\n" +
+				",,,no signal\n" +
+				"Bakery,,,\n" +
+				"too,many,fields,in,line\n",
+			expectedStatus:  http.StatusOK,
+			expectedMatches: []string{csv.MatchStatusMatch, csv.MatchStatusError, csv.MatchStatusNoMatch, csv.MatchStatusError},
+			expectedRows: map[int][]string{
+				2: {"", "", "", "no signal"},
+				4: {"too", "many", "fields", "in"},
+			},
+			expectedTotal: "4",
+		},
+		{
+			name:            "only invalid lines",
+			body:            "name,notes\n,no signal\n",
+			expectedStatus:  http.StatusOK,
+			expectedMatches: []string{csv.MatchStatusError},
+			expectedTotal:   "1",
+		},
+		{
+			name:           "missing match columns",
+			body:           "notes\nno signal\n",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+		},
+		{
+			name:           "empty",
+			body:           "name\n",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/companies/match/batch", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", "text/csv")
+			recorder, body := serveTestRequest(t, server.Handler, r)
+
+			if recorder.Code != tc.expectedStatus || body.Code != tc.expectedCode {
+				t.Fatalf("Expected %d %q, got %d %q: %s", tc.expectedStatus, tc.expectedCode,
+					recorder.Code, body.Code, recorder.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if total := recorder.Header().Get("X-Match-Total"); total != tc.expectedTotal {
+				t.Errorf("Expected %s records in total, got %s", tc.expectedTotal, total)
+			}
+
+			reader := encodingcsv.NewReader(recorder.Body)
+			lines, err := reader.ReadAll()
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			header := lines[0]
+			statusColumn := indexOf(header, "match_status")
+			errorColumn := indexOf(header, "match_error")
+
+			var statuses []string
+			for index, line := range lines[1:] {
+				statuses = append(statuses, line[statusColumn])
+
+				if line[statusColumn] == csv.MatchStatusError && line[errorColumn] == "" {
+					t.Errorf("Expected an error for line %d", index+1)
+				}
+				if expected, found := tc.expectedRows[index+1]; found && !reflect.DeepEqual(line[:len(expected)], expected) {
+					t.Errorf("Expected line %d columns %v, got %v", index+1, expected, line[:len(expected)])
+				}
+			}
+			if !reflect.DeepEqual(statuses, tc.expectedMatches) {
+				t.Errorf("Expected statuses %v, got %v", tc.expectedMatches, statuses)
+			}
+		})
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for index := range values {
+		if values[index] == value {
+			return index
+		}
+	}
+
+	return -1
+}
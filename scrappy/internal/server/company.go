@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"examples/scrappy/internal/es"
+)
+
+// companyHandler serves the routes below /companies/{domain}.
+//
+// The domain is either a bare host, or a full URL, e.g. /companies/https://mazautoglass.com/history.
+func companyHandler(state *State) http.HandlerFunc {
+	detail := companyDetailHandler(state)
+	history := companyHistoryHandler(state)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, route := splitCompanyPath(strings.TrimPrefix(r.URL.Path, "/companies/"))
+		if domain == "" {
+			replyError(w, r, ErrNotFound, "")
+			return
+		}
+
+		switch route {
+		case "":
+			detail(w, r, domain)
+		case "history":
+			history(w, r, domain)
+		default:
+			replyError(w, r, ErrNotFound, "")
+		}
+	}
+}
+
+// splitCompanyPath splits the path below /companies/ into the company domain and the route below it.
+//
+// The mux cleans request paths, so the "//" of a full URL domain is received as a single slash.
+func splitCompanyPath(path string) (domain string, route string) {
+	domain, route, _ = strings.Cut(path, "/")
+
+	if domain == "http:" || domain == "https:" {
+		host, rest, _ := strings.Cut(route, "/")
+		if host == "" {
+			return "", ""
+		}
+		domain, route = domain+"//"+host, rest
+	}
+
+	return domain, route
+}
+
+func companyDetailHandler(state *State) func(w http.ResponseWriter, r *http.Request, domain string) {
+	companyStore := state.store
+
+	return func(w http.ResponseWriter, r *http.Request, domain string) {
+		// Only GET HTTP method allowed
+		if r.Method != http.MethodGet {
+			replyError(w, r, ErrMethodNotSupported, "")
+			return
+		}
+
+		company, err := companyStore.GetCompany(r.Context(), domain)
+		if errors.Is(err, es.ErrNotFound) {
+			replyError(w, r, err, fmt.Sprintf("company %q not found", domain))
+			return
+		}
+		if err != nil {
+			replyError(w, r, err, "failed to get company")
+			return
+		}
+
+		body, err := json.Marshal(company)
+		if err != nil {
+			err = fmt.Errorf("failed to serialize content %w", err)
+			replyError(w, r, err, "")
+			return
+		}
+
+		etag := companyETag(company, body)
+		w.Header().Set("ETag", etag)
+		// Clients may cache the document, but must revalidate it
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(body)
+		logErr(err)
+	}
+}
+
+// companyETag derives the entity tag of a company from the revision of its document,
+// changing on every write, or from the response body for stores not tracking revisions.
+//
+// The index is part of the tag, since sequence numbers start over once reindexed.
+func companyETag(company *es.Company, body []byte) string {
+	if company.Version != nil {
+		version := company.Version
+		return fmt.Sprintf(`"%s-%d-%d"`, version.Index, version.PrimaryTerm, version.SeqNo)
+	}
+
+	digest := sha256.Sum256(body)
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(digest[:16]))
+}
+
+// etagMatches checks the If-None-Match header value against the current entity tag,
+// using the weak comparison required for conditional GET requests.
+//
+// https://www.rfc-editor.org/rfc/rfc9110#name-if-none-match
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/es"
+)
+
+func TestSplitCompanyPath(t *testing.T) {
+	testCases := []struct {
+		path           string
+		expectedDomain string
+		expectedRoute  string
+	}{
+		{path: "mazautoglass.com", expectedDomain: "mazautoglass.com"},
+		{path: "mazautoglass.com/", expectedDomain: "mazautoglass.com"},
+		{path: "mazautoglass.com/history", expectedDomain: "mazautoglass.com", expectedRoute: "history"},
+		{path: "mazautoglass.com/history/extra", expectedDomain: "mazautoglass.com", expectedRoute: "history/extra"},
+		// The mux cleans the "//" of full URLs
+		{path: "https:/mazautoglass.com", expectedDomain: "https://mazautoglass.com"},
+		{path: "http:/mazautoglass.com/history", expectedDomain: "http://mazautoglass.com", expectedRoute: "history"},
+		{path: "https:/", expectedDomain: ""},
+		{path: "https:", expectedDomain: ""},
+		{path: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			domain, route := splitCompanyPath(tc.path)
+			if domain != tc.expectedDomain || route != tc.expectedRoute {
+				t.Errorf("Expected %q, %q, got %q, %q", tc.expectedDomain, tc.expectedRoute, domain, route)
+			}
+		})
+	}
+}
+
+func TestCompanyETag(t *testing.T) {
+	testCases := []struct {
+		name     string
+		version  *es.DocumentVersion
+		body     string
+		expected string
+	}{
+		{
+			name:     "document version",
+			version:  &es.DocumentVersion{Index: "companies_v2", PrimaryTerm: 1, SeqNo: 42},
+			expected: `"companies_v2-1-42"`,
+		},
+		{
+			// Sequence numbers start over in a new index
+			name:     "reindexed document",
+			version:  &es.DocumentVersion{Index: "companies_v3", PrimaryTerm: 1, SeqNo: 42},
+			expected: `"companies_v3-1-42"`,
+		},
+		{
+			name:     "body digest",
+			body:     `{"id":"mazautoglass.com"}`,
+			expected: `"295c522442fb8802bb60cbb03b2c5ee6"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			company := testCompany()
+			company.Version = tc.version
+
+			etag := companyETag(company, []byte(tc.body))
+			if etag != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, etag)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	testCases := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{ifNoneMatch: `"companies_v2-1-42"`, expected: true},
+		{ifNoneMatch: `W/"companies_v2-1-42"`, expected: true},
+		{ifNoneMatch: `"companies_v2-1-41", "companies_v2-1-42"`, expected: true},
+		{ifNoneMatch: ` * `, expected: true},
+		{ifNoneMatch: ``},
+		{ifNoneMatch: `"companies_v2-1-41"`},
+		{ifNoneMatch: `"companies_v3-1-42"`},
+		{ifNoneMatch: `companies_v2-1-42`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ifNoneMatch, func(t *testing.T) {
+			if etagMatches(tc.ifNoneMatch, `"companies_v2-1-42"`) != tc.expected {
+				t.Errorf("Expected match to be %t", tc.expected)
+			}
+		})
+	}
+}
+
+func TestCompanyConditionalGet(t *testing.T) {
+	companyStore := &testStore{getCompany: func(ctx context.Context, url string) (*es.Company, error) {
+		company := testCompany()
+		company.Version = &es.DocumentVersion{Index: "companies_v2", PrimaryTerm: 1, SeqNo: 42}
+		return company, nil
+	}}
+	server := NewServer("", time.Second, companyStore, nil)
+
+	testCases := []struct {
+		name           string
+		ifNoneMatch    string
+		expectedStatus int
+	}{
+		{name: "unconditional", expectedStatus: http.StatusOK},
+		{name: "current", ifNoneMatch: `"companies_v2-1-42"`, expectedStatus: http.StatusNotModified},
+		{name: "outdated", ifNoneMatch: `"companies_v2-1-41"`, expectedStatus: http.StatusOK},
+		{name: "other index", ifNoneMatch: `"companies_v1-1-42"`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/companies/mazautoglass.com", nil)
+			if tc.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			recorder, _ := serveTestRequest(t, server.Handler, r)
+
+			if recorder.Code != tc.expectedStatus {
+				t.Errorf("Expected %d, got %d", tc.expectedStatus, recorder.Code)
+			}
+			if etag := recorder.Header().Get("ETag"); etag != `"companies_v2-1-42"` {
+				t.Errorf("Expected the current ETag, got %s", etag)
+			}
+			if tc.expectedStatus == http.StatusNotModified && recorder.Body.Len() != 0 {
+				t.Errorf("Expected no body, got %q", recorder.Body.String())
+			}
+		})
+	}
+}
@@ -1,9 +1,109 @@
 package server
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/phone"
+)
 
 var (
 	ErrNotFound           = errors.New("not found")
 	ErrInvalidRequest     = errors.New("invalid request")
+	ErrRequestTooLarge    = errors.New("request too large")
 	ErrMethodNotSupported = errors.New("method not supported")
+	ErrNotImplemented     = errors.New("not implemented")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrNotReady           = errors.New("not ready")
+)
+
+// Codes of the JSON error responses, documented in the README
+const (
+	codeInvalidRequest     = "invalid_request"
+	codeInvalidPhoneNumber = "invalid_phone_number"
+	codeInvalidURL         = "invalid_url"
+	codeInvalidCSV         = "invalid_csv"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "not_found"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeRequestTooLarge    = "request_too_large"
+	codeRateLimited        = "rate_limited"
+	codeNotImplemented     = "not_implemented"
+	codeNotReady           = "not_ready"
+	codeStoreUnavailable   = "store_unavailable"
+	codeStoreTimeout       = "store_timeout"
+	codeStoreError         = "store_error"
+	codeInternalError      = "internal_error"
 )
+
+// errorStatuses maps errors to the status and code of their response, checked in order.
+var errorStatuses = []struct {
+	errs   []error
+	status int
+	code   string
+}{
+	{errs: []error{ErrUnauthorized}, status: http.StatusUnauthorized, code: codeUnauthorized},
+	{errs: []error{ErrForbidden}, status: http.StatusForbidden, code: codeForbidden},
+	{errs: []error{ErrRateLimited}, status: http.StatusTooManyRequests, code: codeRateLimited},
+	{errs: []error{ErrMethodNotSupported}, status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+	{errs: []error{ErrRequestTooLarge}, status: http.StatusRequestEntityTooLarge, code: codeRequestTooLarge},
+	{errs: []error{phone.ErrInvalidNumber}, status: http.StatusBadRequest, code: codeInvalidPhoneNumber},
+	{
+		errs:   []error{csv.ErrInvalidURL, csv.ErrMissingURLHost, csv.ErrInvalidURLScheme, csv.ErrInvalidDomain},
+		status: http.StatusBadRequest,
+		code:   codeInvalidURL,
+	},
+	{
+		errs: []error{
+			csv.ErrInvalidCSVHeader,
+			csv.ErrEmptyCSV,
+			csv.ErrParseCSV,
+			csv.ErrWrongNumberOfFields,
+			csv.ErrInvalidSchema,
+		},
+		status: http.StatusBadRequest,
+		code:   codeInvalidCSV,
+	},
+	{
+		errs:   []error{ErrInvalidRequest, es.ErrInvalidParams, csv.ErrMissingMatchFields},
+		status: http.StatusBadRequest,
+		code:   codeInvalidRequest,
+	},
+	{errs: []error{ErrNotFound, es.ErrNotFound}, status: http.StatusNotFound, code: codeNotFound},
+	{errs: []error{ErrNotImplemented}, status: http.StatusNotImplemented, code: codeNotImplemented},
+	{errs: []error{ErrNotReady}, status: http.StatusServiceUnavailable, code: codeNotReady},
+	// Timeouts are checked before other store errors, since they wrap the context error
+	{errs: []error{context.DeadlineExceeded}, status: http.StatusGatewayTimeout, code: codeStoreTimeout},
+	{errs: []error{es.ErrUnavailable, es.ErrConnection}, status: http.StatusBadGateway, code: codeStoreUnavailable},
+	{
+		errs:   []error{es.ErrFailedRequest, es.ErrSearchResult, es.ErrUnexpectedResponse, es.ErrInvalidIndex},
+		status: http.StatusBadGateway,
+		code:   codeStoreError,
+	},
+}
+
+// errorStatus returns the status and code of the error response,
+// errors matching none of errorStatuses are internal errors.
+func errorStatus(err error) (int, string) {
+	for _, entry := range errorStatuses {
+		for _, target := range entry.errs {
+			if errors.Is(err, target) {
+				return entry.status, entry.code
+			}
+		}
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return http.StatusGatewayTimeout, codeStoreTimeout
+	}
+
+	return http.StatusInternalServerError, codeInternalError
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/phone"
+	"examples/scrappy/internal/store"
+)
+
+// timeoutError is a network timeout, as returned by the HTTP client of the ES store.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// unavailableTimeout is a request to the store which timed out,
+// matching both es.ErrUnavailable and context.DeadlineExceeded like the es request errors.
+type unavailableTimeout struct{}
+
+func (unavailableTimeout) Error() string { return "ES unavailable: context deadline exceeded" }
+
+func (unavailableTimeout) Is(target error) bool {
+	return target == es.ErrUnavailable || target == context.DeadlineExceeded
+}
+
+func TestErrorStatus(t *testing.T) {
+	testCases := []struct {
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{err: ErrUnauthorized, expectedStatus: http.StatusUnauthorized, expectedCode: codeUnauthorized},
+		{err: ErrForbidden, expectedStatus: http.StatusForbidden, expectedCode: codeForbidden},
+		{err: ErrRateLimited, expectedStatus: http.StatusTooManyRequests, expectedCode: codeRateLimited},
+		{err: ErrMethodNotSupported, expectedStatus: http.StatusMethodNotAllowed, expectedCode: codeMethodNotAllowed},
+		{err: ErrRequestTooLarge, expectedStatus: http.StatusRequestEntityTooLarge, expectedCode: codeRequestTooLarge},
+		{err: phone.ErrInvalidNumber, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidPhoneNumber},
+		{err: csv.ErrInvalidURL, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidURL},
+		{err: csv.ErrMissingURLHost, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidURL},
+		{err: csv.ErrInvalidURLScheme, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidURL},
+		{err: csv.ErrInvalidDomain, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidURL},
+		{err: csv.ErrInvalidCSVHeader, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidCSV},
+		{err: csv.ErrEmptyCSV, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidCSV},
+		{err: csv.ErrParseCSV, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidCSV},
+		{err: csv.ErrWrongNumberOfFields, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidCSV},
+		{err: csv.ErrInvalidSchema, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidCSV},
+		{err: ErrInvalidRequest, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidRequest},
+		{err: es.ErrInvalidParams, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidRequest},
+		{err: csv.ErrMissingMatchFields, expectedStatus: http.StatusBadRequest, expectedCode: codeInvalidRequest},
+		{err: ErrNotFound, expectedStatus: http.StatusNotFound, expectedCode: codeNotFound},
+		{err: es.ErrNotFound, expectedStatus: http.StatusNotFound, expectedCode: codeNotFound},
+		{err: ErrNotImplemented, expectedStatus: http.StatusNotImplemented, expectedCode: codeNotImplemented},
+		{err: ErrNotReady, expectedStatus: http.StatusServiceUnavailable, expectedCode: codeNotReady},
+		{err: context.DeadlineExceeded, expectedStatus: http.StatusGatewayTimeout, expectedCode: codeStoreTimeout},
+		{err: es.ErrUnavailable, expectedStatus: http.StatusBadGateway, expectedCode: codeStoreUnavailable},
+		{err: es.ErrConnection, expectedStatus: http.StatusBadGateway, expectedCode: codeStoreUnavailable},
+		{err: es.ErrFailedRequest, expectedStatus: http.StatusBadGateway, expectedCode: codeStoreError},
+		{err: es.ErrSearchResult, expectedStatus: http.StatusBadGateway, expectedCode: codeStoreError},
+		{err: es.ErrUnexpectedResponse, expectedStatus: http.StatusBadGateway, expectedCode: codeStoreError},
+		{err: es.ErrInvalidIndex, expectedStatus: http.StatusBadGateway, expectedCode: codeStoreError},
+		// Wrapped errors, and errors matching several entries, use the first matching entry
+		{err: fmt.Errorf("%w: company %q", es.ErrNotFound, "acme.com"), expectedStatus: http.StatusNotFound, expectedCode: codeNotFound},
+		{err: unavailableTimeout{}, expectedStatus: http.StatusGatewayTimeout, expectedCode: codeStoreTimeout},
+		{err: fmt.Errorf("search: %w", timeoutError{}), expectedStatus: http.StatusGatewayTimeout, expectedCode: codeStoreTimeout},
+		{err: errors.New("unexpected"), expectedStatus: http.StatusInternalServerError, expectedCode: codeInternalError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			status, code := errorStatus(tc.err)
+			if status != tc.expectedStatus || code != tc.expectedCode {
+				t.Errorf("Expected %d %q, got %d %q", tc.expectedStatus, tc.expectedCode, status, code)
+			}
+
+			// Every entry of the README table is answered with the matching envelope
+			r := httptest.NewRequest(http.MethodGet, "/companies", nil)
+			recorder, body := serveTestRequest(t, withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				replyError(w, r, tc.err, "")
+			})), r)
+
+			if recorder.Code != tc.expectedStatus || body.Code != tc.expectedCode {
+				t.Errorf("Expected response %d %q, got %d %q", tc.expectedStatus, tc.expectedCode, recorder.Code, body.Code)
+			}
+			if body.Message != http.StatusText(tc.expectedStatus) {
+				t.Errorf("Expected the status text as default message, got %q", body.Message)
+			}
+		})
+	}
+}
+
+func TestValidationErrorCodes(t *testing.T) {
+	server := NewServer("", time.Second, store.NewMemoryStore(), nil)
+
+	testCases := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		expectedCode string
+	}{
+		{name: "search phone", method: http.MethodGet, target: "/companies?phone=1000", expectedCode: codeInvalidPhoneNumber},
+		{name: "match phone", method: http.MethodPost, target: "/companies/match", body: `{"phone": "1000"}`, expectedCode: codeInvalidPhoneNumber},
+		{name: "match website", method: http.MethodPost, target: "/companies/match", body: `{"website": "ftp://acme.com"}`, expectedCode: codeInvalidURL},
+		{name: "company domain", method: http.MethodGet, target: "/companies/localhost", expectedCode: codeInvalidURL},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			recorder, body := serveTestRequest(t, server.Handler, r)
+
+			if recorder.Code != http.StatusBadRequest || body.Code != tc.expectedCode {
+				t.Errorf("Expected 400 %q, got %d %q: %s", tc.expectedCode, recorder.Code, body.Code, body.Details)
+			}
+		})
+	}
+}
+
+func TestReplyError(t *testing.T) {
+	testCases := []struct {
+		name            string
+		err             error
+		message         string
+		requestID       string
+		expectedMessage string
+		expectedDetails string
+		// The request ID set by the client is echoed, otherwise one is generated
+		expectedRequestID string
+	}{
+		{
+			name:              "client error",
+			err:               fmt.Errorf("%w: must provide either query or phone number", es.ErrInvalidParams),
+			message:           "failed company search",
+			requestID:         "client-request-1",
+			expectedMessage:   "failed company search",
+			expectedDetails:   "invalid params: must provide either query or phone number",
+			expectedRequestID: "client-request-1",
+		},
+		{
+			name:            "server error details are hidden",
+			err:             fmt.Errorf("%w: index_not_found_exception", es.ErrFailedRequest),
+			message:         "failed company search",
+			expectedMessage: "failed company search",
+		},
+		{
+			name:            "invalid client request ID",
+			err:             ErrNotFound,
+			requestID:       "line\nbreak",
+			expectedMessage: "Not Found",
+			expectedDetails: "not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				replyError(w, r, tc.err, tc.message)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/companies", nil)
+			if tc.requestID != "" {
+				r.Header.Set(requestIDHeader, tc.requestID)
+			}
+			recorder, body := serveTestRequest(t, handler, r)
+
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected a JSON response, got %q", contentType)
+			}
+			if body.Message != tc.expectedMessage || body.Details != tc.expectedDetails {
+				t.Errorf("Expected message %q and details %q, got %q and %q",
+					tc.expectedMessage, tc.expectedDetails, body.Message, body.Details)
+			}
+			if strings.Contains(recorder.Body.String(), `"details"`) != (tc.expectedDetails != "") {
+				t.Errorf("Expected details only for client errors, got %s", recorder.Body.String())
+			}
+
+			headerID := recorder.Header().Get(requestIDHeader)
+			if body.RequestID == "" || body.RequestID != headerID {
+				t.Errorf("Expected the request ID in the body and header, got %q and %q", body.RequestID, headerID)
+			}
+			if tc.expectedRequestID != "" && body.RequestID != tc.expectedRequestID {
+				t.Errorf("Expected request ID %q, got %q", tc.expectedRequestID, body.RequestID)
+			}
+			if tc.expectedRequestID == "" && body.RequestID == tc.requestID {
+				t.Errorf("Expected invalid request ID %q to be replaced", tc.requestID)
+			}
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	testCases := []struct {
+		id       string
+		expected bool
+	}{
+		{id: "4f6c2a0e9b1d4c7a8e3f5b2d1c0a9e8f", expected: true},
+		{id: "client-request_1.2:3", expected: true},
+		{id: ""},
+		{id: "with space"},
+		{id: "line\nbreak"},
+		{id: "unicode-é"},
+		{id: strings.Repeat("a", maxRequestIDLength), expected: true},
+		{id: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.id, func(t *testing.T) {
+			if validRequestID(tc.id) != tc.expected {
+				t.Errorf("Expected valid to be %t for %q", tc.expected, tc.id)
+			}
+		})
+	}
+
+	if id := newRequestID(); !validRequestID(id) || len(id) != 32 {
+		t.Errorf("Expected a valid 32 hex digits generated ID, got %q", id)
+	}
+}
@@ -2,18 +2,23 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+
+	"examples/scrappy/internal/es"
 )
 
 func companiesHandler(state *State) http.HandlerFunc {
-	client := state.client
+	companyStore := state.store
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Only GET HTTP method allowed
 		if r.Method != http.MethodGet {
-			replyError(http.StatusMethodNotAllowed, w, r, ErrMethodNotSupported, "")
+			replyError(w, r, ErrMethodNotSupported, "")
 			return
 		}
 
@@ -22,15 +27,21 @@ func companiesHandler(state *State) http.HandlerFunc {
 		query := queryParams.Get("q")
 		phone := queryParams.Get("phone")
 
+		options, err := searchOptions(queryParams)
+		if err != nil {
+			replyError(w, r, err, "invalid search parameters")
+			return
+		}
+
 		// Search results
-		results, err := client.SearchCompany(r.Context(), query, phone)
+		results, err := companyStore.SearchCompany(r.Context(), query, phone, options)
 		if err != nil {
-			replyError(http.StatusInternalServerError, w, r, err, "failed company search")
+			replyError(w, r, err, "failed company search")
 			return
 		}
 
 		if results.Total == 0 {
-			replyError(http.StatusNotFound, w, r, ErrNotFound, "companies not found")
+			replyError(w, r, ErrNotFound, "companies not found")
 			return
 		}
 
@@ -38,14 +49,83 @@ func companiesHandler(state *State) http.HandlerFunc {
 	}
 }
 
+// Maximum size of a match request body
+const maxMatchBodyBytes = 64 * 1024
+
+func matchCompanyHandler(state *State) http.HandlerFunc {
+	companyStore := state.store
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only POST HTTP method allowed
+		if r.Method != http.MethodPost {
+			replyError(w, r, ErrMethodNotSupported, "")
+			return
+		}
+
+		// Decode partial company record,
+		// weights missing from the request keep their default value
+		weights := es.DefaultMatchWeights()
+		match := es.MatchQuery{Weights: &weights}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMatchBodyBytes))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&match)
+		if err != nil {
+			replyError(w, r, invalidBody(err), "invalid match request")
+			return
+		}
+
+		result, err := companyStore.MatchCompany(r.Context(), &match)
+		if err != nil {
+			replyError(w, r, err, "failed company match")
+			return
+		}
+
+		replyJSONContent(http.StatusOK, w, r, result)
+	}
+}
+
 // Helpers
 
+// invalidBody wraps an error reading or decoding the request body,
+// bodies over the size limit are reported as too large.
+func invalidBody(err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return fmt.Errorf("%w: body exceeds %d bytes", ErrRequestTooLarge, maxBytesError.Limit)
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+}
+
+// searchOptions parses the limit, cursor and explain query parameters.
+func searchOptions(queryParams url.Values) (*es.SearchOptions, error) {
+	options := es.SearchOptions{Cursor: queryParams.Get("cursor")}
+
+	if limit := queryParams.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid limit %q", ErrInvalidRequest, limit)
+		}
+		options.Limit = value
+	}
+
+	if explain := queryParams.Get("explain"); explain != "" {
+		value, err := strconv.ParseBool(explain)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid explain %q", ErrInvalidRequest, explain)
+		}
+		options.Explain = value
+	}
+
+	return &options, nil
+}
+
 func replyJSONContent(status int, w http.ResponseWriter, r *http.Request, content any) {
 	// Serialize content as JSON
 	body, err := json.Marshal(content)
 	if err != nil {
 		err = fmt.Errorf("failed to serialize content %w", err)
-		replyError(http.StatusInternalServerError, w, r, err, "")
+		replyError(w, r, err, "")
 		return
 	}
 
@@ -56,15 +136,38 @@ func replyJSONContent(status int, w http.ResponseWriter, r *http.Request, conten
 	logErr(err)
 }
 
-func replyError(status int, w http.ResponseWriter, r *http.Request, err error, extraText string) {
-	log.Printf("%s %s: Error: %d %s\n", r.URL, r.Method, status, err)
+// errorResponse is the JSON body of error responses.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	// Stable identifier of the error, e.g. invalid_request
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Reason of client errors, server errors are only logged
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// replyError replies with a JSON error, the status and code are derived from the error, see errorStatus.
+//
+// The message describes the failed operation, the status text is used if empty.
+func replyError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status, code := errorStatus(err)
+	id := requestID(r)
+	log.Printf("%s %s [%s]: Error: %d %s\n", r.URL, r.Method, id, status, err)
+
+	if message == "" {
+		message = http.StatusText(status)
+	}
 
-	message := http.StatusText(status)
-	if extraText != "" {
-		message = fmt.Sprintf("%s - %s", message, extraText)
+	body := errorBody{Code: code, Message: message, RequestID: id}
+	if status < http.StatusInternalServerError {
+		body.Details = err.Error()
 	}
 
-	http.Error(w, message, status)
+	replyJSONContent(status, w, r, errorResponse{Error: body})
 }
 
 func logErr(err error) {
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"examples/scrappy/internal/es"
+)
+
+// Probe routes, called by orchestrators without authentication, and left out of the audit log
+const (
+	healthPath = "/healthz"
+	readyPath  = "/readyz"
+)
+
+// Time allowed for the readiness checks
+const readyTimeout = 5 * time.Second
+
+// readinessChecker is implemented by stores depending on an external service,
+// currently only the ElasticSearch store. Other stores are ready once opened.
+type readinessChecker interface {
+	CheckReady(ctx context.Context) error
+}
+
+type probeResponse struct {
+	Status string `json:"status"`
+}
+
+// healthHandler answers as long as the process serves requests.
+func healthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		replyJSONContent(http.StatusOK, w, r, probeResponse{Status: "ok"})
+	}
+}
+
+// readyHandler answers once the store can serve requests,
+// for the elastic store, once the cluster is reachable and the companies index exists.
+func readyHandler(state *State) http.HandlerFunc {
+	checker, ok := state.store.(readinessChecker)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok {
+			ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+			defer cancel()
+
+			err := checker.CheckReady(ctx)
+			if err != nil {
+				message := "store unavailable"
+				if errors.Is(err, es.ErrNotFound) {
+					message = "companies index not found"
+				}
+
+				replyError(w, r, fmt.Errorf("%w: %s", ErrNotReady, err), message)
+				return
+			}
+		}
+
+		replyJSONContent(http.StatusOK, w, r, probeResponse{Status: "ready"})
+	}
+}
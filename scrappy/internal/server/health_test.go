@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/auth"
+	"examples/scrappy/internal/es"
+)
+
+// readyStore is a test store depending on an external service.
+type readyStore struct {
+	testStore
+	checkReady func(ctx context.Context) error
+}
+
+func (s *readyStore) CheckReady(ctx context.Context) error {
+	return s.checkReady(ctx)
+}
+
+func TestProbes(t *testing.T) {
+	keyring, err := auth.NewKeyring([]auth.APIKey{
+		{Name: "reports", Hash: auth.HashKey("scrappy_reports"), Scopes: []auth.Scope{auth.ScopeRead}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	testCases := []struct {
+		name            string
+		path            string
+		readyErr        error
+		expectedStatus  int
+		expectedCode    string
+		expectedMessage string
+	}{
+		{name: "healthy", path: healthPath, expectedStatus: http.StatusOK},
+		{
+			name:           "healthy while unreachable",
+			path:           healthPath,
+			readyErr:       fmt.Errorf("%w: connection refused", es.ErrFailedRequest),
+			expectedStatus: http.StatusOK,
+		},
+		{name: "ready", path: readyPath, expectedStatus: http.StatusOK},
+		{
+			name:            "unreachable",
+			path:            readyPath,
+			readyErr:        fmt.Errorf("%w: connection refused", es.ErrFailedRequest),
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedCode:    codeNotReady,
+			expectedMessage: "store unavailable",
+		},
+		{
+			name:            "missing index or alias",
+			path:            readyPath,
+			readyErr:        fmt.Errorf("%w: companies index", es.ErrNotFound),
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedCode:    codeNotReady,
+			expectedMessage: "companies index not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			companyStore := &readyStore{checkReady: func(ctx context.Context) error {
+				return tc.readyErr
+			}}
+			// Probes are answered without an API key, even when authentication is enabled
+			server := NewServer("", time.Second, companyStore, &Options{Keys: keyring})
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			recorder, body := serveTestRequest(t, server.Handler, r)
+
+			if recorder.Code != tc.expectedStatus || body.Code != tc.expectedCode {
+				t.Errorf("Expected %d %q, got %d %q", tc.expectedStatus, tc.expectedCode, recorder.Code, body.Code)
+			}
+			if body.Message != tc.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tc.expectedMessage, body.Message)
+			}
+		})
+	}
+}
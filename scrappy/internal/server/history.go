@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"examples/scrappy/internal/es"
+)
+
+// historyProvider is implemented by stores recording every scrape,
+// currently only the ElasticSearch store.
+type historyProvider interface {
+	ScrapeHistory(ctx context.Context, url string, limit int) ([]es.ScrapeHistoryEntry, error)
+}
+
+type historyResponse struct {
+	Domain  string                  `json:"domain"`
+	Scrapes []es.ScrapeHistoryEntry `json:"scrapes"`
+}
+
+func companyHistoryHandler(state *State) func(w http.ResponseWriter, r *http.Request, domain string) {
+	provider, ok := state.store.(historyProvider)
+
+	return func(w http.ResponseWriter, r *http.Request, domain string) {
+		// Only GET HTTP method allowed
+		if r.Method != http.MethodGet {
+			replyError(w, r, ErrMethodNotSupported, "")
+			return
+		}
+
+		if !ok {
+			err := fmt.Errorf("%w: scrape history", ErrNotImplemented)
+			replyError(w, r, err, "scrape history requires the elastic store")
+			return
+		}
+
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil {
+				err = fmt.Errorf("%w: invalid limit %q", ErrInvalidRequest, value)
+				replyError(w, r, err, "invalid scrape history parameters")
+				return
+			}
+		}
+
+		entries, err := provider.ScrapeHistory(r.Context(), domain, limit)
+		if err != nil {
+			replyError(w, r, err, "failed to get scrape history")
+			return
+		}
+
+		if len(entries) == 0 {
+			replyError(w, r, ErrNotFound, "no scrapes recorded")
+			return
+		}
+
+		replyJSONContent(http.StatusOK, w, r, historyResponse{Domain: domain, Scrapes: entries})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Route exposing the metrics, in the Prometheus text format
+const metricsPath = "/metrics"
+
+// RequestObserver is notified of every request served, e.g. to export metrics.
+type RequestObserver interface {
+	ObserveHTTPRequest(route string, method string, status int, duration time.Duration)
+}
+
+// withMetrics reports every request to the observer, labelled by the route pattern which served it.
+func withMetrics(observer RequestObserver, mux *http.ServeMux, next http.Handler) http.Handler {
+	if observer == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		observer.ObserveHTTPRequest(routeLabel(mux, r), methodLabel(r.Method), recorder.status, time.Since(start))
+	})
+}
+
+// routeLabel returns the route pattern matching the request, rather than its path,
+// so the company domains don't end up in the metrics labels.
+//
+// Requests to unknown routes are labelled "/".
+func routeLabel(mux *http.ServeMux, r *http.Request) string {
+	_, pattern := mux.Handler(r)
+	if pattern != "/companies/" {
+		return pattern
+	}
+
+	domain, route := splitCompanyPath(strings.TrimPrefix(r.URL.Path, "/companies/"))
+	switch {
+	case domain == "":
+		return "/"
+	case route == "":
+		return "/companies/{domain}"
+	case route == "history":
+		return "/companies/{domain}/history"
+	default:
+		return "/"
+	}
+}
+
+// methodLabel keeps the standard HTTP methods, any other method is labelled "other".
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Header holding the ID of a request, set on every response
+const requestIDHeader = "X-Request-ID"
+
+// Maximum length of a request ID set by the client
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// withRequestID assigns an ID to every request, used to match error responses with the server logs.
+//
+// IDs set by the client, or a proxy, in the X-Request-ID header are kept.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestID returns the ID assigned to the request by withRequestID.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var id [16]byte
+	_, err := rand.Read(id[:])
+	logErr(err)
+
+	return hex.EncodeToString(id[:])
+}
+
+// validRequestID accepts printable ASCII IDs, which are safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for index := 0; index < len(id); index++ {
+		if id[index] < '!' || id[index] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withTimeout sets a deadline on the request context, a tenth of the timeout before the server write timeout,
+// so store calls running out of time are answered with a store_timeout error, instead of a dropped connection.
+func withTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+
+	handlerTimeout := timeout - timeout/10
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), handlerTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type auditKey struct{}
+
+// auditEntry is filled while serving a request, and logged once done.
+type auditEntry struct {
+	// Name of the API key, set once authenticated
+	key string
+}
+
+// withAudit logs every request, except probes, with the key that made it, and the response status.
+func withAudit(logger *log.Logger, next http.Handler) http.Handler {
+	if logger == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath || r.URL.Path == readyPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		entry := &auditEntry{key: "-"}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		ctx := context.WithValue(r.Context(), auditKey{}, entry)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		logger.Printf("key=%s method=%s uri=%q status=%d duration=%s remote=%s request_id=%s\n",
+			entry.key, r.Method, r.URL.RequestURI(), recorder.status,
+			time.Since(start).Round(time.Millisecond), r.RemoteAddr, requestID(r))
+	})
+}
+
+// setAuditKey records the name of the key which made the request.
+func setAuditKey(r *http.Request, name string) {
+	entry, ok := r.Context().Value(auditKey{}).(*auditEntry)
+	if ok {
+		entry.key = name
+	}
+}
+
+// statusRecorder records the status written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
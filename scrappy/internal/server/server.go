@@ -1,22 +1,60 @@
 package server
 
 import (
+	"log"
 	"net/http"
 	"time"
 
-	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/auth"
+	"examples/scrappy/internal/store"
 )
 
 type State struct {
-	client *es.Client
+	store store.CompanyStore
+	// Nil if authentication is disabled
+	keys    auth.KeyProvider
+	limiter *auth.RateLimiter
+	// Limits the failed authentications of each remote address, nil if authentication is disabled
+	failedAuth *auth.RateLimiter
+	// Nil if metrics are disabled
+	metrics http.Handler
 }
 
-func NewServer(addr string, timeout time.Duration, client *es.Client) *http.Server {
-	state := &State{client: client}
+// Options configures the server authentication and metrics.
+type Options struct {
+	// Looks up the API keys of clients, anyone can call the server if nil
+	Keys auth.KeyProvider
+	// Limits the requests of each key, no limit if nil
+	RateLimiter *auth.RateLimiter
+	// Logs which key made each request, nothing is logged if nil
+	AuditLog *log.Logger
+	// Records the requests served, nothing is recorded if nil
+	Metrics RequestObserver
+	// Served on /metrics to admin keys, the route isn't served if nil
+	MetricsHandler http.Handler
+}
+
+func NewServer(addr string, timeout time.Duration, companyStore store.CompanyStore, options *Options) *http.Server {
+	if options == nil {
+		options = &Options{}
+	}
+
+	state := &State{
+		store:   companyStore,
+		keys:    options.Keys,
+		limiter: options.RateLimiter,
+		metrics: options.MetricsHandler,
+	}
+	if state.keys != nil {
+		state.failedAuth = auth.NewRateLimiter(failedAuthRate, failedAuthBurst)
+	}
+
+	mux := router(state)
+	handler := withMetrics(options.Metrics, mux, withAudit(options.AuditLog, withTimeout(timeout, mux)))
 
 	return &http.Server{
 		Addr:         addr,
-		Handler:      router(state),
+		Handler:      withRequestID(handler),
 		ReadTimeout:  timeout,
 		WriteTimeout: timeout,
 	}
@@ -24,6 +62,19 @@ func NewServer(addr string, timeout time.Duration, client *es.Client) *http.Serv
 
 func router(state *State) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/companies", companiesHandler(state))
+	mux.Handle("/companies", state.authorize(auth.ScopeRead, companiesHandler(state)))
+	mux.Handle("/companies/", state.authorize(auth.ScopeRead, companyHandler(state)))
+	mux.Handle("/companies/match", state.authorize(auth.ScopeRead, matchCompanyHandler(state)))
+	mux.Handle("/companies/match/batch", state.authorize(auth.ScopeRead, matchCompaniesHandler(state)))
+	mux.Handle("/stats", state.authorize(auth.ScopeAdmin, statsHandler(state)))
+	if state.metrics != nil {
+		mux.Handle(metricsPath, state.authorize(auth.ScopeAdmin, state.metrics.ServeHTTP))
+	}
+	mux.HandleFunc(healthPath, healthHandler())
+	mux.HandleFunc(readyPath, readyHandler(state))
+	// Unknown routes are answered with a JSON error too
+	mux.Handle("/", state.authorize(auth.ScopeRead, func(w http.ResponseWriter, r *http.Request) {
+		replyError(w, r, ErrNotFound, "")
+	}))
 	return mux
 }
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/store"
+)
+
+// testStore answers company lookups using getCompany, other store methods aren't implemented.
+type testStore struct {
+	store.CompanyStore
+	getCompany func(ctx context.Context, url string) (*es.Company, error)
+}
+
+func (s *testStore) GetCompany(ctx context.Context, url string) (*es.Company, error) {
+	return s.getCompany(ctx, url)
+}
+
+func testCompany() *es.Company {
+	company := &es.Company{ID: "mazautoglass.com"}
+	company.Domain = csv.JSONUrl{URL: &url.URL{Scheme: "https", Host: "mazautoglass.com"}}
+	company.CommercialName = "MAZ Auto Glass"
+	return company
+}
+
+// serveTestRequest sends a request to the handler, and decodes the error of the response, if any.
+func serveTestRequest(t *testing.T, handler http.Handler, r *http.Request) (*httptest.ResponseRecorder, errorBody) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	var response errorResponse
+	if recorder.Code >= http.StatusBadRequest {
+		err := json.Unmarshal(recorder.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("Expected a JSON error, got %q: %s", recorder.Body.String(), err)
+		}
+	}
+
+	return recorder, response.Error
+}
+
+func TestRequestTimeout(t *testing.T) {
+	testCases := []struct {
+		name           string
+		delay          time.Duration
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "in time", expectedStatus: http.StatusOK},
+		{name: "store timeout", delay: time.Second, expectedStatus: http.StatusGatewayTimeout, expectedCode: codeStoreTimeout},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			companyStore := &testStore{getCompany: func(ctx context.Context, url string) (*es.Company, error) {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(tc.delay):
+					return testCompany(), nil
+				}
+			}}
+
+			server := NewServer("", 100*time.Millisecond, companyStore, nil)
+			start := time.Now()
+			recorder, body := serveTestRequest(t, server.Handler, httptest.NewRequest(http.MethodGet, "/companies/mazautoglass.com", nil))
+
+			if recorder.Code != tc.expectedStatus || body.Code != tc.expectedCode {
+				t.Errorf("Expected %d %q, got %d %q", tc.expectedStatus, tc.expectedCode, recorder.Code, body.Code)
+			}
+
+			// The response is written before the server write timeout
+			if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+				t.Errorf("Expected a response before the write timeout, got one after %s", elapsed)
+			}
+		})
+	}
+}
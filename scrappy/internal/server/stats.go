@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"examples/scrappy/internal/es"
+)
+
+// statsProvider is implemented by stores able to aggregate the companies data,
+// currently only the ElasticSearch store.
+type statsProvider interface {
+	CompanyStats(ctx context.Context) (*es.CompanyStats, error)
+}
+
+func statsHandler(state *State) http.HandlerFunc {
+	provider, ok := state.store.(statsProvider)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only GET HTTP method allowed
+		if r.Method != http.MethodGet {
+			replyError(w, r, ErrMethodNotSupported, "")
+			return
+		}
+
+		if !ok {
+			err := fmt.Errorf("%w: stats", ErrNotImplemented)
+			replyError(w, r, err, "stats require the elastic store")
+			return
+		}
+
+		stats, err := provider.CompanyStats(r.Context())
+		if err != nil {
+			replyError(w, r, err, "failed to compute stats")
+			return
+		}
+
+		replyJSONContent(http.StatusOK, w, r, stats)
+	}
+}
@@ -0,0 +1,252 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+)
+
+// document is a company as stored by the local backends,
+// using the same JSON fields as the ElasticSearch companies index,
+// so fields set by UpdateCompanyInfo are kept even if es.Company doesn't know them.
+type document map[string]any
+
+// companyID returns the id of the company with the given url, its registrable domain,
+// the same id used by the ElasticSearch index.
+func companyID(url string) (string, error) {
+	parsedUrl, err := csv.NormalizeURL(url)
+	if err != nil {
+		return "", es.InvalidParams(err)
+	}
+
+	return parsedUrl.Hostname(), nil
+}
+
+// newDocument encodes a company loaded from a CSV file.
+func newDocument(company *csv.Company) (document, error) {
+	var doc document
+	err := convertJSON(company, &doc)
+	return doc, err
+}
+
+func decodeDocument(encoded []byte) (document, error) {
+	var doc document
+	err := json.Unmarshal(encoded, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", es.ErrUnexpectedResponse, err)
+	}
+
+	return doc, nil
+}
+
+// copy returns a shallow copy of the document, fields are replaced rather than modified in place.
+func (d document) copy() document {
+	result := make(document, len(d))
+	for key, value := range d {
+		result[key] = value
+	}
+
+	return result
+}
+
+// merge sets the fields of the document, like a partial ES update.
+func (d document) merge(fields map[string]any) {
+	for key, value := range fields {
+		d[key] = value
+	}
+}
+
+// equal reports whether both documents encode to the same JSON.
+func (d document) equal(other document) bool {
+	var left, right any
+	if convertJSON(d, &left) != nil || convertJSON(other, &right) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func (d document) company(id string) (*es.Company, error) {
+	var company es.Company
+	err := convertJSON(d, &company)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", es.ErrUnexpectedResponse, err)
+	}
+
+	company.ID = id
+	return &company, nil
+}
+
+// strings returns a field holding either a string or a list of strings.
+func (d document) strings(field string) []string {
+	switch value := d[field].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []any:
+		var result []string
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// names returns the company names, by name field.
+func (d document) names() map[string][]string {
+	names := map[string][]string{}
+	for _, field := range nameFields {
+		names[field.name] = d.strings(field.name)
+	}
+
+	return names
+}
+
+func (d document) phoneNumbers() []string {
+	return d.strings("phone_numbers")
+}
+
+// facebookPages returns the normalized Facebook pages of the company,
+// set by UpdateCompanyInfo, or imported as an extra CSV column.
+func (d document) facebookPages() []string {
+	pages := d.strings("facebook")
+
+	if attributes, ok := d["attributes"].(map[string]any); ok {
+		if page, ok := attributes["facebook"].(string); ok {
+			pages = append(pages, page)
+		}
+	}
+
+	var normalized []string
+	for _, page := range pages {
+		if page, err := es.NormalizeFacebookURL(page); err == nil {
+			normalized = append(normalized, page)
+		}
+	}
+
+	return normalized
+}
+
+// mergePhoneNumbers merges the sightings of a scrape into the phone history of the company,
+// using the same rules as the ElasticSearch merge script (see es.MergePhoneNumbers).
+//
+// Returns whether the document changed.
+func (d document) mergePhoneNumbers(sightings []es.PhoneSighting, visited []string, now time.Time, staleAfter time.Duration) (bool, error) {
+	var history []es.PhoneRecord
+	if d["phone_history"] != nil {
+		err := convertJSON(d["phone_history"], &history)
+		if err != nil {
+			return false, fmt.Errorf("%w: %s", es.ErrUnexpectedResponse, err)
+		}
+	}
+
+	// Dates are stored with a second precision, like the ES script
+	now = now.UTC().Truncate(time.Second)
+	changed := false
+
+	byNumber := map[string]int{}
+	for index, record := range history {
+		byNumber[record.Number] = index
+	}
+
+	addRecord := func(number string) int {
+		history = append(history, es.PhoneRecord{
+			Number:    number,
+			FirstSeen: now,
+			LastSeen:  now,
+			Sources:   []string{},
+		})
+		byNumber[number] = len(history) - 1
+		changed = true
+		return len(history) - 1
+	}
+
+	for _, number := range d.phoneNumbers() {
+		if _, found := byNumber[number]; !found {
+			addRecord(number)
+		}
+	}
+
+	for _, sighting := range sightings {
+		index, found := byNumber[sighting.Number]
+		if !found {
+			index = addRecord(sighting.Number)
+		}
+
+		record := &history[index]
+		record.LastSeen = now
+		record.TimesSeen++
+		if sighting.Source != "" && !contains(record.Sources, sighting.Source) {
+			record.Sources = append(record.Sources, sighting.Source)
+		}
+		if record.Confidence == nil || sighting.Confidence > *record.Confidence {
+			confidence := sighting.Confidence
+			record.Confidence = &confidence
+		}
+		changed = true
+	}
+
+	current := []string{}
+	for index := range history {
+		record := &history[index]
+
+		stale := record.Stale
+		if record.Confidence != nil && containsAny(visited, record.Sources) {
+			stale = now.Sub(record.LastSeen) > staleAfter
+		}
+		if record.Stale != stale {
+			record.Stale = stale
+			changed = true
+		}
+		if !stale {
+			current = append(current, record.Number)
+		}
+	}
+
+	if changed {
+		d["phone_history"] = history
+		d["phone_numbers"] = current
+	}
+
+	return changed, nil
+}
+
+// convertJSON converts a value into another type, through its JSON encoding.
+func convertJSON(value any, result any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(encoded, result)
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsAny reports whether values contains any of candidates.
+func containsAny(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if contains(values, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/phone"
+)
+
+// updateFunc returns the new version of a document, given the stored one (nil if missing).
+// Returning a nil document leaves the stored one unchanged.
+type updateFunc func(doc document) (document, error)
+
+// candidateFilter selects the documents which may match a query,
+// backends can return more documents, since they are scored afterwards.
+type candidateFilter struct {
+	// Name query, matching documents containing any of its terms
+	name     string
+	phone    *phone.NumberForms
+	ids      []string
+	facebook string
+}
+
+// backend stores the documents of a localStore.
+type backend interface {
+	// get returns the document with the given id, or nil if it is missing
+	get(ctx context.Context, id string) (document, error)
+	// update atomically replaces the document with the given id
+	update(ctx context.Context, id string, fn updateFunc) error
+	candidates(ctx context.Context, filter *candidateFilter) ([]scoredDocument, error)
+	close() error
+}
+
+// localStore implements CompanyStore for the backends which run in process,
+// scoring search and match results in Go.
+type localStore struct {
+	backend backend
+}
+
+func (s *localStore) GetCompany(ctx context.Context, url string) (*es.Company, error) {
+	id, err := companyID(url)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := s.backend.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc == nil {
+		return nil, fmt.Errorf("%w: %s", es.ErrNotFound, id)
+	}
+
+	return doc.company(id)
+}
+
+func (s *localStore) SearchCompany(ctx context.Context, query string, phoneNumber string, options *es.SearchOptions) (*es.SearchCompaniesResult, error) {
+	var filter candidateFilter
+	var score func(doc document) []clause
+
+	switch {
+	case query == "" && phoneNumber == "":
+		return nil, fmt.Errorf("%w: missing query argument", es.ErrInvalidParams)
+	case query != "" && phoneNumber != "":
+		return nil, fmt.Errorf("%w: must provide either query or phone number", es.ErrInvalidParams)
+	case phoneNumber != "":
+		forms, err := phone.ParseNumberForms(phoneNumber)
+		if err != nil {
+			return nil, es.InvalidParams(err)
+		}
+
+		filter.phone = forms
+		score = func(doc document) []clause { return phoneClauses(doc, forms, 1) }
+	default:
+		filter.name = query
+		score = func(doc document) []clause { return nameClauses(doc, query) }
+	}
+
+	// Check the options before loading any candidate
+	if _, _, err := page(options); err != nil {
+		return nil, err
+	}
+
+	candidates, err := s.backend.candidates(ctx, &filter)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := scoreCandidates(candidates, func(candidate *scoredDocument) []clause {
+		return score(candidate.doc)
+	})
+
+	return searchResult(hits, options)
+}
+
+func (s *localStore) MatchCompany(ctx context.Context, match *es.MatchQuery) (*es.MatchCompanyResult, error) {
+	parsed, err := parseMatchQuery(match)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &es.SearchOptions{Limit: parsed.limit}
+	if _, _, err := page(options); err != nil {
+		return nil, err
+	}
+
+	filter := candidateFilter{name: parsed.name, phone: parsed.phone, facebook: parsed.facebook}
+	if parsed.domain != "" {
+		filter.ids = []string{parsed.domain}
+	}
+
+	candidates, err := s.backend.candidates(ctx, &filter)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := scoreCandidates(candidates, func(candidate *scoredDocument) []clause {
+		return parsed.clauses(candidate.id, candidate.doc)
+	})
+
+	result, err := searchResult(hits, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &es.MatchCompanyResult{Candidates: result.Companies}, nil
+}
+
+// MatchCompanies runs the queries one after the other, since there is no network round trip to save.
+func (s *localStore) MatchCompanies(ctx context.Context, matches []es.MatchQuery, options *es.BatchMatchOptions) []es.BatchMatchResult {
+	results := make([]es.BatchMatchResult, len(matches))
+
+	for index := range matches {
+		results[index].MatchCompanyResult, results[index].Err = s.MatchCompany(ctx, &matches[index])
+	}
+
+	return results
+}
+
+func (s *localStore) UpdateCompanyInfo(ctx context.Context, url string, info map[string]any) error {
+	id, err := companyID(url)
+	if err != nil {
+		return err
+	}
+
+	return s.backend.update(ctx, id, func(doc document) (document, error) {
+		if doc == nil {
+			return nil, fmt.Errorf("%w: %s", es.ErrNotFound, id)
+		}
+
+		updated := doc.copy()
+		updated.merge(info)
+		return updated, nil
+	})
+}
+
+// BulkIndexCompanies upserts the companies, with the same rules as es.Client.BulkIndexCompanies.
+func (s *localStore) BulkIndexCompanies(companies []csv.Company, options *es.BulkIndexOptions) (*es.BulkIndexStats, error) {
+	ctx := context.Background()
+	overwrite := options != nil && options.Overwrite
+
+	var stats es.BulkIndexStats
+
+	for index := range companies {
+		company := &companies[index]
+		id := company.Domain.Hostname()
+
+		fields, err := newDocument(company)
+		if err != nil {
+			return nil, err
+		}
+
+		// Outcome of the write, only counted once it succeeded
+		var outcome *int
+
+		err = s.backend.update(ctx, id, func(doc document) (document, error) {
+			switch {
+			case doc == nil:
+				outcome = &stats.Created
+				return fields, nil
+			case overwrite:
+				outcome = &stats.Updated
+				return fields, nil
+			}
+
+			updated := doc.copy()
+			updated.merge(fields)
+			if updated.equal(doc) {
+				outcome = &stats.Unchanged
+				return nil, nil
+			}
+
+			outcome = &stats.Updated
+			return updated, nil
+		})
+
+		if err != nil {
+			log.Printf("store index error for company %q: %s\n", id, err)
+			stats.Failed++
+
+			// Saved using the bulk action of the ElasticSearch store, so it can be resubmitted there
+			failed, encodeErr := es.NewFailedCompanyItem(company, options, err.Error())
+			if encodeErr == nil {
+				stats.FailedItems = append(stats.FailedItems, failed)
+			}
+			continue
+		}
+
+		*outcome++
+	}
+
+	return &stats, nil
+}
+
+func (s *localStore) NewPhoneNumbersWriter(options *es.PhoneNumbersWriterOptions) (PhoneNumbersWriter, error) {
+	writer := &localPhoneNumbersWriter{store: s, staleAfter: es.DefaultPhoneStaleAfter}
+	if options != nil && options.StaleAfter > 0 {
+		writer.staleAfter = options.StaleAfter
+	}
+
+	return writer, nil
+}
+
+func (s *localStore) Close() error {
+	return s.backend.close()
+}
+
+// localPhoneNumbersWriter merges the phone numbers as soon as they are added,
+// writes are local, so there is nothing to gain from batching them.
+type localPhoneNumbersWriter struct {
+	store      *localStore
+	staleAfter time.Duration
+	stats      es.BulkUpdateStats
+}
+
+func (w *localPhoneNumbersWriter) Add(ctx context.Context, url string, sightings []es.PhoneSighting, visited []string) error {
+	id, err := companyID(url)
+	if err != nil {
+		return err
+	}
+
+	var outcome *int
+
+	err = w.store.backend.update(ctx, id, func(doc document) (document, error) {
+		if doc == nil {
+			outcome = &w.stats.NotFound
+			return nil, nil
+		}
+
+		updated := doc.copy()
+		changed, err := updated.mergePhoneNumbers(sightings, visited, time.Now(), w.staleAfter)
+		if err != nil {
+			return nil, err
+		}
+
+		if !changed {
+			outcome = &w.stats.Unchanged
+			return nil, nil
+		}
+
+		outcome = &w.stats.Updated
+		return updated, nil
+	})
+
+	if err != nil {
+		log.Printf("store update error for company %q: %s\n", id, err)
+		w.stats.Failed++
+
+		failed, encodeErr := es.NewFailedPhoneNumbersItem(url, sightings, visited, w.staleAfter, err.Error())
+		if encodeErr == nil {
+			w.stats.FailedItems = append(w.stats.FailedItems, failed)
+		}
+		return nil
+	}
+
+	*outcome++
+	return nil
+}
+
+func (w *localPhoneNumbersWriter) Close(ctx context.Context) (*es.BulkUpdateStats, error) {
+	stats := w.stats
+	return &stats, nil
+}
+
+// scoreCandidates scores each candidate, keeping the ones matching at least one clause.
+func scoreCandidates(candidates []scoredDocument, score func(candidate *scoredDocument) []clause) []scoredDocument {
+	var hits []scoredDocument
+
+	for index := range candidates {
+		candidate := candidates[index]
+
+		candidate.clauses = score(&candidate)
+		if len(candidate.clauses) > 0 {
+			hits = append(hits, candidate)
+		}
+	}
+
+	return hits
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// memoryBackend keeps the documents in a map, encoded as JSON,
+// so stored documents don't share values with the callers.
+//
+// Every document is a candidate for every query.
+type memoryBackend struct {
+	mu   sync.RWMutex
+	docs map[string][]byte
+}
+
+// NewMemoryStore returns an empty store, which only lasts as long as the process.
+//
+// It can't be selected using the "store" config value, since every command would start
+// from an empty store, it is used by tests instead.
+func NewMemoryStore() CompanyStore {
+	return &localStore{backend: &memoryBackend{docs: map[string][]byte{}}}
+}
+
+func (b *memoryBackend) get(ctx context.Context, id string) (document, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	encoded, found := b.docs[id]
+	if !found {
+		return nil, nil
+	}
+
+	return decodeDocument(encoded)
+}
+
+func (b *memoryBackend) update(ctx context.Context, id string, fn updateFunc) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var doc document
+	if encoded, found := b.docs[id]; found {
+		var err error
+		doc, err = decodeDocument(encoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	updated, err := fn(doc)
+	if err != nil || updated == nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+
+	b.docs[id] = encoded
+	return nil
+}
+
+func (b *memoryBackend) candidates(ctx context.Context, filter *candidateFilter) ([]scoredDocument, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	candidates := make([]scoredDocument, 0, len(b.docs))
+	for id, encoded := range b.docs {
+		doc, err := decodeDocument(encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, scoredDocument{id: id, doc: doc})
+	}
+
+	// Map iteration order is random, keep results deterministic
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].id < candidates[j].id
+	})
+
+	return candidates, nil
+}
+
+func (b *memoryBackend) close() error {
+	return nil
+}
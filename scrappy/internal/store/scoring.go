@@ -0,0 +1,409 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"examples/scrappy/internal/es"
+	"examples/scrappy/internal/phone"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The local backends score companies in Go, approximating the ElasticSearch queries:
+// the same clauses are used, reported using the same names in SearchMatch.MatchedQueries,
+// but names are only lowercased and folded to ASCII, without synonyms or fuzziness.
+//
+// Scores are approximate: each clause adds a fixed score, scaled by the same boosts,
+// rather than a BM25 score depending on term frequencies, so results may be ordered
+// differently than by ElasticSearch, and their scores can't be compared to ES ones.
+// Every local backend scores the same candidates alike, whichever way it finds them.
+
+// Names of the query clauses, the same as the ElasticSearch ones
+const (
+	matchNamePhrase   = "name_phrase"
+	matchNameTerms    = "name_terms"
+	matchNamePrefix   = "name_prefix"
+	matchNameFuzzy    = "name_fuzzy"
+	matchPhone        = "phone_number"
+	matchPhonePartial = "phone_partial"
+	matchDomain       = "domain"
+	matchFacebook     = "facebook"
+)
+
+// Company name fields, boosted by how much we trust each of them
+var nameFields = []struct {
+	name  string
+	boost float64
+}{
+	{name: "commercial_name", boost: 3},
+	{name: "legal_name", boost: 2},
+	{name: "all_available_names", boost: 1},
+}
+
+// clause is a matched query clause, and its contribution to the score.
+type clause struct {
+	name  string
+	score float64
+}
+
+// scoredDocument is a document matching a query.
+type scoredDocument struct {
+	id      string
+	doc     document
+	clauses []clause
+}
+
+func (s *scoredDocument) score() float64 {
+	total := 0.0
+	for _, clause := range s.clauses {
+		total += clause.score
+	}
+
+	return total
+}
+
+// searchMatch describes why the document matched, like the ES hit of the same query.
+func (s *scoredDocument) searchMatch(explain bool) *es.SearchMatch {
+	match := &es.SearchMatch{Score: s.score()}
+
+	var details []es.Explanation
+	for _, clause := range s.clauses {
+		if !contains(match.MatchedQueries, clause.name) {
+			match.MatchedQueries = append(match.MatchedQueries, clause.name)
+		}
+		details = append(details, es.Explanation{Value: clause.score, Description: clause.name})
+	}
+
+	if explain {
+		match.Explanation = &es.Explanation{Value: match.Score, Description: "sum of:", Details: details}
+	}
+
+	return match
+}
+
+// foldText lowercases text, and strips its accents, so "Café" matches "cafe".
+func foldText(text string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		folded = text
+	}
+
+	return strings.ToLower(strings.ReplaceAll(folded, "&", " and "))
+}
+
+// tokenize splits text into its folded words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(foldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// nameClauses scores the names of a document against a name query,
+// scoring exact phrases highest, then names containing every query term,
+// then names starting with the query terms, like es.Client.SearchCompanyByName.
+func nameClauses(doc document, query string) []clause {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	phrase := " " + strings.Join(terms, " ") + " "
+
+	var phraseScore, termsScore, prefixScore float64
+	for _, field := range nameFields {
+		for _, name := range doc.strings(field.name) {
+			tokens := tokenize(name)
+
+			if strings.Contains(" "+strings.Join(tokens, " ")+" ", phrase) {
+				phraseScore = maxScore(phraseScore, 3*field.boost)
+			}
+			if matchesEvery(terms, tokens, func(term, token string) bool { return term == token }) {
+				termsScore = maxScore(termsScore, 2*field.boost)
+			}
+			if matchesEvery(terms, tokens, strings.HasPrefix) {
+				prefixScore = maxScore(prefixScore, field.boost)
+			}
+		}
+	}
+
+	return appendClauses(nil,
+		clause{name: matchNamePhrase, score: phraseScore},
+		clause{name: matchNameTerms, score: termsScore},
+		clause{name: matchNamePrefix, score: prefixScore},
+	)
+}
+
+// fuzzyNameClauses scores names containing the query as a phrase, or some of its terms,
+// for matching, where names are often misspelled or incomplete.
+func fuzzyNameClauses(doc document, query string, weight float64) []clause {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	phrase := " " + strings.Join(terms, " ") + " "
+
+	var phraseScore, fuzzyScore float64
+	for _, field := range nameFields {
+		for _, name := range doc.strings(field.name) {
+			tokens := tokenize(name)
+
+			if strings.Contains(" "+strings.Join(tokens, " ")+" ", phrase) {
+				phraseScore = maxScore(phraseScore, 2*weight*field.boost)
+			}
+
+			found := 0
+			for _, term := range terms {
+				if contains(tokens, term) {
+					found++
+				}
+			}
+			fuzzyScore = maxScore(fuzzyScore, weight*field.boost*float64(found)/float64(len(terms)))
+		}
+	}
+
+	return appendClauses(nil,
+		clause{name: matchNamePhrase, score: phraseScore},
+		clause{name: matchNameFuzzy, score: fuzzyScore},
+	)
+}
+
+// phoneClauses scores the phone numbers of a document, exact numbers above
+// numbers sharing the same last digits, like the ElasticSearch phone query.
+func phoneClauses(doc document, forms *phone.NumberForms, boost float64) []clause {
+	var exactScore, partialScore float64
+
+	for _, number := range doc.phoneNumbers() {
+		stored, err := phone.ParseNumberForms(number)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case forms.E164 != "" && stored.E164 == forms.E164:
+			exactScore = maxScore(exactScore, 3*boost)
+		case forms.NationalDigits != "" && stored.NationalDigits == forms.NationalDigits:
+			exactScore = maxScore(exactScore, 2*boost)
+		case stored.LastDigits == forms.LastDigits:
+			partialScore = maxScore(partialScore, boost)
+		}
+	}
+
+	return appendClauses(nil,
+		clause{name: matchPhone, score: exactScore},
+		clause{name: matchPhonePartial, score: partialScore},
+	)
+}
+
+// parsedMatch is a validated match query.
+type parsedMatch struct {
+	name     string
+	phone    *phone.NumberForms
+	domain   string
+	facebook string
+	weights  es.MatchWeights
+	limit    int
+}
+
+// parseMatchQuery validates a match query, using the same rules as es.Client.MatchCompany.
+func parseMatchQuery(match *es.MatchQuery) (*parsedMatch, error) {
+	parsed := &parsedMatch{weights: es.DefaultMatchWeights(), limit: match.Limit}
+	if match.Weights != nil {
+		parsed.weights = *match.Weights
+	}
+	if parsed.limit == 0 {
+		parsed.limit = es.DefaultMatchLimit
+	}
+
+	weights := parsed.weights
+	if weights.Name < 0 || weights.Phone < 0 || weights.Website < 0 || weights.Facebook < 0 {
+		return nil, fmt.Errorf("%w: match weights can't be negative", es.ErrInvalidParams)
+	}
+
+	if name := strings.TrimSpace(match.Name); name != "" && weights.Name > 0 {
+		parsed.name = name
+	}
+
+	if match.Phone != "" && weights.Phone > 0 {
+		forms, err := phone.ParseNumberForms(match.Phone)
+		if err != nil {
+			return nil, es.InvalidParams(err)
+		}
+		parsed.phone = forms
+	}
+
+	if match.Website != "" && weights.Website > 0 {
+		id, err := companyID(match.Website)
+		if err != nil {
+			return nil, err
+		}
+		parsed.domain = id
+	}
+
+	if match.Facebook != "" && weights.Facebook > 0 {
+		page, err := es.NormalizeFacebookURL(match.Facebook)
+		if err != nil {
+			return nil, err
+		}
+		parsed.facebook = page
+	}
+
+	if parsed.name == "" && parsed.phone == nil && parsed.domain == "" && parsed.facebook == "" {
+		return nil, fmt.Errorf("%w: provide at least one of name, phone, website or facebook", es.ErrInvalidParams)
+	}
+
+	return parsed, nil
+}
+
+// clauses scores a document against every signal of the match query.
+func (m *parsedMatch) clauses(id string, doc document) []clause {
+	var clauses []clause
+
+	if m.name != "" {
+		clauses = append(clauses, fuzzyNameClauses(doc, m.name, m.weights.Name)...)
+	}
+	if m.phone != nil {
+		clauses = append(clauses, phoneClauses(doc, m.phone, m.weights.Phone)...)
+	}
+	if m.domain != "" && m.domain == id {
+		clauses = append(clauses, clause{name: matchDomain, score: m.weights.Website})
+	}
+	if m.facebook != "" && contains(doc.facebookPages(), m.facebook) {
+		clauses = append(clauses, clause{name: matchFacebook, score: m.weights.Facebook})
+	}
+
+	return clauses
+}
+
+// rank sorts documents by score, highest first, breaking ties by id, like the ES search sort.
+func rank(hits []scoredDocument) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		left, right := hits[i].score(), hits[j].score()
+		if left != right {
+			return left > right
+		}
+
+		return hits[i].id < hits[j].id
+	})
+}
+
+// searchResult ranks the hits, and returns the page selected by the options.
+//
+// Cursors encode the offset of the next page, unlike ES cursors they aren't
+// stable if companies are written while paging.
+func searchResult(hits []scoredDocument, options *es.SearchOptions) (*es.SearchCompaniesResult, error) {
+	limit, offset, err := page(options)
+	if err != nil {
+		return nil, err
+	}
+
+	rank(hits)
+
+	result := &es.SearchCompaniesResult{Total: len(hits), Companies: []es.Company{}}
+	explain := options != nil && options.Explain
+
+	for index := offset; index < len(hits) && index < offset+limit; index++ {
+		company, err := hits[index].doc.company(hits[index].id)
+		if err != nil {
+			return nil, err
+		}
+
+		company.SearchMatch = hits[index].searchMatch(explain)
+		result.Companies = append(result.Companies, *company)
+	}
+
+	if offset+limit < len(hits) {
+		result.Next = encodeOffset(offset + limit)
+	}
+
+	return result, nil
+}
+
+// page returns the page size and offset selected by the options.
+func page(options *es.SearchOptions) (int, int, error) {
+	if options == nil {
+		return es.DefaultSearchLimit, 0, nil
+	}
+
+	limit := options.Limit
+	if limit == 0 {
+		limit = es.DefaultSearchLimit
+	}
+	if limit < 0 || limit > es.MaxSearchLimit {
+		return 0, 0, fmt.Errorf("%w: limit must be between 1 and %d", es.ErrInvalidParams, es.MaxSearchLimit)
+	}
+
+	switch {
+	case options.Cursor != "" && options.From != 0:
+		return 0, 0, fmt.Errorf("%w: from can't be used together with a cursor", es.ErrInvalidParams)
+	case options.Cursor != "":
+		offset, err := decodeOffset(options.Cursor)
+		return limit, offset, err
+	case options.From < 0:
+		return 0, 0, fmt.Errorf("%w: from can't be negative", es.ErrInvalidParams)
+	default:
+		return limit, options.From, nil
+	}
+}
+
+func encodeOffset(offset int) string {
+	encoded, _ := json.Marshal([]int{offset})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeOffset(cursor string) (int, error) {
+	var offset []int
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(decoded, &offset)
+	}
+	if err != nil || len(offset) != 1 || offset[0] < 0 {
+		return 0, fmt.Errorf("%w: invalid cursor", es.ErrInvalidParams)
+	}
+
+	return offset[0], nil
+}
+
+// matchesEvery reports whether every term matches one of the tokens.
+func matchesEvery(terms []string, tokens []string, matches func(token string, term string) bool) bool {
+	for _, term := range terms {
+		found := false
+		for _, token := range tokens {
+			if matches(token, term) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// appendClauses appends the clauses which matched, with a positive score.
+func appendClauses(clauses []clause, candidates ...clause) []clause {
+	for _, candidate := range candidates {
+		if candidate.score > 0 {
+			clauses = append(clauses, candidate)
+		}
+	}
+
+	return clauses
+}
+
+func maxScore(left float64, right float64) float64 {
+	if left > right {
+		return left
+	}
+
+	return right
+}
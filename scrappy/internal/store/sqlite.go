@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"examples/scrappy/internal/phone"
+
+	// Pure Go SQLite driver, built with FTS5 support
+	_ "modernc.org/sqlite"
+)
+
+// Database file used by the SQLite store, unless configured otherwise
+const DefaultSQLitePath = "./scrappy.db"
+
+// Companies are stored as JSON documents, in the same format as the ElasticSearch index.
+// Each write also refreshes the lookup tables used to find search candidates:
+// an FTS5 table of company names, and tables of phone number last digits and Facebook pages.
+//
+// https://www.sqlite.org/fts5.html
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS companies (
+		id TEXT PRIMARY KEY,
+		doc TEXT NOT NULL
+	)`,
+	// Names are folded to ASCII, so "Café" matches "cafe"
+	`CREATE VIRTUAL TABLE IF NOT EXISTS company_names USING fts5(
+		id UNINDEXED,
+		names,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`,
+	// Numbers sharing the same last digits are candidates for every form of a number
+	`CREATE TABLE IF NOT EXISTS company_phones (
+		id TEXT NOT NULL,
+		last_digits TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS company_phones_id ON company_phones (id)`,
+	`CREATE INDEX IF NOT EXISTS company_phones_last_digits ON company_phones (last_digits)`,
+	`CREATE TABLE IF NOT EXISTS company_facebook_pages (
+		id TEXT NOT NULL,
+		page TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS company_facebook_pages_id ON company_facebook_pages (id)`,
+	`CREATE INDEX IF NOT EXISTS company_facebook_pages_page ON company_facebook_pages (page)`,
+}
+
+// sqlStatement is a statement run when writing a document.
+type sqlStatement struct {
+	query string
+	args  []any
+}
+
+// sqliteBackend stores the documents in an embedded SQLite database.
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens the SQLite database at path, creating it if needed.
+func OpenSQLiteStore(path string) (CompanyStore, error) {
+	if path == "" {
+		path = DefaultSQLitePath
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single writer, a single connection avoids busy errors between our own writes
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range sqliteSchema {
+		_, err = db.Exec(statement)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create SQLite schema: %w", err)
+		}
+	}
+
+	return &localStore{backend: &sqliteBackend{db: db}}, nil
+}
+
+func (b *sqliteBackend) get(ctx context.Context, id string) (document, error) {
+	return b.load(ctx, b.db, id)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (b *sqliteBackend) load(ctx context.Context, db queryer, id string) (document, error) {
+	var encoded string
+
+	err := db.QueryRowContext(ctx, `SELECT doc FROM companies WHERE id = ?`, id).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDocument([]byte(encoded))
+}
+
+func (b *sqliteBackend) update(ctx context.Context, id string, fn updateFunc) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	doc, err := b.load(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	updated, err := fn(doc)
+	if err != nil || updated == nil {
+		return err
+	}
+
+	err = b.write(ctx, tx, id, updated)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// write stores the document, and refreshes its rows in the lookup tables.
+func (b *sqliteBackend) write(ctx context.Context, tx *sql.Tx, id string, doc document) error {
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	statements := []sqlStatement{
+		{
+			query: `INSERT INTO companies (id, doc) VALUES (?, ?)
+				ON CONFLICT (id) DO UPDATE SET doc = excluded.doc`,
+			args: []any{id, string(encoded)},
+		},
+		{query: `DELETE FROM company_names WHERE id = ?`, args: []any{id}},
+		{query: `DELETE FROM company_phones WHERE id = ?`, args: []any{id}},
+		{query: `DELETE FROM company_facebook_pages WHERE id = ?`, args: []any{id}},
+	}
+
+	var names []string
+	for _, fieldNames := range doc.names() {
+		names = append(names, fieldNames...)
+	}
+	statements = append(statements, sqlStatement{
+		query: `INSERT INTO company_names (id, names) VALUES (?, ?)`,
+		args:  []any{id, strings.Join(names, "\n")},
+	})
+
+	for _, number := range doc.phoneNumbers() {
+		forms, err := phone.ParseNumberForms(number)
+		if err != nil {
+			continue
+		}
+
+		statements = append(statements, sqlStatement{
+			query: `INSERT INTO company_phones (id, last_digits) VALUES (?, ?)`,
+			args:  []any{id, forms.LastDigits},
+		})
+	}
+
+	for _, page := range doc.facebookPages() {
+		statements = append(statements, sqlStatement{
+			query: `INSERT INTO company_facebook_pages (id, page) VALUES (?, ?)`,
+			args:  []any{id, page},
+		})
+	}
+
+	for _, statement := range statements {
+		_, err := tx.ExecContext(ctx, statement.query, statement.args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// candidates loads the documents matching any of the filters: containing one of the name terms,
+// sharing the last digits of the phone number, with one of the ids, or with the Facebook page.
+func (b *sqliteBackend) candidates(ctx context.Context, filter *candidateFilter) ([]scoredDocument, error) {
+	var lookups []string
+	var args []any
+
+	if terms := tokenize(filter.name); len(terms) > 0 {
+		// Match any term, or any name starting with it, terms only hold letters and digits
+		quoted := make([]string, 0, len(terms))
+		for _, term := range terms {
+			quoted = append(quoted, fmt.Sprintf(`"%s"*`, term))
+		}
+
+		lookups = append(lookups, `SELECT id FROM company_names WHERE company_names MATCH ?`)
+		args = append(args, strings.Join(quoted, " OR "))
+	}
+
+	if filter.phone != nil {
+		lookups = append(lookups, `SELECT id FROM company_phones WHERE last_digits = ?`)
+		args = append(args, filter.phone.LastDigits)
+	}
+
+	for _, id := range filter.ids {
+		lookups = append(lookups, `SELECT id FROM companies WHERE id = ?`)
+		args = append(args, id)
+	}
+
+	if filter.facebook != "" {
+		lookups = append(lookups, `SELECT id FROM company_facebook_pages WHERE page = ?`)
+		args = append(args, filter.facebook)
+	}
+
+	if len(lookups) == 0 {
+		return nil, nil
+	}
+
+	rows, err := b.db.QueryContext(ctx,
+		`SELECT id, doc FROM companies WHERE id IN (`+strings.Join(lookups, " UNION ")+`) ORDER BY id`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []scoredDocument
+	for rows.Next() {
+		var id, encoded string
+		err := rows.Scan(&id, &encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err := decodeDocument([]byte(encoded))
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, scoredDocument{id: id, doc: doc})
+	}
+
+	return candidates, rows.Err()
+}
+
+func (b *sqliteBackend) close() error {
+	return b.db.Close()
+}
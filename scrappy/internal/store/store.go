@@ -0,0 +1,107 @@
+// Package store abstracts where companies are stored, so commands can run
+// against an ElasticSearch cluster, or an embedded SQLite database.
+// An in-memory store is also available to tests, see NewMemoryStore.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+)
+
+// Storage backends, selected using the "store" config value
+const (
+	BackendElastic = "elastic"
+	BackendSQLite  = "sqlite"
+)
+
+var ErrUnknownBackend = errors.New("unknown store backend")
+
+// CompanyStore is implemented by each storage backend.
+//
+// Errors wrap the es sentinel errors (es.ErrNotFound, es.ErrInvalidParams...),
+// whatever the backend, so callers handle them the same way.
+type CompanyStore interface {
+	// GetCompany gets a company by url, returning es.ErrNotFound if it can't be found.
+	GetCompany(ctx context.Context, url string) (*es.Company, error)
+	// SearchCompany searches for companies by name or phone number, see es.Client.SearchCompany.
+	SearchCompany(ctx context.Context, query string, phone string, options *es.SearchOptions) (*es.SearchCompaniesResult, error)
+	// MatchCompany finds the companies best matching a partial company record.
+	MatchCompany(ctx context.Context, match *es.MatchQuery) (*es.MatchCompanyResult, error)
+	// MatchCompanies runs MatchCompany for each query, returning a result for each, in order.
+	MatchCompanies(ctx context.Context, matches []es.MatchQuery, options *es.BatchMatchOptions) []es.BatchMatchResult
+	// UpdateCompanyInfo sets fields of an existing company.
+	UpdateCompanyInfo(ctx context.Context, url string, info map[string]any) error
+	// BulkIndexCompanies upserts companies loaded from a CSV file.
+	BulkIndexCompanies(companies []csv.Company, options *es.BulkIndexOptions) (*es.BulkIndexStats, error)
+	// NewPhoneNumbersWriter returns a writer merging scraped phone numbers into the stored companies.
+	NewPhoneNumbersWriter(options *es.PhoneNumbersWriterOptions) (PhoneNumbersWriter, error)
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// PhoneNumbersWriter merges the phone numbers found by scrapes, see es.PhoneNumbersWriter.
+type PhoneNumbersWriter interface {
+	Add(ctx context.Context, url string, sightings []es.PhoneSighting, visited []string) error
+	Close(ctx context.Context) (*es.BulkUpdateStats, error)
+}
+
+// Config selects the storage backend.
+type Config struct {
+	// One of BackendElastic or BackendSQLite, BackendElastic if empty
+	Backend string
+	// Path of the SQLite database file, for BackendSQLite
+	SQLitePath string
+	// Loads the ElasticSearch config, only called for BackendElastic,
+	// so other backends don't need cluster credentials
+	ElasticConfig func() (*es.Config, error)
+}
+
+// New opens the store selected by the config.
+func New(config *Config) (CompanyStore, error) {
+	switch config.Backend {
+	case BackendElastic, "":
+		esConfig, err := config.ElasticConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := es.NewClient(esConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewElasticStore(client), nil
+	case BackendSQLite:
+		return OpenSQLiteStore(config.SQLitePath)
+	default:
+		return nil, fmt.Errorf("%w: %q (expected %s or %s)", ErrUnknownBackend,
+			config.Backend, BackendElastic, BackendSQLite)
+	}
+}
+
+// elasticStore stores companies in the ElasticSearch companies index.
+type elasticStore struct {
+	*es.Client
+}
+
+// NewElasticStore returns a store backed by an ElasticSearch client.
+func NewElasticStore(client *es.Client) CompanyStore {
+	return &elasticStore{Client: client}
+}
+
+func (s *elasticStore) NewPhoneNumbersWriter(options *es.PhoneNumbersWriterOptions) (PhoneNumbersWriter, error) {
+	writer, err := s.Client.NewPhoneNumbersWriter(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (s *elasticStore) Close() error {
+	return nil
+}
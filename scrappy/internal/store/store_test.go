@@ -0,0 +1,505 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"examples/scrappy/internal/csv"
+	"examples/scrappy/internal/es"
+)
+
+var testCompanies = []csv.Company{
+	{
+		Domain:            csv.JSONUrl{URL: &url.URL{Scheme: "https", Host: "mazautoglass.com"}},
+		CommercialName:    "MAZ Auto Glass",
+		LegalName:         "MAZ Auto Glass LLC",
+		AllAvailableNames: []string{"MAZ Auto Glass", "Maz Glass"},
+	},
+	{
+		Domain:         csv.JSONUrl{URL: &url.URL{Scheme: "https", Host: "putitontheglass.com"}},
+		CommercialName: "Put It On The Glass",
+		Attributes:     map[string]string{"facebook": "https://www.facebook.com/PutItOnTheGlass/"},
+	},
+	{
+		Domain:         csv.JSONUrl{URL: &url.URL{Scheme: "https", Host: "cafe-rouge.com"}},
+		CommercialName: "Café Rouge",
+	},
+}
+
+// testStores returns a new instance of each local backend.
+func testStores(t *testing.T) map[string]CompanyStore {
+	t.Helper()
+
+	sqliteStore, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "scrappy.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	return map[string]CompanyStore{
+		"memory":      NewMemoryStore(),
+		BackendSQLite: sqliteStore,
+	}
+}
+
+// importTestCompanies imports the test companies, with a phone number for the first one.
+func importTestCompanies(t *testing.T, store CompanyStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := store.BulkIndexCompanies(testCompanies, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	err = store.UpdateCompanyInfo(ctx, "https://mazautoglass.com",
+		map[string]any{"phone_numbers": []string{"+1 415-626-4474"}})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+}
+
+func TestStoreBulkIndexCompanies(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			stats, err := store.BulkIndexCompanies(testCompanies, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if !reflect.DeepEqual(*stats, es.BulkIndexStats{Created: 3}) {
+				t.Errorf("Expected 3 created companies, got %+v instead", stats)
+			}
+
+			err = store.UpdateCompanyInfo(ctx, "https://mazautoglass.com",
+				map[string]any{"phone_numbers": []string{"+1 415-626-4474"}})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			// Upserts keep the scraped fields, and skip unchanged companies
+			renamed := append([]csv.Company{}, testCompanies...)
+			renamed[1].CommercialName = "Put It On The Glass Inc"
+
+			stats, err = store.BulkIndexCompanies(renamed, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if !reflect.DeepEqual(*stats, es.BulkIndexStats{Updated: 1, Unchanged: 2}) {
+				t.Errorf("Expected 1 updated and 2 unchanged companies, got %+v instead", stats)
+			}
+
+			company, err := store.GetCompany(ctx, "mazautoglass.com")
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if company.ID != "mazautoglass.com" || !reflect.DeepEqual(company.PhoneNumbers, []string{"+1 415-626-4474"}) {
+				t.Errorf("Expected company with its phone numbers, got %+v instead", company)
+			}
+
+			// Overwrites drop the scraped fields
+			_, err = store.BulkIndexCompanies(testCompanies[:1], &es.BulkIndexOptions{Overwrite: true})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			company, err = store.GetCompany(ctx, "mazautoglass.com")
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if len(company.PhoneNumbers) != 0 {
+				t.Errorf("Expected phone numbers to be dropped, got %v", company.PhoneNumbers)
+			}
+
+			_, err = store.GetCompany(ctx, "missing.com")
+			if !errors.Is(err, es.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+
+			err = store.UpdateCompanyInfo(ctx, "missing.com", map[string]any{"phone_numbers": []string{}})
+			if !errors.Is(err, es.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreSearchCompany(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		phone    string
+		expected []string
+		matched  []string
+	}{
+		{
+			name:     "phrase",
+			query:    "auto glass",
+			expected: []string{"mazautoglass.com"},
+			matched:  []string{matchNamePhrase, matchNameTerms, matchNamePrefix},
+		},
+		{
+			name:     "shared term",
+			query:    "glass",
+			expected: []string{"mazautoglass.com", "putitontheglass.com"},
+			matched:  []string{matchNamePhrase, matchNameTerms, matchNamePrefix},
+		},
+		{
+			name:     "prefix",
+			query:    "put it on the gla",
+			expected: []string{"putitontheglass.com"},
+			matched:  []string{matchNamePrefix},
+		},
+		{
+			name:     "accents",
+			query:    "cafe",
+			expected: []string{"cafe-rouge.com"},
+			matched:  []string{matchNamePhrase, matchNameTerms, matchNamePrefix},
+		},
+		{
+			name:     "phone number",
+			phone:    "(415) 626-4474",
+			expected: []string{"mazautoglass.com"},
+			matched:  []string{matchPhone},
+		},
+		{
+			name:     "partial phone number",
+			phone:    "626-4474",
+			expected: []string{"mazautoglass.com"},
+			matched:  []string{matchPhonePartial},
+		},
+		{
+			name:     "no match",
+			query:    "bakery",
+			expected: []string{},
+		},
+	}
+
+	for name, store := range testStores(t) {
+		importTestCompanies(t, store)
+
+		for _, tc := range testCases {
+			t.Run(name+"/"+tc.name, func(t *testing.T) {
+				result, err := store.SearchCompany(context.Background(), tc.query, tc.phone, nil)
+				if err != nil {
+					t.Fatalf("Unexpected error %s", err)
+				}
+
+				ids := []string{}
+				for _, company := range result.Companies {
+					ids = append(ids, company.ID)
+				}
+				if !reflect.DeepEqual(ids, tc.expected) || result.Total != len(tc.expected) {
+					t.Fatalf("Expected %v, got %v (total %d) instead", tc.expected, ids, result.Total)
+				}
+
+				if len(ids) > 0 && !reflect.DeepEqual(result.Companies[0].MatchedQueries, tc.matched) {
+					t.Errorf("Expected matched queries %v, got %v instead", tc.matched, result.Companies[0].MatchedQueries)
+				}
+			})
+		}
+	}
+}
+
+func TestStoreSearchCompanyPages(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			importTestCompanies(t, store)
+			ctx := context.Background()
+
+			first, err := store.SearchCompany(ctx, "glass", "", &es.SearchOptions{Limit: 1})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if len(first.Companies) != 1 || first.Total != 2 || first.Next == "" {
+				t.Fatalf("Expected a first page with a cursor, got %+v", first)
+			}
+
+			second, err := store.SearchCompany(ctx, "glass", "", &es.SearchOptions{Limit: 1, Cursor: first.Next})
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if len(second.Companies) != 1 || second.Next != "" || second.Companies[0].ID == first.Companies[0].ID {
+				t.Errorf("Expected the last page, got %+v", second)
+			}
+
+			_, err = store.SearchCompany(ctx, "glass", "", &es.SearchOptions{Cursor: "invalid"})
+			if !errors.Is(err, es.ErrInvalidParams) {
+				t.Errorf("Expected ErrInvalidParams, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreMatchCompany(t *testing.T) {
+	testCases := []struct {
+		name     string
+		match    es.MatchQuery
+		expected string
+		matched  []string
+	}{
+		{
+			name:     "website",
+			match:    es.MatchQuery{Name: "Glass Co", Website: "www.putitontheglass.com/contact"},
+			expected: "putitontheglass.com",
+			matched:  []string{matchNameFuzzy, matchDomain},
+		},
+		{
+			name:     "facebook page",
+			match:    es.MatchQuery{Facebook: "m.facebook.com/putitontheglass"},
+			expected: "putitontheglass.com",
+			matched:  []string{matchFacebook},
+		},
+		{
+			name:     "phone number",
+			match:    es.MatchQuery{Name: "Glass", Phone: "+1 415 626 4474"},
+			expected: "mazautoglass.com",
+			matched:  []string{matchNamePhrase, matchNameFuzzy, matchPhone},
+		},
+	}
+
+	for name, store := range testStores(t) {
+		importTestCompanies(t, store)
+
+		for _, tc := range testCases {
+			t.Run(name+"/"+tc.name, func(t *testing.T) {
+				result, err := store.MatchCompany(context.Background(), &tc.match)
+				if err != nil {
+					t.Fatalf("Unexpected error %s", err)
+				}
+
+				best := result.Best()
+				if best == nil || best.ID != tc.expected {
+					t.Fatalf("Expected best candidate %q, got %+v", tc.expected, best)
+				}
+				if !reflect.DeepEqual(best.MatchedQueries, tc.matched) {
+					t.Errorf("Expected matched queries %v, got %v instead", tc.matched, best.MatchedQueries)
+				}
+			})
+		}
+
+		_, err := store.MatchCompany(context.Background(), &es.MatchQuery{})
+		if !errors.Is(err, es.ErrInvalidParams) {
+			t.Errorf("Expected ErrInvalidParams, got %v", err)
+		}
+	}
+}
+
+// rankedCompany is a search or match result, as compared across backends.
+type rankedCompany struct {
+	ID      string
+	Score   float64
+	Matched []string
+}
+
+func rankedCompanies(companies []es.Company) []rankedCompany {
+	ranked := []rankedCompany{}
+	for _, company := range companies {
+		ranked = append(ranked, rankedCompany{ID: company.ID, Score: company.Score, Matched: company.MatchedQueries})
+	}
+
+	return ranked
+}
+
+// The backends find candidates differently, the memory one scores every document,
+// but they must return the same results, scored alike, for the same companies.
+func TestStoreBackendsAgree(t *testing.T) {
+	searches := []struct {
+		query string
+		phone string
+	}{
+		{query: "glass"},
+		{query: "auto glass"},
+		{query: "maz gla"},
+		{query: "Café"},
+		{phone: "626-4474"},
+		{phone: "+1 415-626-4474"},
+		{query: "bakery"},
+	}
+
+	matches := []es.MatchQuery{
+		{Name: "Maz Glass"},
+		{Name: "Glass Co", Website: "https://putitontheglass.com"},
+		{Name: "Rouge", Phone: "415 626 4474"},
+		{Facebook: "facebook.com/putitontheglass"},
+	}
+
+	ctx := context.Background()
+	results := map[string][]any{}
+	for name, store := range testStores(t) {
+		importTestCompanies(t, store)
+
+		for _, search := range searches {
+			result, err := store.SearchCompany(ctx, search.query, search.phone, &es.SearchOptions{Limit: es.MaxSearchLimit})
+			if err != nil {
+				t.Fatalf("%s: unexpected error %s", name, err)
+			}
+			results[name] = append(results[name], rankedCompanies(result.Companies))
+		}
+
+		for index := range matches {
+			result, err := store.MatchCompany(ctx, &matches[index])
+			if err != nil {
+				t.Fatalf("%s: unexpected error %s", name, err)
+			}
+			results[name] = append(results[name], rankedCompanies(result.Candidates))
+		}
+	}
+
+	expected := results["memory"]
+	for index, result := range results[BackendSQLite] {
+		if !reflect.DeepEqual(result, expected[index]) {
+			t.Errorf("Query %d: expected the same results as the memory store %+v, got %+v", index, expected[index], result)
+		}
+	}
+}
+
+func TestStorePhoneNumbersWriter(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			importTestCompanies(t, store)
+			ctx := context.Background()
+
+			writer, err := store.NewPhoneNumbersWriter(nil)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			sightings := []es.PhoneSighting{{Number: "+1 415-626-4475", Source: "https://mazautoglass.com/contact"}}
+			for _, url := range []string{"https://mazautoglass.com", "https://missing.com"} {
+				err = writer.Add(ctx, url, sightings, []string{"https://mazautoglass.com/contact"})
+				if err != nil {
+					t.Fatalf("Unexpected error %s", err)
+				}
+			}
+
+			stats, err := writer.Close(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if !reflect.DeepEqual(*stats, es.BulkUpdateStats{Updated: 1, NotFound: 1}) {
+				t.Errorf("Expected 1 updated and 1 missing company, got %+v instead", stats)
+			}
+
+			// The number added by hand is kept, next to the scraped one
+			company, err := store.GetCompany(ctx, "mazautoglass.com")
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+
+			expected := []string{"+1 415-626-4474", "+1 415-626-4475"}
+			if !reflect.DeepEqual(company.PhoneNumbers, expected) {
+				t.Errorf("Expected phone numbers %v, got %v instead", expected, company.PhoneNumbers)
+			}
+			if len(company.PhoneHistory) != 2 || company.PhoneHistory[1].TimesSeen != 1 ||
+				!reflect.DeepEqual(company.PhoneHistory[1].Sources, []string{"https://mazautoglass.com/contact"}) {
+				t.Errorf("Expected the scraped number in the phone history, got %+v", company.PhoneHistory)
+			}
+		})
+	}
+}
+
+func TestDocumentMergePhoneNumbers(t *testing.T) {
+	now := time.Date(2022, time.December, 22, 11, 30, 0, 0, time.UTC)
+	staleAfter := 24 * time.Hour
+
+	// A number last seen three weeks ago, on the contact page
+	oldRecord := func() map[string]any {
+		return map[string]any{
+			"number":     "+1 415-626-4474",
+			"first_seen": "2022-12-01T10:00:00Z",
+			"last_seen":  "2022-12-01T10:00:00Z",
+			"times_seen": 2,
+			"sources":    []any{"https://mazautoglass.com/contact"},
+			"confidence": 2,
+			"stale":      false,
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		record        map[string]any
+		visited       []string
+		expectedStale bool
+	}{
+		{
+			name:          "source visited",
+			record:        oldRecord(),
+			visited:       []string{"https://mazautoglass.com", "https://mazautoglass.com/contact"},
+			expectedStale: true,
+		},
+		{
+			// The scrape stopped before the page the number was found on
+			name:    "source not visited",
+			record:  oldRecord(),
+			visited: []string{"https://mazautoglass.com"},
+		},
+		{
+			name: "added by hand",
+			record: map[string]any{
+				"number":     "+1 415-626-4474",
+				"first_seen": "2022-12-01T10:00:00Z",
+				"last_seen":  "2022-12-01T10:00:00Z",
+				"times_seen": 0,
+				"sources":    []any{},
+				"stale":      false,
+			},
+			visited: []string{"https://mazautoglass.com/contact"},
+		},
+		{
+			name: "no confidence",
+			record: func() map[string]any {
+				record := oldRecord()
+				delete(record, "confidence")
+				return record
+			}(),
+			visited: []string{"https://mazautoglass.com/contact"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := document{
+				"phone_numbers": "+1 415-626-4474",
+				"phone_history": []any{tc.record},
+			}
+
+			changed, err := doc.mergePhoneNumbers([]es.PhoneSighting{{Number: "+1 888-999-0000"}}, tc.visited, now, staleAfter)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if !changed {
+				t.Fatalf("Expected the document to change")
+			}
+
+			// Stale numbers are kept in the history only
+			expected := []string{"+1 415-626-4474", "+1 888-999-0000"}
+			if tc.expectedStale {
+				expected = []string{"+1 888-999-0000"}
+			}
+			if !reflect.DeepEqual(doc["phone_numbers"], expected) {
+				t.Errorf("Expected current numbers %v, got %v", expected, doc["phone_numbers"])
+			}
+
+			history := doc["phone_history"].([]es.PhoneRecord)
+			if len(history) != 2 || history[0].Stale != tc.expectedStale || history[1].Stale {
+				t.Errorf("Expected the old number stale to be %t, got %+v", tc.expectedStale, history)
+			}
+
+			// Nothing changes until a number is seen again, or becomes stale
+			changed, err = doc.mergePhoneNumbers(nil, tc.visited, now.Add(time.Hour), staleAfter)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if changed {
+				t.Errorf("Expected the document to be unchanged")
+			}
+		})
+	}
+}
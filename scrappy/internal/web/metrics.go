@@ -0,0 +1,36 @@
+package web
+
+import "time"
+
+// Observer is notified of the pages fetched by scrapes and domain checks, e.g. to export metrics.
+//
+// It's called from several goroutines.
+type Observer interface {
+	// ObservePage is called for each page response or failed request,
+	// with a status of 0 if no response was received.
+	ObservePage(status int, bytes int)
+	// ObserveScrape is called once a domain scrape completes.
+	ObserveScrape(duration time.Duration, phoneNumbers int, err error)
+	// ObserveCheck is called for each domain check, with a status of 0 if it failed.
+	ObserveCheck(status int, duration time.Duration)
+}
+
+// observer is notified of every scrape and check, see SetObserver.
+var observer Observer = nopObserver{}
+
+// SetObserver sets the observer notified of scrapes and domain checks,
+// it must be called before scraping or checking domains.
+//
+// A nil observer disables notifications.
+func SetObserver(o Observer) {
+	if o == nil {
+		o = nopObserver{}
+	}
+	observer = o
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObservePage(int, int)                    {}
+func (nopObserver) ObserveScrape(time.Duration, int, error) {}
+func (nopObserver) ObserveCheck(int, time.Duration)         {}
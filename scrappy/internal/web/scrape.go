@@ -2,6 +2,7 @@ package web
 
 import (
 	"examples/scrappy/internal/phone"
+	"fmt"
 	"log"
 	"net/url"
 	"strings"
@@ -19,6 +20,18 @@ const maxPagesScrapedPerDomain = 10
 type ScrapeInfo struct {
 	PhoneNumbers []phone.Phone
 	LinksVisited []string
+	// HTTP status of each page requested, including failed requests
+	Statuses []PageStatus
+	// Errors of failed page requests
+	Errors    []string
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// PageStatus is the HTTP status of a requested page, 0 if no response was received.
+type PageStatus struct {
+	URL    string
+	Status int
 }
 
 // EnoughInfo returns true once we have collected enough information for a domain.
@@ -51,11 +64,11 @@ func ScrapeDomain(domain string) (*ScrapeInfo, error) {
 	// Check domain URL first
 	domainUrl, err := url.Parse(domain)
 	if err != nil {
-		return nil, err
+		return &ScrapeInfo{StartedAt: time.Now(), Errors: []string{err.Error()}}, err
 	}
 
 	// State
-	info := ScrapeInfo{}
+	info := ScrapeInfo{StartedAt: time.Now()}
 	links := []string{}
 	seen := map[string]bool{}
 
@@ -77,7 +90,10 @@ func ScrapeDomain(domain string) (*ScrapeInfo, error) {
 		})
 
 		textContent := e.DOM.Text()
-		info.PhoneNumbers = append(info.PhoneNumbers, phone.MatchPhoneNumbers(textContent)...)
+		for _, number := range phone.MatchPhoneNumbers(textContent) {
+			number.Source = e.Request.URL.String()
+			info.PhoneNumbers = append(info.PhoneNumbers, number)
+		}
 	})
 
 	// Get all of the link hrefs from each nav element
@@ -99,7 +115,9 @@ func ScrapeDomain(domain string) (*ScrapeInfo, error) {
 		// Check if we have any links with a[href="tel:< phone number >"]
 		if strings.HasPrefix(href, hrefPrefix) {
 			tel := strings.TrimPrefix(href, hrefPrefix)
-			info.PhoneNumbers = append(info.PhoneNumbers, *phone.NewFromHrefTel(tel))
+			number := phone.NewFromHrefTel(tel)
+			number.Source = e.Request.URL.String()
+			info.PhoneNumbers = append(info.PhoneNumbers, *number)
 		}
 	})
 
@@ -133,6 +151,19 @@ func ScrapeDomain(domain string) (*ScrapeInfo, error) {
 		}
 	})
 
+	// Record the status of each page, failed requests included
+	c.OnResponse(func(r *colly.Response) {
+		info.Statuses = append(info.Statuses, PageStatus{URL: r.Request.URL.String(), Status: r.StatusCode})
+		observer.ObservePage(r.StatusCode, len(r.Body))
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		url := r.Request.URL.String()
+		info.Statuses = append(info.Statuses, PageStatus{URL: url, Status: r.StatusCode})
+		info.Errors = append(info.Errors, fmt.Sprintf("%s: %s", url, err))
+		observer.ObservePage(r.StatusCode, len(r.Body))
+	})
+
 	// Log each visited endpoint
 	c.OnRequest(func(r *colly.Request) {
 		log.Printf("Visiting %q\n", r.URL.String())
@@ -144,8 +175,15 @@ func ScrapeDomain(domain string) (*ScrapeInfo, error) {
 	// Wait for collector jobs to return, in case we choose to use async
 	c.Wait()
 
+	// Errors before any request was sent (e.g. forbidden domain) don't reach OnError
+	if err != nil && len(info.Statuses) == 0 {
+		info.Errors = append(info.Errors, err.Error())
+	}
+
 	// Sanitize gathered information
 	info.SanitizePhoneNumbers()
+	info.Duration = time.Since(info.StartedAt)
+	observer.ObserveScrape(info.Duration, len(info.PhoneNumbers), err)
 
 	return &info, err
 }
@@ -26,11 +26,15 @@ func NewClient(timeout time.Duration) *http.Client {
 
 // CheckURL send an http HEAD request to the url to check if it is reachable.
 func CheckURL(url string) (status int, err error) {
+	start := time.Now()
 	response, err := NewClient(defaultTimeout).Head(url)
 	if err != nil {
+		observer.ObserveCheck(0, time.Since(start))
 		return 0, err
 	}
+	response.Body.Close()
 
+	observer.ObserveCheck(response.StatusCode, time.Since(start))
 	return response.StatusCode, nil
 }
 